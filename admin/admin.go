@@ -0,0 +1,289 @@
+// Package admin serves an HTTP API for inspecting and managing a running
+// node: its groups, the hash ring it sees and its discovery registration.
+//
+//	GET    /_admin/groups                    groups with sizes and stats
+//	GET    /_admin/groups/{group}            one group
+//	DELETE /_admin/groups/{group}            purge the group on this node
+//	DELETE /_admin/groups/{group}/keys/{key} evict a key on this node
+//	GET    /_admin/ring                      ring members and virtual nodes
+//	GET    /_admin/owner?key=                peer owning a key
+//	GET    /_admin/discovery                 registration state and peers
+//
+// Mount the Handler next to the HTTPPool (or the gRPC Server) it inspects,
+// e.g. on a separate admin port.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kunCache/auth"
+	"kunCache/discovery"
+	"kunCache/gcache"
+	"kunCache/peer"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BasePath is the prefix of every admin route.
+const BasePath = "/_admin/"
+
+// Group is the ACL group guarding the cluster-wide routes (ring, owner,
+// discovery). Group routes are guarded by the ACL of the group itself.
+const Group = "_admin"
+
+// Cluster is a node's view of the cluster. httpserver.HTTPPool and
+// grpcserver.Server implement it.
+type Cluster[K comparable, V any] interface {
+	// Owner returns the peer owning key; ok is false when it is this node.
+	Owner(key K) (addr K, t peer.Transferer[K, V], ok bool)
+	// RingMembers returns the peers on the ring with their virtual nodes.
+	RingMembers() map[K]int
+	// Service is how this node registers itself.
+	Service() *discovery.Service
+	// Discovery is the discovery in use, nil if not started yet.
+	Discovery() discovery.Discovery
+}
+
+// Handler serves the admin API.
+type Handler[K comparable, V any] struct {
+	cluster Cluster[K, V]
+	guard   *auth.Guard
+	mux     *http.ServeMux
+}
+
+// New returns a Handler for cluster. cluster may be nil on a standalone
+// node, in which case only the group routes are useful. guard, if not nil,
+// authorizes requests: GET needs read and DELETE needs write access.
+func New[K comparable, V any](cluster Cluster[K, V], guard *auth.Guard) *Handler[K, V] {
+	h := &Handler[K, V]{cluster: cluster, guard: guard, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET "+BasePath+"groups", h.listGroups)
+	h.mux.HandleFunc("GET "+BasePath+"groups/{group}", h.getGroup)
+	h.mux.HandleFunc("DELETE "+BasePath+"groups/{group}", h.purgeGroup)
+	h.mux.HandleFunc("DELETE "+BasePath+"groups/{group}/keys/{key...}", h.evictKey)
+	h.mux.HandleFunc("GET "+BasePath+"ring", h.ring)
+	h.mux.HandleFunc("GET "+BasePath+"owner", h.owner)
+	h.mux.HandleFunc("GET "+BasePath+"discovery", h.discovery)
+	return h
+}
+
+func (h *Handler[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// GroupView is the JSON form of a group.
+type GroupView struct {
+	Name    string       `json:"name"`
+	Entries int64        `json:"entries"`
+	Stats   gcache.Stats `json:"stats"`
+}
+
+func groupView(g gcache.GroupInfo) GroupView {
+	return GroupView{Name: g.Name(), Entries: g.Len(), Stats: g.Stats()}
+}
+
+func (h *Handler[K, V]) listGroups(w http.ResponseWriter, r *http.Request) {
+	// 先校验身份，再只列出有读权限的分组
+	if h.guard != nil {
+		if _, err := h.guard.Authenticator.Verify(auth.BearerToken(r.Header.Get("Authorization"))); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	views := []GroupView{}
+	for _, g := range gcache.ListGroups() {
+		if h.allowed(r, g.Name(), auth.Read) {
+			views = append(views, groupView(g))
+		}
+	}
+	writeJSON(w, views)
+}
+
+func (h *Handler[K, V]) getGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := h.lookup(w, r, auth.Read)
+	if !ok {
+		return
+	}
+	writeJSON(w, groupView(g))
+}
+
+func (h *Handler[K, V]) purgeGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := h.lookup(w, r, auth.Write)
+	if !ok {
+		return
+	}
+	g.Purge()
+	slog.Info("[Admin] purged group", "group", g.Name())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler[K, V]) evictKey(w http.ResponseWriter, r *http.Request) {
+	g, ok := h.lookup(w, r, auth.Write)
+	if !ok {
+		return
+	}
+	// 键类型与管理接口的 K 不同的分组无法按 key 删除
+	remover, ok := g.(interface{ Remove(key K) })
+	if !ok {
+		http.Error(w, "group "+g.Name()+" has a different key type", http.StatusBadRequest)
+		return
+	}
+	key, ok := parseKey[K](r.PathValue("key"))
+	if !ok {
+		http.Error(w, "bad key", http.StatusBadRequest)
+		return
+	}
+	remover.Remove(key)
+	slog.Info("[Admin] evicted key", "group", g.Name(), "key", key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookup authorizes the request against the group named in the path and
+// returns the group, writing an error response when it fails.
+func (h *Handler[K, V]) lookup(w http.ResponseWriter, r *http.Request, op auth.Op) (gcache.GroupInfo, bool) {
+	name := r.PathValue("group")
+	if !h.authorize(w, r, name, op) {
+		return nil, false
+	}
+	g, ok := gcache.LookupGroup(name)
+	if !ok {
+		http.Error(w, "no such group: "+name, http.StatusNotFound)
+		return nil, false
+	}
+	return g, true
+}
+
+// RingMember is a peer on the hash ring.
+type RingMember struct {
+	Addr         string `json:"addr"`
+	VirtualNodes int    `json:"virtual_nodes"`
+	Self         bool   `json:"self"`
+}
+
+func (h *Handler[K, V]) ring(w http.ResponseWriter, r *http.Request) {
+	if !h.clustered(w) || !h.authorize(w, r, Group, auth.Read) {
+		return
+	}
+	self := h.cluster.Service().Addr
+	members := []RingMember{}
+	for addr, n := range h.cluster.RingMembers() {
+		a := fmt.Sprint(addr)
+		members = append(members, RingMember{Addr: a, VirtualNodes: n, Self: a == self})
+	}
+	slices.SortFunc(members, func(a, b RingMember) int {
+		return strings.Compare(a.Addr, b.Addr)
+	})
+	writeJSON(w, members)
+}
+
+// Owner is the JSON answer of the owner route.
+type Owner struct {
+	Key  string `json:"key"`
+	Addr string `json:"addr"`
+	Self bool   `json:"self"`
+}
+
+func (h *Handler[K, V]) owner(w http.ResponseWriter, r *http.Request) {
+	if !h.clustered(w) || !h.authorize(w, r, Group, auth.Read) {
+		return
+	}
+	raw := r.URL.Query().Get("key")
+	key, ok := parseKey[K](raw)
+	if raw == "" || !ok {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	addr, _, remote := h.cluster.Owner(key)
+	writeJSON(w, Owner{Key: raw, Addr: fmt.Sprint(addr), Self: !remote})
+}
+
+// DiscoveryState is the JSON answer of the discovery route.
+type DiscoveryState struct {
+	// Registered reports whether this node is listed by the discovery,
+	// e.g. its etcd lease is alive.
+	Registered bool                 `json:"registered"`
+	Service    *discovery.Service   `json:"service"`
+	Peers      []*discovery.Service `json:"peers"`
+	Error      string               `json:"error,omitempty"`
+}
+
+func (h *Handler[K, V]) discovery(w http.ResponseWriter, r *http.Request) {
+	if !h.clustered(w) || !h.authorize(w, r, Group, auth.Read) {
+		return
+	}
+	state := DiscoveryState{Service: h.cluster.Service(), Peers: []*discovery.Service{}}
+	d := h.cluster.Discovery()
+	if d == nil {
+		state.Error = "discovery not started"
+		writeJSON(w, state)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	services, err := d.List(ctx)
+	if err != nil {
+		state.Error = err.Error()
+	}
+	for _, s := range services {
+		if s.Addr == state.Service.Addr {
+			state.Registered = true
+		}
+		state.Peers = append(state.Peers, s)
+	}
+	writeJSON(w, state)
+}
+
+func (h *Handler[K, V]) clustered(w http.ResponseWriter) bool {
+	if h.cluster == nil {
+		http.Error(w, "node is not part of a cluster", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// authorize 校验请求凭证，失败时写入 401/403
+func (h *Handler[K, V]) authorize(w http.ResponseWriter, r *http.Request, group string, op auth.Op) bool {
+	if h.guard == nil {
+		return true
+	}
+	if _, err := h.guard.Check(auth.BearerToken(r.Header.Get("Authorization")), group, op); err != nil {
+		slog.Info("[Admin] rejected request", "url", r.URL.Path, "err", err)
+		if errors.Is(err, auth.ErrPermissionDenied) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+		return false
+	}
+	return true
+}
+
+// allowed 与 authorize 相同但不写响应，用于过滤列表
+func (h *Handler[K, V]) allowed(r *http.Request, group string, op auth.Op) bool {
+	if h.guard == nil {
+		return true
+	}
+	_, err := h.guard.Check(auth.BearerToken(r.Header.Get("Authorization")), group, op)
+	return err == nil
+}
+
+// parseKey converts a key from the URL to K, which must be string-based
+// like everywhere else keys cross the wire.
+func parseKey[K comparable](raw string) (key K, ok bool) {
+	key, ok = any(raw).(K)
+	return
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,147 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kunCache/auth"
+	"kunCache/conf"
+	"kunCache/discovery"
+	"kunCache/gcache"
+	httpserver "kunCache/http"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newCluster(t *testing.T) *httpserver.HTTPPool[string, []byte] {
+	t.Helper()
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50}
+	p, err := httpserver.NewHTTPPool[string, []byte](c, "127.0.0.1:8000", "127.0.0.1", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := discovery.NewMemory()
+	p.SetDiscovery(d)
+	d.Register(context.Background(), p.Service())
+	p.AddPeers("127.0.0.1:8000", "127.0.0.1:8001")
+	return p
+}
+
+func get[T any](t *testing.T, url string, v *T) int {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+func del(t *testing.T, url string, token string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodDelete, url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestAdmin(t *testing.T) {
+	p := newCluster(t)
+	g, err := gcache.NewGroup[string, []byte]("admin-scores", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Get("Tom")
+	g.Get("Jack")
+
+	srv := httptest.NewServer(New[string, []byte](p, nil))
+	defer srv.Close()
+
+	var group GroupView
+	if code := get(t, srv.URL+BasePath+"groups/admin-scores", &group); code != http.StatusOK {
+		t.Fatalf("get group returned %d", code)
+	}
+	if group.Entries != 2 || group.Stats.Gets != 2 {
+		t.Fatalf("group = %+v", group)
+	}
+
+	var members []RingMember
+	get(t, srv.URL+BasePath+"ring", &members)
+	want := []RingMember{{Addr: "127.0.0.1:8000", VirtualNodes: 50, Self: true}, {Addr: "127.0.0.1:8001", VirtualNodes: 50}}
+	if fmt.Sprint(members) != fmt.Sprint(want) {
+		t.Fatalf("ring = %+v, want %+v", members, want)
+	}
+
+	var owner Owner
+	get(t, srv.URL+BasePath+"owner?key=Tom", &owner)
+	if owner.Addr == "" || owner.Self != (owner.Addr == "127.0.0.1:8000") {
+		t.Fatalf("owner = %+v", owner)
+	}
+
+	var state DiscoveryState
+	get(t, srv.URL+BasePath+"discovery", &state)
+	if !state.Registered || len(state.Peers) != 1 {
+		t.Fatalf("discovery = %+v", state)
+	}
+
+	if code := del(t, srv.URL+BasePath+"groups/admin-scores/keys/Tom", ""); code != http.StatusNoContent {
+		t.Fatalf("evict returned %d", code)
+	}
+	if g.Len() != 1 {
+		t.Fatalf("len after evict = %d, want 1", g.Len())
+	}
+	if code := del(t, srv.URL+BasePath+"groups/admin-scores", ""); code != http.StatusNoContent {
+		t.Fatalf("purge returned %d", code)
+	}
+	if g.Len() != 0 {
+		t.Fatalf("len after purge = %d, want 0", g.Len())
+	}
+	if code := del(t, srv.URL+BasePath+"groups/unknown", ""); code != http.StatusNotFound {
+		t.Fatalf("purge of unknown group returned %d", code)
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	p := newCluster(t)
+	if _, err := gcache.NewGroup[string, []byte]("admin-auth", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		})); err != nil {
+		t.Fatal(err)
+	}
+	h := auth.NewHMAC([]byte("secret"), "ops", time.Minute)
+	guard := &auth.Guard{Authenticator: h, ACL: auth.ACL{
+		"admin-auth": {Read: []string{"ops", "viewer"}, Write: []string{"ops"}},
+	}}
+	srv := httptest.NewServer(New[string, []byte](p, guard))
+	defer srv.Close()
+
+	var members []RingMember
+	if code := get(t, srv.URL+BasePath+"ring", &members); code != http.StatusUnauthorized {
+		t.Fatalf("ring without token returned %d", code)
+	}
+	viewer, _ := h.Issue("viewer")
+	if code := del(t, srv.URL+BasePath+"groups/admin-auth", viewer); code != http.StatusForbidden {
+		t.Fatalf("purge by viewer returned %d", code)
+	}
+	ops, _ := h.Issue("ops")
+	if code := del(t, srv.URL+BasePath+"groups/admin-auth", ops); code != http.StatusNoContent {
+		t.Fatalf("purge by ops returned %d", code)
+	}
+}
@@ -0,0 +1,198 @@
+// Package admission limits how many requests a server or a group handles
+// at a time. Requests beyond the limit wait in a bounded queue until a
+// slot frees up or their deadline passes, and are shed with
+// peer.ErrOverloaded otherwise, so a traffic spike is turned away early
+// instead of piling up goroutines behind slow loads.
+//
+// The limit can adapt to latency (AIMD): every request finishing within
+// the target latency raises it a little, up to the configured maximum,
+// while a slow or overloaded one cuts it by a tenth.
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kunCache/conf"
+	"kunCache/peer"
+	"sync"
+	"time"
+)
+
+// Options configures a Limiter.
+type Options struct {
+	// MaxInFlight is the maximum number of requests handled at a time.
+	MaxInFlight int
+	// MaxQueue is how many requests may wait for a slot; more are shed at
+	// once. Zero sheds every request beyond the limit.
+	MaxQueue int
+	// QueueTimeout bounds the time spent waiting, on top of the deadline of
+	// the request. Zero leaves only the latter.
+	QueueTimeout time.Duration
+	// TargetLatency enables the adaptive limit: requests slower than it
+	// shrink the limit. Zero keeps the limit at MaxInFlight.
+	TargetLatency time.Duration
+	// MinInFlight is the lowest the adaptive limit goes, 1 by default.
+	MinInFlight int
+}
+
+// Stats is a snapshot of a Limiter.
+type Stats struct {
+	Limit    int   `json:"limit"`     // current limit
+	InFlight int   `json:"in_flight"` // requests being handled
+	Queued   int   `json:"queued"`    // requests waiting for a slot
+	Shed     int64 `json:"shed"`      // requests rejected so far
+}
+
+// Limiter admits requests up to its limit. A nil *Limiter admits every
+// request.
+type Limiter struct {
+	opts Options
+
+	mu       sync.Mutex
+	limit    float64 // 自适应时为小数，取整后作为上限
+	inFlight int
+	queue    []*waiter
+	shed     int64
+}
+
+// waiter 排队等待的请求，granted 后 ready 被关闭
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// New creates a Limiter. It panics if opts.MaxInFlight is not positive.
+func New(opts Options) *Limiter {
+	if opts.MaxInFlight <= 0 {
+		panic("admission: MaxInFlight must be > 0")
+	}
+	opts.MinInFlight = min(max(opts.MinInFlight, 1), opts.MaxInFlight)
+	return &Limiter{opts: opts, limit: float64(opts.MaxInFlight)}
+}
+
+// FromConfig builds the Limiter described by c. It returns nil if c is
+// nil, which disables admission control.
+func FromConfig(c *conf.AdmissionConfig) *Limiter {
+	if c == nil {
+		return nil
+	}
+	return New(Options{
+		MaxInFlight:   c.MaxInFlight,
+		MaxQueue:      c.MaxQueue,
+		QueueTimeout:  time.Duration(c.QueueTimeout) * time.Millisecond,
+		TargetLatency: time.Duration(c.TargetLatency) * time.Millisecond,
+		MinInFlight:   c.MinInFlight,
+	})
+}
+
+// Acquire admits a request, waiting in the queue if the limit is reached.
+// It fails with an error wrapping peer.ErrOverloaded when the request is
+// shed, or with ctx.Err() when ctx is done first. On success the caller
+// must call done once the request is handled, passing its error, if any,
+// so the adaptive limit can react to it.
+func (l *Limiter) Acquire(ctx context.Context) (done func(err error), err error) {
+	if l == nil {
+		return func(error) {}, nil
+	}
+	l.mu.Lock()
+	if l.inFlight < l.current() && len(l.queue) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return l.done(time.Now()), nil
+	}
+	if len(l.queue) >= l.opts.MaxQueue {
+		l.shed++
+		l.mu.Unlock()
+		return nil, fmt.Errorf("%w: %d requests in flight", peer.ErrOverloaded, l.current())
+	}
+	w := &waiter{ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.opts.QueueTimeout > 0 {
+		timer := time.NewTimer(l.opts.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-w.ready:
+		return l.done(time.Now()), nil
+	case <-timeout:
+		err = fmt.Errorf("%w: queued for %v", peer.ErrOverloaded, l.opts.QueueTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.granted {
+		// 放弃的同时拿到了名额，直接使用
+		return l.done(time.Now()), nil
+	}
+	for i, q := range l.queue {
+		if q == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			break
+		}
+	}
+	if errors.Is(err, peer.ErrOverloaded) {
+		l.shed++
+	}
+	return nil, err
+}
+
+// done 返回释放名额的函数，同时按请求的延迟和结果调整上限
+func (l *Limiter) done(start time.Time) func(error) {
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.inFlight--
+			l.adapt(time.Since(start), err)
+			l.grant()
+		})
+	}
+}
+
+// adapt 加性增、乘性减：请求及时完成时上限每轮增加 1，变慢或过载时减少 10%
+func (l *Limiter) adapt(latency time.Duration, err error) {
+	if l.opts.TargetLatency <= 0 {
+		return
+	}
+	slow := latency > l.opts.TargetLatency ||
+		errors.Is(err, peer.ErrOverloaded) || errors.Is(err, peer.ErrTimeout) || errors.Is(err, context.DeadlineExceeded)
+	if slow {
+		l.limit = max(l.limit*0.9, float64(l.opts.MinInFlight))
+	} else {
+		l.limit = min(l.limit+1/l.limit, float64(l.opts.MaxInFlight))
+	}
+}
+
+// grant 按先来先到把空出的名额交给排队的请求
+func (l *Limiter) grant() {
+	for len(l.queue) > 0 && l.inFlight < l.current() {
+		w := l.queue[0]
+		l.queue = l.queue[1:]
+		w.granted = true
+		l.inFlight++
+		close(w.ready)
+	}
+}
+
+// current 当前的并发上限
+func (l *Limiter) current() int {
+	return int(l.limit)
+}
+
+// Stats returns a snapshot of the limiter. A nil Limiter has zero Stats.
+func (l *Limiter) Stats() Stats {
+	if l == nil {
+		return Stats{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{Limit: l.current(), InFlight: l.inFlight, Queued: len(l.queue), Shed: l.shed}
+}
@@ -0,0 +1,116 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"kunCache/peer"
+	"testing"
+	"time"
+)
+
+func TestLimit(t *testing.T) {
+	l := New(Options{MaxInFlight: 2})
+	done1, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 没有队列，超出上限直接拒绝
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, peer.ErrOverloaded) {
+		t.Fatalf("err = %v, want ErrOverloaded", err)
+	}
+	done1(nil)
+	done1(nil) // 重复调用无效
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("after done: %v", err)
+	}
+	if s := l.Stats(); s != (Stats{Limit: 2, InFlight: 2, Shed: 1}) {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	l := New(Options{MaxInFlight: 1, MaxQueue: 2, QueueTimeout: 50 * time.Millisecond})
+	done, _ := l.Acquire(context.Background())
+
+	// 排队的请求按先来先到得到名额
+	order := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			d, err := l.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			d(nil)
+		}(i)
+		for l.Stats().Queued != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// 队列已满
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, peer.ErrOverloaded) {
+		t.Fatalf("err = %v, want ErrOverloaded", err)
+	}
+	done(nil)
+	if a, b := <-order, <-order; a != 0 || b != 1 {
+		t.Fatalf("order = %d, %d; want 0, 1", a, b)
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	l := New(Options{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: 20 * time.Millisecond})
+	done, _ := l.Acquire(context.Background())
+	defer done(nil)
+
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, peer.ErrOverloaded) {
+		t.Fatalf("err = %v, want ErrOverloaded", err)
+	}
+	// 请求自身的截止时间更早时先到期
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	if s := l.Stats(); s.Queued != 0 || s.Shed != 1 {
+		t.Fatalf("stats = %+v, want an empty queue and 1 shed", s)
+	}
+}
+
+func TestAdaptive(t *testing.T) {
+	l := New(Options{MaxInFlight: 10, TargetLatency: 10 * time.Millisecond, MinInFlight: 2})
+	// 变慢或过载时上限减小，但不低于 MinInFlight
+	for i := 0; i < 30; i++ {
+		done, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		done(peer.ErrOverloaded)
+	}
+	if s := l.Stats(); s.Limit != 2 {
+		t.Fatalf("limit = %d, want 2", s.Limit)
+	}
+	// 及时完成的请求使上限逐渐恢复
+	for i := 0; i < 100; i++ {
+		done, _ := l.Acquire(context.Background())
+		done(nil)
+	}
+	if s := l.Stats(); s.Limit <= 2 {
+		t.Fatalf("limit = %d, want it to grow", s.Limit)
+	}
+}
+
+func TestNil(t *testing.T) {
+	var l *Limiter
+	done, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(nil)
+	if FromConfig(nil) != nil {
+		t.Fatal("FromConfig(nil) != nil")
+	}
+}
@@ -0,0 +1,138 @@
+// Package auth authenticates peers and API clients and authorizes their
+// access to groups.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"kunCache/conf"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnauthenticated is returned when a request carries no valid
+	// credential.
+	ErrUnauthenticated = errors.New("auth: unauthenticated")
+	// ErrPermissionDenied is returned when the authenticated subject may
+	// not perform the operation on the group.
+	ErrPermissionDenied = errors.New("auth: permission denied")
+)
+
+// Authenticator issues the credential attached to outgoing requests and
+// verifies the credentials of incoming ones.
+type Authenticator interface {
+	// Token returns a credential for this node.
+	Token() (string, error)
+	// Verify checks a credential and returns the subject it was issued to.
+	Verify(token string) (subject string, err error)
+}
+
+// Op is an operation on a group.
+type Op int
+
+const (
+	Read Op = iota
+	Write
+)
+
+func (op Op) String() string {
+	if op == Write {
+		return "write"
+	}
+	return "read"
+}
+
+// Wildcard matches any group or any subject in an ACL.
+const Wildcard = "*"
+
+// Rule lists the subjects allowed to read and write a group.
+type Rule struct {
+	Read  []string
+	Write []string
+}
+
+// ACL maps group names to rules. A group without a rule falls back to the
+// Wildcard rule; if there is none either, access is denied. A nil ACL
+// allows every authenticated subject.
+type ACL map[string]Rule
+
+// Allowed reports whether subject may perform op on group.
+func (a ACL) Allowed(subject, group string, op Op) bool {
+	if a == nil {
+		return true
+	}
+	rule, ok := a[group]
+	if !ok {
+		if rule, ok = a[Wildcard]; !ok {
+			return false
+		}
+	}
+	subjects := rule.Read
+	if op == Write {
+		subjects = rule.Write
+	}
+	return slices.Contains(subjects, subject) || slices.Contains(subjects, Wildcard)
+}
+
+// Guard authenticates a credential and checks it against an ACL.
+type Guard struct {
+	Authenticator Authenticator
+	ACL           ACL
+}
+
+// Check verifies token and authorizes op on group. The returned error
+// wraps ErrUnauthenticated or ErrPermissionDenied.
+func (g *Guard) Check(token, group string, op Op) (subject string, err error) {
+	if token == "" {
+		return "", fmt.Errorf("%w: missing credential", ErrUnauthenticated)
+	}
+	subject, err = g.Authenticator.Verify(token)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	if !g.ACL.Allowed(subject, group, op) {
+		return subject, fmt.Errorf("%w: %s may not %v group %s", ErrPermissionDenied, subject, op, group)
+	}
+	return subject, nil
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>"
+// header value.
+func BearerToken(header string) string {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// FromConfig builds the Guard described by c. It returns nil if c is nil,
+// which disables authentication.
+func FromConfig(c *conf.AuthConfig) (*Guard, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Secret == "" {
+		return nil, errors.New("auth: secret is required")
+	}
+	ttl := time.Duration(c.TokenTTL) * time.Second
+	var a Authenticator
+	switch strings.ToLower(c.Mode) {
+	case "", "hmac":
+		a = NewHMAC([]byte(c.Secret), c.Subject, ttl)
+	case "jwt":
+		a = NewJWT([]byte(c.Secret), c.Subject, ttl)
+	default:
+		return nil, fmt.Errorf("auth: unknown mode %q", c.Mode)
+	}
+	var acl ACL
+	if c.ACL != nil {
+		acl = make(ACL, len(c.ACL))
+		for group, rule := range c.ACL {
+			acl[group] = Rule{Read: rule.Read, Write: rule.Write}
+		}
+	}
+	return &Guard{Authenticator: a, ACL: acl}, nil
+}
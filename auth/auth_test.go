@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHMAC(t *testing.T) {
+	h := NewHMAC([]byte("secret"), "node", time.Minute)
+	token, err := h.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, err := h.Verify(token); err != nil || subject != "node" {
+		t.Fatalf("Verify() = %q, %v", subject, err)
+	}
+	if _, err := NewHMAC([]byte("other"), "node", time.Minute).Verify(token); err == nil {
+		t.Fatalf("token signed with another secret should be rejected")
+	}
+	h.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := h.Verify(token); err == nil {
+		t.Fatalf("expired token should be rejected")
+	}
+}
+
+func TestJWT(t *testing.T) {
+	j := NewJWT([]byte("secret"), "node", time.Minute)
+	token, err := j.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, err := j.Verify(token); err != nil || subject != "node" {
+		t.Fatalf("Verify() = %q, %v", subject, err)
+	}
+	// alg=none
+	none := "eyJhbGciOiJub25lIn0.eyJzdWIiOiJub2RlIn0."
+	if _, err := j.Verify(none); err == nil {
+		t.Fatalf("unsigned token should be rejected")
+	}
+	j.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := j.Verify(token); err == nil {
+		t.Fatalf("expired token should be rejected")
+	}
+}
+
+func TestGuard(t *testing.T) {
+	h := NewHMAC([]byte("secret"), "node", time.Minute)
+	g := &Guard{Authenticator: h, ACL: ACL{
+		"scores": {Read: []string{"node", "reader"}, Write: []string{"admin"}},
+		Wildcard: {Read: []string{Wildcard}},
+	}}
+	issue := func(subject string) string {
+		token, _ := h.Issue(subject)
+		return token
+	}
+
+	testCases := []struct {
+		token string
+		group string
+		op    Op
+		want  error
+	}{
+		{issue("node"), "scores", Read, nil},
+		{issue("node"), "scores", Write, ErrPermissionDenied},
+		{issue("admin"), "scores", Write, nil},
+		{issue("admin"), "scores", Read, ErrPermissionDenied},
+		{issue("anyone"), "other", Read, nil},
+		{issue("anyone"), "other", Write, ErrPermissionDenied},
+		{"", "scores", Read, ErrUnauthenticated},
+		{"garbage", "scores", Read, ErrUnauthenticated},
+	}
+	for i, tc := range testCases {
+		_, err := g.Check(tc.token, tc.group, tc.op)
+		if tc.want == nil && err != nil || tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("case %d: Check(%s, %v) = %v, want %v", i, tc.group, tc.op, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package backend creates the Getter that loads a configured cache group
+// on a miss. Backends are selected by conf.BackendConfig.Type; packages
+// providing more backends add them with Register.
+package backend
+
+import (
+	"fmt"
+	"kunCache/conf"
+	"kunCache/gcache"
+	"kunCache/loader"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Factory creates a Getter from the backend options.
+type Factory func(options map[string]string) (gcache.Getter[string, []byte], error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{
+		"memory": NewMemory,
+		"file":   NewFile,
+		"http":   NewHTTP,
+	}
+)
+
+// Register makes a backend selectable by name.
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = f
+}
+
+// Names returns the registered backend names.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the Getter configured by c.
+func New(c conf.BackendConfig) (gcache.Getter[string, []byte], error) {
+	mu.RLock()
+	f, ok := factories[c.Type]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q, have %v", c.Type, Names())
+	}
+	return f(c.Options)
+}
+
+// NewMemory serves the options themselves as data: each option is a key
+// and its value. Handy for examples and tests.
+func NewMemory(options map[string]string) (gcache.Getter[string, []byte], error) {
+	data := make(map[string][]byte, len(options))
+	for k, v := range options {
+		data[k] = []byte(v)
+	}
+	return gcache.GetterFunc[string, []byte](func(key string) ([]byte, error) {
+		if v, ok := data[key]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("%w: %s", gcache.ErrNotFound, key)
+	}), nil
+}
+
+// NewFile serves the files of the directory set by the "dir" option, see
+// loader.Dir.
+func NewFile(options map[string]string) (gcache.Getter[string, []byte], error) {
+	if options["dir"] == "" {
+		return nil, fmt.Errorf("file backend: dir is required")
+	}
+	return loader.Dir(options["dir"]), nil
+}
+
+// NewHTTP fetches keys from the origin at the "url" option, see
+// loader.HTTPOrigin. The "timeout" option bounds requests in milliseconds.
+func NewHTTP(options map[string]string) (gcache.Getter[string, []byte], error) {
+	if options["url"] == "" {
+		return nil, fmt.Errorf("http backend: url is required")
+	}
+	origin := loader.HTTP(options["url"])
+	if v := options["timeout"]; v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("http backend: timeout: %w", err)
+		}
+		origin.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	return origin, nil
+}
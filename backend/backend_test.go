@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"errors"
+	"kunCache/conf"
+	"kunCache/gcache"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	g, err := New(conf.BackendConfig{Type: "memory", Options: map[string]string{"Tom": "630"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("get Tom = %q, %v", v, err)
+	}
+	if _, err := g.Get("Jack"); err == nil {
+		t.Fatalf("missing key should fail")
+	}
+	if _, err := New(conf.BackendConfig{Type: "nope"}); err == nil {
+		t.Fatalf("unknown backend should fail")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("constant", func(options map[string]string) (gcache.Getter[string, []byte], error) {
+		return gcache.GetterFunc[string, []byte](func(key string) ([]byte, error) {
+			return []byte(options["value"]), nil
+		}), nil
+	})
+	g, err := New(conf.BackendConfig{Type: "constant", Options: map[string]string{"value": "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("any"); string(v) != "x" {
+		t.Fatalf("get = %q", v)
+	}
+}
+
+func TestFileAndHTTP(t *testing.T) {
+	if _, err := New(conf.BackendConfig{Type: "file"}); err == nil {
+		t.Fatal("file backend without dir should fail")
+	}
+	if _, err := New(conf.BackendConfig{Type: "http", Options: map[string]string{"url": "http://origin/", "timeout": "soon"}}); err == nil {
+		t.Fatal("http backend with a bad timeout should fail")
+	}
+	g, err := New(conf.BackendConfig{Type: "file", Options: map[string]string{"dir": t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Get("Tom"); !errors.Is(err, gcache.ErrNotFound) {
+		t.Fatalf("missing file err = %v, want ErrNotFound", err)
+	}
+}
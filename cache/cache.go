@@ -3,6 +3,7 @@ package cache
 import (
 	"kunCache/lru"
 	"sync"
+	"time"
 )
 
 type Cache[K comparable, V any] struct {
@@ -22,7 +23,47 @@ func (c *Cache[K, V]) Add(key K, value V, expires int64) {
 }
 
 func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	// Get 会移动节点位置，需要写锁
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Get(key)
+}
+
+// GetStale returns an entry up to grace after it expired, with its expiry.
+func (c *Cache[K, V]) GetStale(key K, grace time.Duration) (value V, expires int64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.GetStale(key, grace)
+}
+
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Remove(key)
+}
+
+// Range calls f for each unexpired entry while holding the read lock.
+func (c *Cache[K, V]) Range(f func(key K, value V, expires int64) bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.lru.Get(key)
+	c.lru.Range(f)
+}
+
+func (c *Cache[K, V]) Len() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lru.Len()
+}
+
+// Resize changes the capacity, evicting the oldest entries if it shrinks.
+func (c *Cache[K, V]) Resize(maxEntries int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Resize(maxEntries)
+}
+
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Clear()
 }
@@ -0,0 +1,94 @@
+// Package catalog shares cache group definitions across the cluster. The
+// definitions live in a Store, etcd in production, that every node
+// watches, so a group created or resized in the store is served by every
+// node without a redeploy.
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"kunCache/conf"
+	"log/slog"
+	"time"
+)
+
+// EventType is the kind of a definition change.
+type EventType int
+
+const (
+	// Put means a group was defined or its definition changed.
+	Put EventType = iota
+	// Delete means a definition was removed. Only Group.Name is set.
+	Delete
+)
+
+// Event is a definition change reported by Watch.
+type Event struct {
+	Type  EventType
+	Group conf.GroupConfig
+}
+
+// Store keeps the group definitions of the cluster.
+type Store interface {
+	// Put creates or replaces the definition of def.Name.
+	Put(ctx context.Context, def conf.GroupConfig) error
+	// Delete removes the definition of the named group.
+	Delete(ctx context.Context, name string) error
+	// List returns every definition.
+	List(ctx context.Context) ([]conf.GroupConfig, error)
+	// Watch reports definition changes until ctx is done, then closes the
+	// channel.
+	Watch(ctx context.Context) (<-chan Event, error)
+	// Close releases the resources held by the implementation.
+	Close() error
+}
+
+// New returns the Store selected by c.GroupStore: "etcd" or "memory". It
+// returns nil when no store is configured.
+func New(c *conf.Config) (Store, error) {
+	switch c.GroupStore {
+	case "":
+		return nil, nil
+	case "etcd":
+		return NewEtcd(c.Endpoints, time.Duration(c.DialTimeout)*time.Second, c.GroupPrefix)
+	case "memory":
+		return DefaultMemory, nil
+	}
+	return nil, fmt.Errorf("unknown group store %q", c.GroupStore)
+}
+
+// Sync applies the definitions in store to m and keeps applying their
+// changes until ctx is done. Definitions that cannot be applied are
+// logged and skipped.
+func Sync(ctx context.Context, store Store, m *Manager) error {
+	// 先监听再全量拉取，避免遗漏两者之间的变化
+	events, err := store.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	defs, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, def := range defs {
+		apply(m, Event{Type: Put, Group: def})
+	}
+	for event := range events {
+		apply(m, event)
+	}
+	return ctx.Err()
+}
+
+func apply(m *Manager, event Event) {
+	switch event.Type {
+	case Put:
+		if err := m.Apply(event.Group); err != nil {
+			slog.Error("[Catalog] apply group definition", "group", event.Group.Name, "err", err)
+			return
+		}
+		slog.Info("[Catalog] put", "group", event.Group.Name)
+	case Delete:
+		m.Remove(event.Group.Name)
+		slog.Info("[Catalog] delete", "group", event.Group.Name)
+	}
+}
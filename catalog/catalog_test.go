@@ -0,0 +1,194 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"kunCache/backend"
+	"kunCache/conf"
+	"kunCache/gcache"
+	"kunCache/internal/etcdtest"
+	"testing"
+	"time"
+)
+
+// eventually 等待 cond 成立
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func scores(name string, maxEntries int64) conf.GroupConfig {
+	return conf.GroupConfig{
+		Name:       name,
+		MaxEntries: maxEntries,
+		Backend:    conf.BackendConfig{Type: "memory", Options: map[string]string{"Tom": "630", "Jack": "589", "Sam": "567"}},
+	}
+}
+
+func TestSync(t *testing.T) {
+	store := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 同步开始前已存在的定义也会被应用
+	if err := store.Put(ctx, scores("sync-before", 0)); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(nil, time.Minute)
+	go Sync(ctx, store, m)
+
+	eventually(t, func() bool {
+		_, ok := gcache.LookupGroup("sync-before")
+		return ok
+	}, "group defined before Sync not created")
+
+	if err := store.Put(ctx, scores("sync-after", 0)); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		_, ok := gcache.LookupGroup("sync-after")
+		return ok
+	}, "group defined after Sync not created")
+	g, _ := gcache.LookupGroup("sync-after")
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if _, err := g.(*gcache.Group[string, []byte]).Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 缩容传播到已有分组
+	if err := store.Put(ctx, scores("sync-after", 1)); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool { return g.Len() == 1 }, "group not resized")
+
+	if err := store.Delete(ctx, "sync-after"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		_, ok := gcache.LookupGroup("sync-after")
+		return !ok
+	}, "deleted group still registered")
+}
+
+func TestApply(t *testing.T) {
+	m := NewManager(nil, 0)
+	def := scores("apply", 0)
+	if err := m.Apply(def); err != nil {
+		t.Fatal(err)
+	}
+
+	def.Expires = 5
+	if err := m.Apply(def); err != nil {
+		t.Fatalf("changing expires should be applied live: %v", err)
+	}
+	def.Backend = conf.BackendConfig{Type: "memory"}
+	if err := m.Apply(def); err == nil {
+		t.Fatal("changing the backend of a running group should be reported")
+	}
+
+	// 代码中创建的同名分组不会被覆盖
+	if _, err := gcache.NewGroup[string, []byte]("apply-code", 0, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) { return nil, nil })); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Apply(scores("apply-code", 0)); !errors.Is(err, gcache.ErrGroupExists) {
+		t.Fatal("group created in code should not be replaced")
+	}
+	if err := m.Apply(conf.GroupConfig{Name: "bad", Backend: conf.BackendConfig{Type: "memory"}, Eviction: "lfu"}); err == nil {
+		t.Fatal("unsupported eviction should be rejected")
+	}
+}
+
+// closingGetter 记录是否被关闭
+type closingGetter struct {
+	gcache.GetterFunc[string, []byte]
+	closed bool
+}
+
+func (g *closingGetter) Close() error {
+	g.closed = true
+	return nil
+}
+
+func TestRemoveClosesBackend(t *testing.T) {
+	var getters []*closingGetter
+	backend.Register("closing", func(options map[string]string) (gcache.Getter[string, []byte], error) {
+		g := &closingGetter{GetterFunc: func(key string) ([]byte, error) { return nil, nil }}
+		getters = append(getters, g)
+		return g, nil
+	})
+	m := NewManager(nil, 0)
+	def := conf.GroupConfig{Name: "closing", Backend: conf.BackendConfig{Type: "closing"}}
+	if err := m.Apply(def); err != nil {
+		t.Fatal(err)
+	}
+	// 分组创建失败时关闭刚创建的后端
+	if _, err := gcache.NewGroup[string, []byte]("closing-code", 0, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) { return nil, nil })); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("closing-code") })
+	if err := m.Apply(conf.GroupConfig{Name: "closing-code", Backend: conf.BackendConfig{Type: "closing"}}); err == nil {
+		t.Fatal("group created in code should not be replaced")
+	}
+	if len(getters) != 2 || getters[0].closed || !getters[1].closed {
+		t.Fatalf("after a failed Apply: %d getters, closed %v", len(getters), getters)
+	}
+	m.Remove("closing")
+	if !getters[0].closed {
+		t.Fatal("backend of a removed group not closed")
+	}
+}
+
+func TestMemoryValidates(t *testing.T) {
+	store := NewMemory()
+	if err := store.Put(context.Background(), conf.GroupConfig{Name: "nobackend"}); err == nil {
+		t.Fatal("definition without backend should be rejected")
+	}
+	if defs, _ := store.List(context.Background()); len(defs) != 0 {
+		t.Fatalf("invalid definition stored: %v", defs)
+	}
+}
+
+func TestEtcdSync(t *testing.T) {
+	store, err := NewEtcd([]string{etcdtest.Start(t)}, 5*time.Second, "groups/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := store.Put(ctx, scores("etcd-before", 0)); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(nil, time.Minute)
+	go Sync(ctx, store, m)
+	eventually(t, func() bool {
+		_, ok := gcache.LookupGroup("etcd-before")
+		return ok
+	}, "group defined before Sync not created")
+
+	if err := store.Put(ctx, scores("etcd-after", 0)); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		_, ok := gcache.LookupGroup("etcd-after")
+		return ok
+	}, "group defined after Sync not created")
+	for _, name := range []string{"etcd-before", "etcd-after"} {
+		if err := store.Delete(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eventually(t, func() bool {
+		_, before := gcache.LookupGroup("etcd-before")
+		_, after := gcache.LookupGroup("etcd-after")
+		return !before && !after
+	}, "deleted groups still registered")
+}
@@ -0,0 +1,116 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kunCache/conf"
+	"kunCache/etcd"
+	"log/slog"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Etcd stores each definition as JSON under prefix+name.
+type Etcd struct {
+	cli    *clientv3.Client
+	prefix string
+}
+
+// NewEtcd connects to etcd. Definitions are stored under prefix.
+func NewEtcd(endpoints []string, dialTimeout time.Duration, prefix string) (*Etcd, error) {
+	cli, err := etcd.NewClient(endpoints, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("create etcd client: %w", err)
+	}
+	return &Etcd{cli: cli, prefix: prefix}, nil
+}
+
+// Put validates def and stores it.
+func (e *Etcd) Put(ctx context.Context, def conf.GroupConfig) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(def)
+	if err != nil {
+		return err
+	}
+	if _, err := e.cli.Put(ctx, e.prefix+def.Name, string(data)); err != nil {
+		return fmt.Errorf("put group %s: %w", def.Name, err)
+	}
+	return nil
+}
+
+func (e *Etcd) Delete(ctx context.Context, name string) error {
+	if _, err := e.cli.Delete(ctx, e.prefix+name); err != nil {
+		return fmt.Errorf("delete group %s: %w", name, err)
+	}
+	return nil
+}
+
+// List returns the definitions under the prefix, sorted by name.
+func (e *Etcd) List(ctx context.Context) ([]conf.GroupConfig, error) {
+	resp, err := e.cli.Get(ctx, e.prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, fmt.Errorf("get groups from etcd: %w", err)
+	}
+	var defs []conf.GroupConfig
+	for _, kv := range resp.Kvs {
+		var def conf.GroupConfig
+		if err := json.Unmarshal(kv.Value, &def); err != nil {
+			return nil, fmt.Errorf("bad group definition %s: %w", kv.Key, err)
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// Watch reports puts and deletes under the prefix. A broken watch resumes
+// where it stopped, see etcd.WatchPrefix.
+func (e *Etcd) Watch(ctx context.Context) (<-chan Event, error) {
+	changes, err := etcd.WatchPrefix(ctx, e.cli, e.prefix)
+	if err != nil {
+		return nil, fmt.Errorf("watch %s: %w", e.prefix, err)
+	}
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for ev := range changes {
+			event, ok := e.convert(ev)
+			if !ok {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+func (e *Etcd) convert(ev *clientv3.Event) (Event, bool) {
+	name := strings.TrimPrefix(string(ev.Kv.Key), e.prefix)
+	switch ev.Type {
+	case clientv3.EventTypeDelete:
+		return Event{Type: Delete, Group: conf.GroupConfig{Name: name}}, true
+	case clientv3.EventTypePut:
+		var def conf.GroupConfig
+		if err := json.Unmarshal(ev.Kv.Value, &def); err != nil {
+			slog.Error("[Catalog] bad group definition", "key", string(ev.Kv.Key), "err", err)
+			return Event{}, false
+		}
+		if def.Name == "" {
+			def.Name = name
+		}
+		return Event{Type: Put, Group: def}, true
+	}
+	return Event{}, false
+}
+
+func (e *Etcd) Close() error {
+	return e.cli.Close()
+}
@@ -0,0 +1,197 @@
+package catalog
+
+import (
+	"fmt"
+	"io"
+	"kunCache/admission"
+	"kunCache/backend"
+	"kunCache/conf"
+	"kunCache/gcache"
+	"kunCache/peer"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Manager creates and reconfigures the groups of this node from their
+// definitions. The groups have string keys and []byte values loaded by the
+// backend of their definition.
+type Manager struct {
+	picker peer.Picker[string, []byte]
+	// fillLock 不为 nil 时所有分组通过它加载
+	fillLock peer.FillLock
+
+	mu sync.Mutex
+	// expires 分组没有设置 expires 时使用的有效期
+	expires time.Duration
+	defs    map[string]conf.GroupConfig
+	// getters 分组的后端，分组删除时关闭实现了 io.Closer 的后端，例如 sql 连接池
+	getters map[string]gcache.Getter[string, []byte]
+}
+
+// NewManager creates a Manager registering its groups with picker. Groups
+// whose definition sets no expires keep entries for expires.
+func NewManager(picker peer.Picker[string, []byte], expires time.Duration) *Manager {
+	return &Manager{
+		picker:  picker,
+		expires: expires,
+		defs:    make(map[string]conf.GroupConfig),
+		getters: make(map[string]gcache.Getter[string, []byte]),
+	}
+}
+
+// SetFillLock makes the groups created from now on call their backend
+// only while holding l, see gcache.WithFillLock.
+func (m *Manager) SetFillLock(l peer.FillLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fillLock = l
+}
+
+// Apply creates the group def describes, or reconfigures it if the
+// Manager already created it. Only max_entries and expires can change on
+// a running group; other changes are reported as an error after those two
+// are applied, and take effect when the node restarts.
+func (m *Manager) Apply(def conf.GroupConfig) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.defs[def.Name]
+	if !ok {
+		getter, err := backend.New(def.Backend)
+		if err != nil {
+			return fmt.Errorf("group %s: %w", def.Name, err)
+		}
+		g, err := gcache.NewGroup[string, []byte](def.Name, def.MaxEntries, getter, m.options(def)...)
+		if err != nil {
+			closeGetter(getter)
+			return err
+		}
+		if m.picker != nil {
+			g.RegisterServer(m.picker)
+		}
+		m.defs[def.Name] = def
+		m.getters[def.Name] = getter
+		return nil
+	}
+
+	g, ok := gcache.LookupGroup(def.Name)
+	if !ok {
+		return fmt.Errorf("group %q is no longer registered", def.Name)
+	}
+	if def.MaxEntries != old.MaxEntries {
+		g.Resize(def.MaxEntries)
+	}
+	if m.expiration(def) != m.expiration(old) {
+		g.SetExpiration(m.expiration(def))
+	}
+	live := old
+	live.MaxEntries, live.Expires = def.MaxEntries, def.Expires
+	m.defs[def.Name] = live
+	if !reflect.DeepEqual(live, def) {
+		return fmt.Errorf("group %q: only max_entries and expires change on a running group, the rest needs a restart", def.Name)
+	}
+	return nil
+}
+
+// Remove deletes the named group if the Manager created it, and closes its
+// backend if it is an io.Closer.
+func (m *Manager) Remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.defs[name]; !ok {
+		return
+	}
+	delete(m.defs, name)
+	gcache.DeleteGroup(name)
+	closeGetter(m.getters[name])
+	delete(m.getters, name)
+}
+
+// closeGetter 关闭实现了 io.Closer 的后端
+func closeGetter(getter gcache.Getter[string, []byte]) {
+	if c, ok := getter.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// SetExpiration changes the lifetime of entries in groups whose definition
+// sets no expires.
+func (m *Manager) SetExpiration(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expires = d
+	for name, def := range m.defs {
+		if def.Expires > 0 {
+			continue
+		}
+		if g, ok := gcache.LookupGroup(name); ok {
+			g.SetExpiration(d)
+		}
+	}
+}
+
+func (m *Manager) expiration(def conf.GroupConfig) time.Duration {
+	if def.Expires > 0 {
+		return time.Duration(def.Expires) * time.Minute
+	}
+	return m.expires
+}
+
+// options 把分组定义转换为 gcache.Option
+func (m *Manager) options(def conf.GroupConfig) []gcache.Option {
+	opts := []gcache.Option{gcache.WithExpiration(m.expiration(def))}
+	if def.PeerTimeout > 0 {
+		opts = append(opts, gcache.WithPeerTimeout(time.Duration(def.PeerTimeout)*time.Millisecond))
+	}
+	if def.HedgeDelay > 0 {
+		delay := time.Duration(def.HedgeDelay) * time.Millisecond
+		if def.HedgeAdapt {
+			opts = append(opts, gcache.WithAdaptiveHedging(delay))
+		} else {
+			opts = append(opts, gcache.WithHedging(delay))
+		}
+	}
+	if def.HandoffDelay > 0 {
+		opts = append(opts, gcache.WithHandoff(time.Duration(def.HandoffDelay)*time.Millisecond))
+	}
+	if def.NegativeTTL > 0 {
+		opts = append(opts, gcache.WithNegativeCaching(time.Duration(def.NegativeTTL)*time.Second))
+	}
+	if def.StaleGrace > 0 {
+		opts = append(opts, gcache.WithStaleWhileRevalidate(time.Duration(def.StaleGrace)*time.Second))
+	}
+	if def.RefreshAhead > 0 {
+		opts = append(opts, gcache.WithRefreshAhead(float64(def.RefreshAhead)/100))
+	}
+	if def.MaxStale > 0 {
+		opts = append(opts, gcache.WithServeStaleOnError(time.Duration(def.MaxStale)*time.Second))
+	}
+	if m.fillLock != nil {
+		opts = append(opts, gcache.WithFillLock(m.fillLock))
+	}
+	if def.Retries > 0 {
+		backoff := 100 * time.Millisecond
+		if def.RetryBackoff > 0 {
+			backoff = time.Duration(def.RetryBackoff) * time.Millisecond
+		}
+		opts = append(opts, gcache.WithRetry(gcache.RetryPolicy{
+			Attempts:   def.Retries + 1,
+			Backoff:    backoff,
+			MaxBackoff: time.Duration(def.RetryMaxBackoff) * time.Millisecond,
+		}))
+	}
+	if def.MaxLoads > 0 {
+		opts = append(opts, gcache.WithMaxConcurrentLoads(def.MaxLoads))
+	}
+	if def.RateLimit > 0 {
+		opts = append(opts, gcache.WithRateLimit(def.RateLimit, def.RateBurst))
+	}
+	if def.Admission != nil {
+		opts = append(opts, gcache.WithAdmission(admission.FromConfig(def.Admission)))
+	}
+	return opts
+}
@@ -0,0 +1,70 @@
+package catalog
+
+import (
+	"context"
+	"kunCache/conf"
+	"kunCache/internal/hub"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultMemory is the process-wide store selected by the "memory"
+// group_store setting.
+var DefaultMemory = NewMemory()
+
+// Memory is an in-process Store, mainly for tests: several nodes in one
+// process share a Memory and see each other's definitions.
+type Memory struct {
+	mu   sync.Mutex
+	defs map[string]conf.GroupConfig
+	hub  hub.Hub[Event]
+}
+
+// NewMemory creates an empty store.
+func NewMemory() *Memory {
+	return &Memory{
+		defs: make(map[string]conf.GroupConfig),
+	}
+}
+
+func (m *Memory) Put(ctx context.Context, def conf.GroupConfig) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.defs[def.Name] = def
+	m.hub.Publish(Event{Type: Put, Group: def})
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.defs[name]; !ok {
+		return nil
+	}
+	delete(m.defs, name)
+	m.hub.Publish(Event{Type: Delete, Group: conf.GroupConfig{Name: name}})
+	return nil
+}
+
+func (m *Memory) List(ctx context.Context) ([]conf.GroupConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defs := make([]conf.GroupConfig, 0, len(m.defs))
+	for _, def := range m.defs {
+		defs = append(defs, def)
+	}
+	slices.SortFunc(defs, func(a, b conf.GroupConfig) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return defs, nil
+}
+
+func (m *Memory) Watch(ctx context.Context) (<-chan Event, error) {
+	return m.hub.Watch(ctx), nil
+}
+
+func (m *Memory) Close() error { return nil }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kunCache/admin"
+	"kunCache/auth"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// getAdmin 请求管理接口并把 JSON 结果解码到 v
+func getAdmin(ctx context.Context, o options, path string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+	u := strings.TrimSuffix(o.admin, "/") + admin.BasePath + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	guard, err := auth.FromConfig(o.conf.Auth)
+	if err != nil {
+		return err
+	}
+	if guard != nil {
+		token, err := guard.Authenticator.Token()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned: %v", u, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func printStats(ctx context.Context, o options) error {
+	var groups []admin.GroupView
+	if err := getAdmin(ctx, o, "groups", &groups); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "GROUP\tENTRIES\tGETS\tHITS\tSTALE HITS\tNEGATIVE HITS\tREFRESHES\tSTALE SERVES\tFILL FOLLOWS\tLOADS\tPEER LOADS\tPEER ERRORS\tLOCAL LOADS\tLOAD ERRORS\tRETRIES\tREJECTED\tSHED\t")
+	for _, g := range groups {
+		s := g.Stats
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			g.Name, g.Entries, s.Gets, s.CacheHits, s.StaleHits, s.NegativeHits, s.Refreshes, s.StaleServes, s.FillFollows, s.Loads, s.PeerLoads, s.PeerErrors, s.LocalLoads, s.LoadErrors, s.Retries, s.Rejected, s.Shed)
+	}
+	return w.Flush()
+}
+
+func printRing(ctx context.Context, o options) error {
+	var members []admin.RingMember
+	if err := getAdmin(ctx, o, "ring", &members); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDR\tVIRTUAL NODES\tSELF")
+	for _, m := range members {
+		fmt.Fprintf(w, "%s\t%d\t%v\n", m.Addr, m.VirtualNodes, m.Self)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// benchOptions 压测参数
+type benchOptions struct {
+	requests    int
+	concurrency int
+	keys        int
+	skew        float64 // Zipf 分布的 s 参数，越大热点越集中
+	prefix      string
+}
+
+// bench 按 Zipf 分布生成 key 并发请求集群，输出吞吐和延迟分位数
+func bench(ctx context.Context, o options, args []string) error {
+	var b benchOptions
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.IntVar(&b.requests, "n", 10000, "total requests")
+	fs.IntVar(&b.concurrency, "c", 16, "concurrent workers")
+	fs.IntVar(&b.keys, "keys", 1000, "number of distinct keys")
+	fs.Float64Var(&b.skew, "s", 1.1, "Zipf skew, must be > 1")
+	fs.StringVar(&b.prefix, "prefix", "key-", "key prefix, keys are <prefix><n>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if b.skew <= 1 || b.keys < 1 || b.concurrency < 1 {
+		return fmt.Errorf("bench: need -s > 1, -keys >= 1 and -c >= 1")
+	}
+
+	c, err := newCluster(ctx, o)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var (
+		next      atomic.Int64
+		errs      atomic.Int64
+		mu        sync.Mutex
+		latencies = make([]time.Duration, 0, b.requests)
+		wg        sync.WaitGroup
+	)
+	start := time.Now()
+	for w := 0; w < b.concurrency; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			zipf := rand.NewZipf(rand.New(rand.NewSource(seed)), b.skew, 1, uint64(b.keys-1))
+			local := make([]time.Duration, 0, b.requests/b.concurrency+1)
+			for next.Add(1) <= int64(b.requests) {
+				key := fmt.Sprintf("%s%d", b.prefix, zipf.Uint64())
+				t := time.Now()
+				if _, err := c.get(ctx, key); err != nil {
+					errs.Add(1)
+				}
+				local = append(local, time.Since(t))
+			}
+			mu.Lock()
+			latencies = append(latencies, local...)
+			mu.Unlock()
+		}(start.UnixNano() + int64(w))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	slices.Sort(latencies)
+	quantile := func(q float64) time.Duration {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return latencies[int(q*float64(len(latencies)-1))]
+	}
+	fmt.Printf("requests:   %d (%d errors)\n", len(latencies), errs.Load())
+	fmt.Printf("elapsed:    %v\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("throughput: %.0f req/s\n", float64(len(latencies))/elapsed.Seconds())
+	fmt.Printf("latency:    p50 %v  p90 %v  p99 %v  max %v\n",
+		quantile(0.5), quantile(0.9), quantile(0.99), quantile(1))
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"kunCache/consistentHash"
+	"kunCache/discovery"
+	grpcserver "kunCache/grpc"
+	httpserver "kunCache/http"
+	"kunCache/peer"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// cluster 是命令行看到的集群：从服务发现得到节点，按节点协议创建 Fetcher，
+// 并用与节点相同的一致性哈希找出 key 的所属节点
+type cluster struct {
+	o         options
+	discovery discovery.Discovery
+	peers     []*discovery.Service
+	ring      *consistentHash.Map[string]
+	fetchers  map[string]peer.Fetcher[string, []byte]
+}
+
+func newCluster(ctx context.Context, o options) (*cluster, error) {
+	factories := make(map[string]peer.FetcherFactory[string, []byte])
+	httpFactory, err := httpserver.NewFetcherFactory[string, []byte](o.conf)
+	if err != nil {
+		return nil, err
+	}
+	grpcFactory, err := grpcserver.NewFetcherFactory[string, []byte](o.conf)
+	if err != nil {
+		return nil, err
+	}
+	factories["HTTP"], factories["GRPC"] = httpFactory, grpcFactory
+
+	c := &cluster{
+		o:        o,
+		ring:     consistentHash.New[string](o.conf.Replicas, nil),
+		fetchers: make(map[string]peer.Fetcher[string, []byte]),
+	}
+	if o.addr != "" {
+		c.peers = []*discovery.Service{discovery.NewService(o.addr, strings.ToUpper(o.protocol))}
+	} else {
+		c.discovery, err = discovery.New(o.conf)
+		if err != nil {
+			return nil, fmt.Errorf("create discovery: %w", err)
+		}
+		lctx, cancel := context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+		if c.peers, err = c.discovery.List(lctx); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("list peers: %w", err)
+		}
+	}
+	slices.SortFunc(c.peers, func(a, b *discovery.Service) int {
+		return strings.Compare(a.Addr, b.Addr)
+	})
+
+	for _, s := range c.peers {
+		protocol := s.Protocol
+		if protocol == "" {
+			protocol = "HTTP"
+		}
+		factory, ok := factories[protocol]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "skip peer %s: unknown protocol %q\n", s.Addr, s.Protocol)
+			continue
+		}
+		c.ring.Add(s.Addr)
+		c.fetchers[s.Addr] = factory(s.Addr)
+	}
+	if len(c.fetchers) == 0 {
+		c.Close()
+		return nil, fmt.Errorf("no peers found")
+	}
+	return c, nil
+}
+
+// owner 返回负责 key 的节点地址及其 Fetcher
+func (c *cluster) owner(key string) (string, peer.Fetcher[string, []byte]) {
+	addr := c.ring.Get(key)
+	return addr, c.fetchers[addr]
+}
+
+func (c *cluster) get(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.o.timeout)
+	defer cancel()
+	addr, f := c.owner(key)
+	v, err := f.Fetch(ctx, c.o.group, key)
+	if err != nil {
+		return nil, fmt.Errorf("get from %s: %w", addr, err)
+	}
+	return v, nil
+}
+
+func (c *cluster) mutator(key string) (string, peer.Mutator[string, []byte], error) {
+	addr, f := c.owner(key)
+	m, ok := f.(peer.Mutator[string, []byte])
+	if !ok {
+		return addr, nil, fmt.Errorf("peer %s does not support set/delete", addr)
+	}
+	return addr, m, nil
+}
+
+func (c *cluster) run(ctx context.Context, cmd string, args []string) error {
+	key := args[0]
+	switch cmd {
+	case "get":
+		v, err := c.get(ctx, key)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(v))
+	case "set", "delete":
+		addr, m, err := c.mutator(key)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(ctx, c.o.timeout)
+		defer cancel()
+		if cmd == "set" {
+			err = m.Set(ctx, c.o.group, key, []byte(args[1]))
+		} else {
+			err = m.Delete(ctx, c.o.group, key)
+		}
+		if err != nil {
+			return fmt.Errorf("%s on %s: %w", cmd, addr, err)
+		}
+		fmt.Printf("%s %s on %s\n", cmd, key, addr)
+	case "owner":
+		addr, _ := c.owner(key)
+		fmt.Println(addr)
+	}
+	return nil
+}
+
+func (c *cluster) printPeers() error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDR\tPROTOCOL")
+	for _, s := range c.peers {
+		fmt.Fprintf(w, "%s\t%s\n", s.Addr, s.Protocol)
+	}
+	return w.Flush()
+}
+
+func (c *cluster) Close() {
+	for _, f := range c.fetchers {
+		if closer, ok := f.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+	if c.discovery != nil {
+		c.discovery.Close()
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kunCache/catalog"
+	"kunCache/conf"
+)
+
+// define 在分组存储中创建、修改或删除分组定义
+func define(ctx context.Context, o options, cmd, arg string) error {
+	store, err := catalog.New(o.conf)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		return fmt.Errorf("no group_store configured")
+	}
+	defer store.Close()
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	if cmd == "undefine" {
+		if err := store.Delete(ctx, arg); err != nil {
+			return err
+		}
+		fmt.Printf("undefined %s\n", arg)
+		return nil
+	}
+	var def conf.GroupConfig
+	if err := json.Unmarshal([]byte(arg), &def); err != nil {
+		return fmt.Errorf("bad group definition: %w", err)
+	}
+	if err := store.Put(ctx, def); err != nil {
+		return err
+	}
+	fmt.Printf("defined %s\n", def.Name)
+	return nil
+}
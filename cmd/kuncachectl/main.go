@@ -0,0 +1,131 @@
+// Command kuncachectl inspects and drives a kunCache cluster.
+//
+// It reads the same conf.json as the nodes, finds the peers through the
+// configured discovery and talks to each peer in the protocol it
+// registered (HTTP or GRPC), so keys are routed to their owner exactly as
+// the nodes route them.
+//
+//	kuncachectl [flags] get <key>
+//	kuncachectl [flags] set <key> <value>
+//	kuncachectl [flags] delete <key>
+//	kuncachectl [flags] stats
+//	kuncachectl [flags] ring
+//	kuncachectl [flags] owner <key>
+//	kuncachectl [flags] peers
+//	kuncachectl [flags] bench [bench flags]
+//	kuncachectl [flags] define <group definition JSON>
+//	kuncachectl [flags] undefine <group>
+//
+// set and delete only change the cache of the owner; they do not write to
+// the data source behind the group. define and undefine edit the group
+// definitions in the store named by group_store, which every node follows.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"kunCache/conf"
+	"os"
+	"time"
+)
+
+type options struct {
+	conf     *conf.Config
+	confPath string
+	group    string
+	addr     string // 不经过服务发现，直接访问的节点
+	protocol string // addr 使用的协议
+	admin    string // 管理接口地址
+	timeout  time.Duration
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: kuncachectl [flags] <command> [args]
+
+commands:
+  get <key>            read a key through its owner
+  set <key> <value>    store a value in the owner's cache
+  delete <key>         evict a key from the owner's cache
+  stats                group statistics from the admin API
+  ring                 ring members and virtual nodes from the admin API
+  owner <key>          peer owning a key
+  peers                peers registered in discovery
+  bench [flags]        load test with Zipf distributed keys
+  define <json>        create or update a group in the group store
+  undefine <group>     remove a group from the group store
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.confPath, "conf", "conf/conf.json", "config file shared with the nodes")
+	flag.StringVar(&o.group, "group", "scores", "cache group")
+	flag.StringVar(&o.addr, "addr", "", "talk to this node instead of the key owner")
+	flag.StringVar(&o.protocol, "protocol", "HTTP", "protocol of -addr: HTTP or GRPC")
+	flag.StringVar(&o.admin, "admin", "", "admin API base URL (default api_addr from the config)")
+	flag.DurationVar(&o.timeout, "timeout", 5*time.Second, "timeout of a single request")
+	var overrides conf.Overrides
+	flag.Var(&overrides, "set", "override a config setting, e.g. -set discovery=static (repeatable)")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	c, err := conf.Load(o.confPath, overrides...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kuncachectl:", err)
+		os.Exit(1)
+	}
+	o.conf = c
+	if o.admin == "" {
+		o.admin = c.ApiAddr
+	}
+	if err := run(o, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "kuncachectl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(o options, cmd string, args []string) error {
+	ctx := context.Background()
+	switch cmd {
+	case "get", "set", "delete", "owner":
+		want := map[string]int{"get": 1, "set": 2, "delete": 1, "owner": 1}[cmd]
+		if len(args) != want {
+			return fmt.Errorf("%s takes %d argument(s)", cmd, want)
+		}
+		c, err := newCluster(ctx, o)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return c.run(ctx, cmd, args)
+	case "peers":
+		c, err := newCluster(ctx, o)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return c.printPeers()
+	case "stats":
+		return printStats(ctx, o)
+	case "ring":
+		return printRing(ctx, o)
+	case "bench":
+		return bench(ctx, o, args)
+	case "define", "undefine":
+		if len(args) != 1 {
+			return fmt.Errorf("%s takes 1 argument", cmd)
+		}
+		return define(ctx, o, cmd, args[0])
+	default:
+		usage()
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
@@ -0,0 +1,354 @@
+// Command kuncached runs a kunCache node.
+//
+// It serves the groups defined in the config over HTTP or gRPC, joins the
+// cluster through the configured discovery and, unless disabled, serves
+// the client API and the admin API on a separate address:
+//
+//	GET /api?group=<group>&key=<key>
+//	/_admin/...   see package admin
+//
+// Every flag can also be set with the environment variable shown in its
+// usage. SIGINT and SIGTERM deregister the node and drain in-flight
+// requests before exiting.
+//
+// Changes to replicas, expires and the max_entries and expires of a group
+// in the config file are applied without a restart; other changes are
+// logged and wait for the next restart. With group_store set, the node
+// also serves the groups defined in that store and follows their changes.
+// With fill_lock set, the nodes take turns loading a key from the backend.
+// The "sql" backend connects to the MySQL DSN of the dns setting unless a
+// group sets its own; mysql is the only database/sql driver linked in.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"kunCache/admin"
+	"kunCache/auth"
+	"kunCache/backend"
+	"kunCache/catalog"
+	"kunCache/conf"
+	"kunCache/filllock"
+	"kunCache/gcache"
+	grpcserver "kunCache/grpc"
+	httpserver "kunCache/http"
+	sqlloader "kunCache/loader/sql"
+	"kunCache/peer"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql" // sql 后端默认的 mysql 驱动
+	_ "kunCache/discovery/gossip"      // 注册 gossip 发现模式
+)
+
+type options struct {
+	conf            *conf.Config
+	overrides       conf.Overrides
+	confPath        string
+	bind            string
+	advertise       string
+	gossipAdvertise string
+	protocol        string
+	api             string
+	shutdownTimeout time.Duration
+	reloadInterval  time.Duration
+}
+
+// env 返回环境变量 name 的值，未设置时返回 def
+func env(name, def string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return def
+}
+
+func parseFlags() options {
+	var o options
+	flag.StringVar(&o.confPath, "conf", env("KUNCACHE_CONF", "conf/conf.json"), "config file ($KUNCACHE_CONF)")
+	flag.StringVar(&o.bind, "bind", env("KUNCACHE_BIND", "0.0.0.0:8001"), "address the cache protocol listens on ($KUNCACHE_BIND)")
+	flag.StringVar(&o.advertise, "advertise", env("KUNCACHE_ADVERTISE", ""), "address registered for peers to reach this node, default the bind address or <hostname>:<port> ($KUNCACHE_ADVERTISE)")
+	flag.StringVar(&o.gossipAdvertise, "gossip-advertise", "", "gossip address other nodes reach this node at, required when gossip_addr listens on all interfaces; same as -set gossip_advertise=<addr>")
+	flag.StringVar(&o.protocol, "protocol", env("KUNCACHE_PROTOCOL", "HTTP"), "peer protocol: HTTP or GRPC ($KUNCACHE_PROTOCOL)")
+	flag.StringVar(&o.api, "api", env("KUNCACHE_API", ""), "address of the client and admin API, default the host of api_addr in the config, \"off\" to disable ($KUNCACHE_API)")
+	flag.DurationVar(&o.shutdownTimeout, "shutdown-timeout", 10*time.Second, "how long to drain requests on shutdown")
+	flag.DurationVar(&o.reloadInterval, "reload-interval", 5*time.Second, "how often to check the config file for changes, 0 to disable")
+	flag.Var(&o.overrides, "set", "override a config setting, e.g. -set replicas=100 (repeatable); the file can also be overridden with "+conf.EnvPrefix+"<SETTING>")
+	flag.Parse()
+	if o.gossipAdvertise != "" {
+		o.overrides = append(o.overrides, conf.Override{Key: "gossip_advertise", Value: o.gossipAdvertise})
+	}
+	o.protocol = strings.ToUpper(o.protocol)
+	return o
+}
+
+// advertiseAddr 计算注册到服务发现的地址：未指定时使用监听地址，
+// 监听所有网卡时使用主机名
+func advertiseAddr(o options) (string, error) {
+	if o.advertise != "" {
+		return o.advertise, nil
+	}
+	host, port, err := net.SplitHostPort(o.bind)
+	if err != nil {
+		return "", fmt.Errorf("bad bind address %q: %w", o.bind, err)
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return o.bind, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("bind address %q has no host and hostname is unknown: %w", o.bind, err)
+	}
+	return net.JoinHostPort(hostname, port), nil
+}
+
+// apiAddr 计算 API 监听地址，api_addr 可以带协议前缀如 "http://localhost:9999"
+func apiAddr(o options) (string, error) {
+	if o.api != "" {
+		if o.api == "off" {
+			return "", nil
+		}
+		return o.api, nil
+	}
+	if o.conf.ApiAddr == "" {
+		return "", nil
+	}
+	if !strings.Contains(o.conf.ApiAddr, "://") {
+		return o.conf.ApiAddr, nil
+	}
+	u, err := url.Parse(o.conf.ApiAddr)
+	if err != nil {
+		return "", fmt.Errorf("bad api_addr %q: %w", o.conf.ApiAddr, err)
+	}
+	return u.Host, nil
+}
+
+// node 是 HTTPPool 和 grpc Server 的公共部分
+type node interface {
+	peer.Picker[string, []byte]
+	admin.Cluster[string, []byte]
+	RegisterFetcher(protocol string, factory peer.FetcherFactory[string, []byte])
+	SetReplicas(replicas int)
+	Start() error
+}
+
+// newNode 创建本节点的缓存服务，并支持访问另一种协议的节点；返回的 stop 优雅停止服务
+func newNode(o options, addr string) (node, func(ctx context.Context) error, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad advertise address %q: %w", addr, err)
+	}
+	switch o.protocol {
+	case "HTTP":
+		p, err := httpserver.NewHTTPPool[string, []byte](o.conf, addr, host, port, "HTTP")
+		if err != nil {
+			return nil, nil, err
+		}
+		p.SetListenAddr(o.bind)
+		grpcFetcher, err := grpcserver.NewFetcherFactory[string, []byte](o.conf)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.RegisterFetcher("GRPC", grpcFetcher)
+		return p, p.Stop, nil
+	case "GRPC":
+		s, err := grpcserver.NewServer[string, []byte](o.conf, addr, host, port, "GRPC")
+		if err != nil {
+			return nil, nil, err
+		}
+		s.ListenAddr = o.bind
+		httpFetcher, err := httpserver.NewFetcherFactory[string, []byte](o.conf)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.RegisterFetcher("HTTP", httpFetcher)
+		return s, s.Shutdown, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown protocol %q", o.protocol)
+	}
+}
+
+// newGroups 按配置创建缓存分组并注册到 picker，配置了分组存储时同步集群共享的分组定义
+func newGroups(ctx context.Context, cfg *conf.Config, picker peer.Picker[string, []byte]) (*catalog.Manager, error) {
+	store, err := catalog.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Groups) == 0 && store == nil {
+		return nil, errors.New("no groups configured")
+	}
+	// sql 后端默认使用配置中的 DSN
+	backend.Register("sql", sqlloader.Backend(cfg.DNS))
+	m := catalog.NewManager(picker, time.Duration(cfg.Expires)*time.Minute)
+	lock, err := filllock.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if lock != nil {
+		m.SetFillLock(lock)
+		if c, ok := lock.(io.Closer); ok {
+			context.AfterFunc(ctx, func() { c.Close() })
+		}
+	}
+	for _, c := range cfg.Groups {
+		if err := m.Apply(c); err != nil {
+			return nil, err
+		}
+		slog.Info("[kuncached] serving group", "group", c.Name, "backend", c.Backend.Type)
+	}
+	if store != nil {
+		go func() {
+			defer store.Close()
+			if err := catalog.Sync(ctx, store, m); err != nil && ctx.Err() == nil {
+				slog.Error("[kuncached] group store sync stopped", "err", err)
+			}
+		}()
+	}
+	return m, nil
+}
+
+// newAPIHandler 客户端 API 和管理接口
+func newAPIHandler(cluster admin.Cluster[string, []byte], guard *auth.Guard) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api", func(w http.ResponseWriter, r *http.Request) {
+		groupName, key := r.URL.Query().Get("group"), r.URL.Query().Get("key")
+		if groupName == "" || key == "" {
+			http.Error(w, "group and key are required", http.StatusBadRequest)
+			return
+		}
+		if guard != nil {
+			if _, err := guard.Check(auth.BearerToken(r.Header.Get("Authorization")), groupName, auth.Read); err != nil {
+				status := http.StatusUnauthorized
+				if errors.Is(err, auth.ErrPermissionDenied) {
+					status = http.StatusForbidden
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+		}
+		g, err := gcache.GetGroup[string, []byte](groupName)
+		if err != nil {
+			httpserver.WriteError(w, err)
+			return
+		}
+		done, err := g.Admit(r.Context())
+		if err != nil {
+			httpserver.WriteError(w, err)
+			return
+		}
+		view, staleness, err := g.GetWithStaleness(key)
+		done(err)
+		if err != nil {
+			httpserver.WriteError(w, err)
+			return
+		}
+		if staleness > 0 {
+			// 返回的是过期的旧值
+			w.Header().Set("X-Kuncache-Staleness", staleness.String())
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(view)
+	})
+	mux.Handle(admin.BasePath, admin.New[string, []byte](cluster, guard))
+	return mux
+}
+
+func main() {
+	o := parseFlags()
+	c, err := conf.Load(o.confPath, o.overrides...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	o.conf = c
+
+	addr, err := advertiseAddr(o)
+	if err != nil {
+		log.Fatal(err)
+	}
+	n, stop, err := newNode(o, addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	guard, err := auth.FromConfig(o.conf.Auth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	groups, err := newGroups(ctx, o.conf, n)
+	if err != nil {
+		log.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	nodeDone := make(chan error, 1)
+
+	var api *http.Server
+	listen, err := apiAddr(o)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if listen != "" {
+		api = &http.Server{Addr: listen, Handler: newAPIHandler(n, guard)}
+		go func() {
+			slog.Info("[kuncached] api is running", "addr", listen)
+			if err := api.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("api server: %w", err)
+			}
+		}()
+	}
+	watchConfig(ctx, o, n, groups)
+	go func() {
+		slog.Info("[kuncached] node is running", "protocol", o.protocol, "bind", o.bind, "advertise", addr)
+		nodeDone <- n.Start()
+	}()
+
+	select {
+	case <-ctx.Done():
+		slog.Info("[kuncached] shutting down")
+	case err := <-errs:
+		slog.Error("[kuncached] server failed", "err", err)
+	case err := <-nodeDone:
+		// 节点已经退出，只需关闭 API
+		if err != nil {
+			slog.Error("[kuncached] node failed", "err", err)
+		}
+		nodeDone <- nil
+	}
+
+	shutdownCtx, done := context.WithTimeout(context.Background(), o.shutdownTimeout)
+	defer done()
+	// 先退出服务发现，释放 etcd 租约、通知 gossip 成员，其他节点不再转发请求过来，再排空正在处理的请求
+	if d := n.Discovery(); d != nil {
+		if err := d.Deregister(shutdownCtx, n.Service()); err != nil {
+			slog.Error("[kuncached] deregister", "err", err)
+		}
+		if err := d.Close(); err != nil {
+			slog.Error("[kuncached] close discovery", "err", err)
+		}
+	}
+	if api != nil {
+		if err := api.Shutdown(shutdownCtx); err != nil {
+			slog.Error("[kuncached] api shutdown", "err", err)
+		}
+	}
+	if err := stop(shutdownCtx); err != nil {
+		slog.Error("[kuncached] node shutdown", "err", err)
+	}
+	// 等待 Start 返回
+	select {
+	case <-nodeDone:
+	case <-shutdownCtx.Done():
+		slog.Error("[kuncached] node did not stop in time")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"kunCache/catalog"
+	"kunCache/conf"
+	"log/slog"
+	"time"
+)
+
+// reloader 把配置文件的变化应用到运行中的节点，需要重启才能生效的修改只记录日志
+type reloader struct {
+	cur    *conf.Config
+	node   node
+	groups *catalog.Manager
+}
+
+// watchConfig 每隔 o.reloadInterval 检查一次配置文件
+func watchConfig(ctx context.Context, o options, n node, groups *catalog.Manager) {
+	if o.reloadInterval <= 0 {
+		return
+	}
+	r := &reloader{cur: o.conf, node: n, groups: groups}
+	conf.Watch(ctx, o.confPath, o.reloadInterval, func(next *conf.Config, err error) {
+		if err != nil {
+			slog.Error("[kuncached] config reload rejected", "path", o.confPath, "err", err)
+			return
+		}
+		r.apply(next)
+	}, o.overrides...)
+}
+
+func (r *reloader) apply(next *conf.Config) {
+	applied, rejected := conf.Reload(r.cur, next)
+	for _, reason := range rejected {
+		slog.Warn("[kuncached] config change ignored", "reason", reason)
+	}
+	if applied.Replicas != r.cur.Replicas {
+		r.node.SetReplicas(applied.Replicas)
+		slog.Info("[kuncached] ring rebuilt", "replicas", applied.Replicas)
+	}
+	if applied.Expires != r.cur.Expires {
+		r.groups.SetExpiration(time.Duration(applied.Expires) * time.Minute)
+		slog.Info("[kuncached] expiration changed", "minutes", applied.Expires)
+	}
+	for _, c := range applied.Groups {
+		if err := r.groups.Apply(c); err != nil {
+			slog.Error("[kuncached] group reload", "group", c.Name, "err", err)
+		}
+	}
+	r.cur = applied
+}
@@ -1,17 +1,10 @@
 package conf
 
-import (
-	"encoding/json"
-	"fmt"
-	"log"
-	"os"
-)
-
-// 全局配置
-type GlobalConfig struct {
+// Config 节点配置，由 Load 读取
+type Config struct {
 	ApiAddr      string   `json:"api_addr,omitempty"`
 	Prefix       string   `json:"prefix,omitempty"`
-	DNS          string   `json:"dns,omitempty"`
+	DNS          string   `json:"dns,omitempty"` // 数据库 DSN，sql 后端默认使用
 	Replicas     int      `json:"replicas,omitempty"`
 	HttpBasePath string   `json:"http_base_path,omitempty"`
 	MaxBytes     int      `json:"max_bytes,omitempty"`
@@ -19,20 +12,98 @@ type GlobalConfig struct {
 	DialTimeout  int      `json:"dial_timeout,omitempty"`
 	LeaseTTL     int      `json:"lease_ttl,omitempty"`
 	Expires      int      `json:"expires,omitempty"`
+	// 节点健康检查与熔断
+	FailureThreshold int `json:"failure_threshold,omitempty"` // 连续失败多少次熔断
+	OpenTimeout      int `json:"open_timeout,omitempty"`      // 熔断持续秒数
+	SlowThreshold    int `json:"slow_threshold,omitempty"`    // 慢请求毫秒数，0 不统计
+	ProbeInterval    int `json:"probe_interval,omitempty"`    // 主动探测间隔秒数
+	// 节点间通信的 TLS 配置，为空使用明文
+	TLS *TLSConfig `json:"tls,omitempty"`
+	// 节点与 API 的鉴权配置，为空不鉴权
+	Auth *AuthConfig `json:"auth,omitempty"`
+	// 节点同时处理的请求数限制，为空不限制
+	Admission *AdmissionConfig `json:"admission,omitempty"`
+	// 服务发现方式："etcd"(默认) / "static" / "dns" / "memory"
+	Discovery   string       `json:"discovery,omitempty"`
+	Peers       []PeerConfig `json:"peers,omitempty"`        // static 模式下的节点列表
+	SRVName     string       `json:"srv_name,omitempty"`     // dns 模式下查询的 SRV 记录，如 "_kuncache._tcp.example.com"
+	SRVProtocol string       `json:"srv_protocol,omitempty"` // dns 模式下节点使用的协议，默认 "HTTP"
+	SRVInterval int          `json:"srv_interval,omitempty"` // dns 模式下重新查询的间隔秒数
+	// gossip 模式下的成员协议配置
+	GossipAddr             string   `json:"gossip_addr,omitempty"`              // 本节点 UDP 监听地址
+	GossipAdvertise        string   `json:"gossip_advertise,omitempty"`         // 其他节点访问本节点的 gossip 地址，默认为监听地址
+	GossipSeeds            []string `json:"gossip_seeds,omitempty"`             // 加入集群时联系的节点
+	GossipProbeInterval    int      `json:"gossip_probe_interval,omitempty"`    // 探测周期毫秒数
+	GossipSuspicionTimeout int      `json:"gossip_suspicion_timeout,omitempty"` // 怀疑状态持续多少毫秒后判定下线
+	// kuncached 提供的缓存分组
+	Groups []GroupConfig `json:"groups,omitempty"`
+	// 集群共享的动态分组定义："etcd" / "memory"，为空只使用 groups
+	GroupStore  string `json:"group_store,omitempty"`
+	GroupPrefix string `json:"group_prefix,omitempty"` // etcd 中分组定义的 key 前缀
+	// 集群范围的填充锁："etcd" / "memory"，为空时各节点独立加载
+	FillLock       string `json:"fill_lock,omitempty"`
+	FillLockPrefix string `json:"fill_lock_prefix,omitempty"` // etcd 中填充锁的 key 前缀
+	FillLockTTL    int    `json:"fill_lock_ttl,omitempty"`    // 锁租约和共享结果的保留秒数
+}
+
+// GroupConfig 缓存分组配置
+type GroupConfig struct {
+	Name         string        `json:"name"`
+	MaxEntries   int64         `json:"max_entries,omitempty"`    // 最大缓存条目数，0 不限制
+	Expires      int           `json:"expires,omitempty"`        // 缓存条目有效分钟数，0 使用全局 expires
+	Eviction     string        `json:"eviction,omitempty"`       // 淘汰策略，目前只有 "lru"(默认)
+	NegativeTTL  int           `json:"negative_ttl,omitempty"`   // 不存在的 key 缓存秒数，0 不缓存
+	StaleGrace   int           `json:"stale_grace,omitempty"`    // 过期后仍返回旧值并后台刷新的秒数，0 不返回旧值
+	RefreshAhead int           `json:"refresh_ahead,omitempty"`  // 剩余有效期低于该百分比时读取会提前刷新，0 不提前刷新
+	MaxStale     int           `json:"max_stale,omitempty"`      // 加载失败时可以返回过期多少秒以内的旧值，0 不返回
+	Backend      BackendConfig `json:"backend"`                  // 未命中时加载数据的后端
+	PeerTimeout  int           `json:"peer_timeout,omitempty"`   // 请求远端节点的超时毫秒数
+	HedgeDelay   int           `json:"hedge_delay,omitempty"`    // 对冲延迟毫秒数，0 不对冲
+	HedgeAdapt   bool          `json:"hedge_adaptive,omitempty"` // 使用观测到的 p95 延迟作为对冲延迟
+	HandoffDelay int           `json:"handoff_delay,omitempty"`  // 哈希环变化后迁移缓存的延迟毫秒数，0 不迁移
+	// 后端加载策略
+	Retries         int     `json:"retries,omitempty"`           // 加载失败后的重试次数
+	RetryBackoff    int     `json:"retry_backoff,omitempty"`     // 第一次重试前的最长等待毫秒数，之后每次翻倍，默认 100
+	RetryMaxBackoff int     `json:"retry_max_backoff,omitempty"` // 重试等待的上限毫秒数，0 不限制
+	MaxLoads        int     `json:"max_loads,omitempty"`         // 同时执行的加载数上限，0 不限制
+	RateLimit       float64 `json:"rate_limit,omitempty"`        // 每秒允许的加载数，超出时返回 overloaded，0 不限速
+	RateBurst       int     `json:"rate_burst,omitempty"`        // 限速时允许的突发加载数，默认 1
+	// 分组同时处理的请求数限制，为空不限制
+	Admission *AdmissionConfig `json:"admission,omitempty"`
+}
+
+// BackendConfig 数据后端配置，Options 的含义由 Type 决定
+type BackendConfig struct {
+	Type    string            `json:"type"`
+	Options map[string]string `json:"options,omitempty"`
 }
 
-// 全局配置变量
-var GConfig *GlobalConfig
+// PeerConfig 静态配置的节点
+type PeerConfig struct {
+	Addr     string `json:"addr"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// AdmissionConfig 并发请求数限制，超出上限的请求排队，队列满或等待超时后被拒绝
+type AdmissionConfig struct {
+	MaxInFlight   int `json:"max_in_flight"`            // 同时处理的请求数上限
+	MaxQueue      int `json:"max_queue,omitempty"`      // 最多排队的请求数，0 超出上限直接拒绝
+	QueueTimeout  int `json:"queue_timeout,omitempty"`  // 排队的最长毫秒数，0 只受请求自身的截止时间限制
+	TargetLatency int `json:"target_latency,omitempty"` // 自适应上限：请求超过该毫秒数时减小上限，0 上限固定
+	MinInFlight   int `json:"min_in_flight,omitempty"`  // 自适应上限的最小值，默认 1
+}
+
+// AuthConfig 鉴权配置
+type AuthConfig struct {
+	Mode     string             `json:"mode,omitempty"`      // "hmac"(默认) 或 "jwt"
+	Secret   string             `json:"secret,omitempty"`    // 共享密钥
+	Subject  string             `json:"subject,omitempty"`   // 本节点访问其他节点时使用的身份
+	TokenTTL int                `json:"token_ttl,omitempty"` // 签发 token 的有效秒数
+	ACL      map[string]ACLRule `json:"acl,omitempty"`       // 分组 -> 读写权限，"*" 匹配任意分组/身份
+}
 
-func Init(path string) {
-	GConfig = &GlobalConfig{}
-	data, err := os.ReadFile(path)
-	if err != nil {
-		log.Fatal("ReadFile", "err", err)
-	}
-	err = json.Unmarshal(data, GConfig)
-	if err != nil {
-		log.Fatal("Unmarshal", "err", err)
-	}
-	fmt.Println(GConfig)
+// ACLRule 分组的读写权限
+type ACLRule struct {
+	Read  []string `json:"read,omitempty"`
+	Write []string `json:"write,omitempty"`
 }
@@ -1,10 +1,227 @@
 package conf
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestInit(t *testing.T) {
-	Init("./conf.json")
-	//fmt.Printf("%v", GConfig)
+func TestLoad(t *testing.T) {
+	c, err := Load("./conf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Replicas != 50 || len(c.Endpoints) != 3 || len(c.Groups) != 1 || c.Groups[0].Backend.Type != "memory" {
+		t.Fatalf("unexpected config %+v", c)
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	files := map[string]string{
+		"conf.yaml": `
+discovery: static
+peers:
+  - addr: 127.0.0.1:8001
+    protocol: GRPC
+tls:
+  ca_file: ca.pem
+groups:
+  - name: scores
+    backend: {type: memory, options: {Tom: "630"}}
+`,
+		"conf.toml": `
+discovery = "static"
+
+[[peers]]
+addr = "127.0.0.1:8001"
+protocol = "GRPC"
+
+[tls]
+ca_file = "ca.pem"
+
+[[groups]]
+name = "scores"
+backend = { type = "memory", options = { Tom = "630" } }
+`,
+	}
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		c, err := Load(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if c.Peers[0].Protocol != "GRPC" || c.TLS.CAFile != "ca.pem" || c.Groups[0].Backend.Options["Tom"] != "630" {
+			t.Fatalf("%s: unexpected config %+v", name, c)
+		}
+		// 文件没有设置的项使用默认值
+		if c.Replicas != 50 || c.HttpBasePath != "/cache/" {
+			t.Fatalf("%s: defaults not applied: %+v", name, c)
+		}
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	t.Setenv("KUNCACHE_REPLICAS", "100")
+	t.Setenv("KUNCACHE_TLS_CERT_FILE", "node.pem")
+	t.Setenv("KUNCACHE_TLS_KEY_FILE", "node.key")
+	t.Setenv("KUNCACHE_BIND", "0.0.0.0:8001")
+
+	c, err := Load("./conf.json",
+		Override{Key: "replicas", Value: "200"},
+		Override{Key: "endpoints", Value: "a:2379, b:2379"},
+		Override{Key: "auth.secret", Value: "s3cret"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 命令行覆盖环境变量
+	if c.Replicas != 200 {
+		t.Fatalf("replicas = %d, want 200", c.Replicas)
+	}
+	if c.TLS == nil || c.TLS.CertFile != "node.pem" || c.TLS.KeyFile != "node.key" {
+		t.Fatalf("tls = %+v", c.TLS)
+	}
+	if strings.Join(c.Endpoints, " ") != "a:2379 b:2379" {
+		t.Fatalf("endpoints = %v", c.Endpoints)
+	}
+	if c.Auth == nil || c.Auth.Secret != "s3cret" {
+		t.Fatalf("auth = %+v", c.Auth)
+	}
+
+	if _, err := Load("./conf.json", Override{Key: "no_such_setting", Value: "1"}); err == nil {
+		t.Fatal("unknown setting should fail")
+	}
+	if _, err := Load("./conf.json", Override{Key: "replicas", Value: "many"}); err == nil {
+		t.Fatal("invalid number should fail")
+	}
+}
+
+func TestOverridesFlag(t *testing.T) {
+	var o Overrides
+	if err := o.Set("tls.ca_file=ca.pem"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Set("replicas"); err == nil {
+		t.Fatal("override without value should fail")
+	}
+	if len(o) != 1 || o[0] != (Override{Key: "tls.ca_file", Value: "ca.pem"}) {
+		t.Fatalf("overrides = %v", o)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.Replicas = 0
+	c.HttpBasePath = "cache"
+	c.Auth = &AuthConfig{Mode: "basic"}
+	c.Groups = []GroupConfig{{Name: "scores"}, {Name: "scores", Backend: BackendConfig{Type: "memory"}}}
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("invalid config passed validation")
+	}
+	for _, want := range []string{"replicas", "http_base_path", "endpoints", "auth.secret", "auth.mode", "backend type", "defined twice"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	cur, err := Load("./conf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, _ := Load("./conf.json")
+	next.Replicas = 100
+	next.Expires = 5
+	next.Groups[0].MaxEntries = 10
+
+	applied, rejected := Reload(cur, next)
+	if len(rejected) != 0 {
+		t.Fatalf("safe changes rejected: %v", rejected)
+	}
+	if applied.Replicas != 100 || applied.Expires != 5 || applied.Groups[0].MaxEntries != 10 {
+		t.Fatalf("applied = %+v", applied)
+	}
+	if cur.Groups[0].MaxEntries != 2048 {
+		t.Fatal("Reload modified the current config")
+	}
+
+	next.Endpoints = []string{"10.0.0.1:2379"}
+	next.Groups[0].PeerTimeout = 100
+	next.Groups = append(next.Groups, GroupConfig{Name: "users", Backend: BackendConfig{Type: "memory"}})
+	applied, rejected = Reload(cur, next)
+	if len(rejected) != 3 {
+		t.Fatalf("rejected = %v", rejected)
+	}
+	for i, want := range []string{"endpoints", `group "scores"`, `group "users" cannot be added`} {
+		if !strings.Contains(rejected[i], want) {
+			t.Errorf("rejected[%d] = %q, want it to mention %s", i, rejected[i], want)
+		}
+	}
+	// 不安全的修改被忽略，安全的仍然生效
+	if len(applied.Endpoints) != 3 || len(applied.Groups) != 1 || applied.Groups[0].PeerTimeout != 500 || applied.Replicas != 100 {
+		t.Fatalf("applied = %+v", applied)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.yaml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("discovery: memory\nreplicas: 10\n")
+
+	type result struct {
+		c   *Config
+		err error
+	}
+	changes := make(chan result, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	Watch(ctx, path, 10*time.Millisecond, func(c *Config, err error) {
+		changes <- result{c, err}
+	}, Override{Key: "expires", Value: "7"})
+
+	write("discovery: memory\nreplicas: 20\n")
+	r := <-changes
+	if r.err != nil || r.c.Replicas != 20 || r.c.Expires != 7 {
+		t.Fatalf("change = %+v, %v", r.c, r.err)
+	}
+	write("discovery: memory\nreplicas: 0\n")
+	if r := <-changes; r.err == nil {
+		t.Fatal("invalid config should be reported")
+	}
+}
+
+func TestValidateGossipAdvertise(t *testing.T) {
+	for _, tc := range []struct {
+		addr, advertise string
+		ok              bool
+	}{
+		{"0.0.0.0:7946", "", false},
+		{"127.0.0.1:7946", "", false},
+		{"0.0.0.0:7946", "localhost:7946", false},
+		{"0.0.0.0:7946", "10.0.0.1:7946", true},
+		{":7946", "node-1:7946", true},
+		{"10.0.0.1:7946", "", true},
+	} {
+		c := Default()
+		c.Discovery = "gossip"
+		c.GossipAddr = tc.addr
+		c.GossipAdvertise = tc.advertise
+		c.GossipSeeds = []string{"10.0.0.2:7946"}
+		if err := c.Validate(); (err == nil) != tc.ok {
+			t.Errorf("addr %q advertise %q: err = %v", tc.addr, tc.advertise, err)
+		}
+	}
 }
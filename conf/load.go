@@ -0,0 +1,358 @@
+package conf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables overriding the config file:
+// KUNCACHE_REPLICAS overrides "replicas" and KUNCACHE_TLS_CERT_FILE
+// overrides "tls.cert_file".
+const EnvPrefix = "KUNCACHE_"
+
+// Default returns the config used for every setting the file leaves out.
+func Default() *Config {
+	return &Config{
+		Prefix:           "clusters/",
+		Replicas:         50,
+		HttpBasePath:     "/cache/",
+		DialTimeout:      5,
+		LeaseTTL:         5,
+		Expires:          30,
+		FailureThreshold: 5,
+		OpenTimeout:      10,
+		ProbeInterval:    5,
+		Discovery:        "etcd",
+		GroupPrefix:      "groups/",
+		FillLockPrefix:   "fills/",
+		FillLockTTL:      10,
+	}
+}
+
+// Load reads the config file at path on top of Default, then applies the
+// environment variables and the overrides, in that order, and validates
+// the result. The format follows the file extension: .json, .yaml, .yml
+// or .toml.
+func Load(path string, overrides ...Override) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := Default()
+	if err := decode(filepath.Ext(path), data, c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := c.applyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	for _, o := range overrides {
+		if err := c.Set(o.Key, o.Value); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// decode 按扩展名解析配置；YAML 和 TOML 先转成 JSON，字段名统一使用 json tag
+func decode(ext string, data []byte, c *Config) error {
+	var raw map[string]any
+	switch strings.ToLower(ext) {
+	case ".json", "":
+		return json.Unmarshal(data, c)
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported config format %q", ext)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, c)
+}
+
+// Validate reports every setting that cannot work.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(c.Replicas > 0, "replicas must be > 0")
+	check(strings.HasPrefix(c.HttpBasePath, "/") && strings.HasSuffix(c.HttpBasePath, "/"),
+		"http_base_path %q must start and end with /", c.HttpBasePath)
+	check(c.Expires >= 0, "expires must be >= 0")
+	switch c.Discovery {
+	case "etcd":
+		check(len(c.Endpoints) > 0, "endpoints are required by etcd discovery")
+		check(c.LeaseTTL > 0, "lease_ttl must be > 0 with etcd discovery")
+	case "static":
+		check(len(c.Peers) > 0, "peers are required by static discovery")
+	case "dns":
+		check(c.SRVName != "", "srv_name is required by dns discovery")
+	case "gossip":
+		// 节点以这个地址作为身份，其他节点必须能访问到
+		if len(c.GossipSeeds) > 0 {
+			addr := c.GossipAdvertise
+			if addr == "" {
+				addr = c.GossipAddr
+			}
+			host, _, _ := net.SplitHostPort(addr)
+			ip := net.ParseIP(host)
+			check(host != "" && host != "localhost" && (ip == nil || !ip.IsUnspecified() && !ip.IsLoopback()),
+				"gossip_advertise must be an address other nodes can reach, not %q", addr)
+		}
+	}
+	if c.TLS != nil {
+		check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file go together")
+		check(!c.TLS.ClientAuth || c.TLS.CAFile != "", "tls.client_auth needs tls.ca_file")
+	}
+	if c.Auth != nil {
+		check(c.Auth.Secret != "", "auth.secret is required")
+		check(c.Auth.Mode == "" || c.Auth.Mode == "hmac" || c.Auth.Mode == "jwt", "auth.mode %q must be hmac or jwt", c.Auth.Mode)
+	}
+	if c.Admission != nil {
+		if err := c.Admission.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("admission: %w", err))
+		}
+	}
+	switch c.GroupStore {
+	case "", "memory":
+	case "etcd":
+		check(len(c.Endpoints) > 0, "endpoints are required by the etcd group store")
+	default:
+		check(false, "group_store %q must be etcd or memory", c.GroupStore)
+	}
+	switch c.FillLock {
+	case "", "memory":
+	case "etcd":
+		check(len(c.Endpoints) > 0, "endpoints are required by the etcd fill lock")
+		check(c.FillLockTTL > 0, "fill_lock_ttl must be > 0 with the etcd fill lock")
+	default:
+		check(false, "fill_lock %q must be etcd or memory", c.FillLock)
+	}
+	names := make(map[string]bool)
+	for i, g := range c.Groups {
+		if err := g.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("groups[%d]: %w", i, err))
+		}
+		check(!names[g.Name], "group %q is defined twice", g.Name)
+		names[g.Name] = true
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every setting of the group that cannot work.
+func (g GroupConfig) Validate() error {
+	var errs []error
+	if g.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if g.Backend.Type == "" {
+		errs = append(errs, fmt.Errorf("group %q needs a backend type", g.Name))
+	}
+	if g.MaxEntries < 0 || g.Expires < 0 || g.NegativeTTL < 0 {
+		errs = append(errs, fmt.Errorf("group %q: max_entries, expires and negative_ttl must be >= 0", g.Name))
+	}
+	if g.StaleGrace < 0 || g.MaxStale < 0 {
+		errs = append(errs, fmt.Errorf("group %q: stale_grace and max_stale must be >= 0", g.Name))
+	}
+	if g.Retries < 0 || g.RetryBackoff < 0 || g.RetryMaxBackoff < 0 || g.MaxLoads < 0 || g.RateLimit < 0 || g.RateBurst < 0 {
+		errs = append(errs, fmt.Errorf("group %q: retries, retry_backoff, retry_max_backoff, max_loads, rate_limit and rate_burst must be >= 0", g.Name))
+	}
+	if g.RefreshAhead < 0 || g.RefreshAhead >= 100 {
+		errs = append(errs, fmt.Errorf("group %q: refresh_ahead must be a percentage in [0, 100)", g.Name))
+	}
+	if g.Admission != nil {
+		if err := g.Admission.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("group %q: admission: %w", g.Name, err))
+		}
+	}
+	if g.Eviction != "" && g.Eviction != "lru" {
+		errs = append(errs, fmt.Errorf("group %q: unsupported eviction %q, only lru", g.Name, g.Eviction))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every setting that cannot work.
+func (a *AdmissionConfig) Validate() error {
+	var errs []error
+	if a.MaxInFlight <= 0 {
+		errs = append(errs, errors.New("max_in_flight must be > 0"))
+	}
+	if a.MaxQueue < 0 || a.QueueTimeout < 0 || a.TargetLatency < 0 || a.MinInFlight < 0 {
+		errs = append(errs, errors.New("max_queue, queue_timeout, target_latency and min_in_flight must be >= 0"))
+	}
+	if a.MinInFlight > a.MaxInFlight {
+		errs = append(errs, errors.New("min_in_flight must not exceed max_in_flight"))
+	}
+	return errors.Join(errs...)
+}
+
+// Override sets the setting Key, written like in the config file with
+// dots for nested settings (e.g. "tls.ca_file"), to Value.
+type Override struct {
+	Key, Value string
+}
+
+// Overrides collects "-set key=value" command line flags; it implements
+// flag.Value.
+type Overrides []Override
+
+func (o *Overrides) String() string {
+	parts := make([]string, len(*o))
+	for i, ov := range *o {
+		parts[i] = ov.Key + "=" + ov.Value
+	}
+	return strings.Join(parts, ",")
+}
+
+func (o *Overrides) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("override %q is not key=value", s)
+	}
+	*o = append(*o, Override{Key: key, Value: value})
+	return nil
+}
+
+// applyEnv 应用 KUNCACHE_ 开头的环境变量，下划线分隔的名字匹配配置项
+func (c *Config) applyEnv(environ []string) error {
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		key, ok := envKey(reflect.TypeOf(*c), strings.ToLower(strings.TrimPrefix(name, EnvPrefix)))
+		if !ok {
+			// 其他程序自己的环境变量，如 KUNCACHE_BIND
+			continue
+		}
+		if err := c.Set(key, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// envKey 把 "tls_cert_file" 还原为 "tls.cert_file"：json tag 本身也含下划线，
+// 所以逐个字段匹配前缀
+func envKey(t reflect.Type, name string) (string, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return "", false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		tag := jsonName(t.Field(i))
+		if tag == "" {
+			continue
+		}
+		if name == tag {
+			return tag, true
+		}
+		if rest, ok := strings.CutPrefix(name, tag+"_"); ok {
+			if sub, ok := envKey(t.Field(i).Type, rest); ok {
+				return tag + "." + sub, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Set sets the setting key, written like in the config file with dots for
+// nested settings, from its string form. Lists are comma separated.
+func (c *Config) Set(key, value string) error {
+	v := reflect.ValueOf(c).Elem()
+	for _, part := range strings.Split(key, ".") {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		field, ok := fieldByJSONName(v, part)
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		v = field
+	}
+	if err := setString(v, value); err != nil {
+		return fmt.Errorf("setting %q: %w", key, err)
+	}
+	return nil
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if jsonName(v.Type().Field(i)) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func setString(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("cannot be set from a string")
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("cannot be set from a string")
+	}
+	return nil
+}
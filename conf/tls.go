@@ -0,0 +1,79 @@
+package conf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig 节点间通信的 TLS 配置
+type TLSConfig struct {
+	CertFile   string `json:"cert_file,omitempty"`   // 本节点证书
+	KeyFile    string `json:"key_file,omitempty"`    // 本节点私钥
+	CAFile     string `json:"ca_file,omitempty"`     // 校验对端证书的 CA，为空使用系统根证书
+	ServerName string `json:"server_name,omitempty"` // 校验服务端证书时使用的名字，为空使用对端地址
+	ClientAuth bool   `json:"client_auth,omitempty"` // 服务端要求并校验客户端证书 (mTLS)
+}
+
+// ServerConfig builds the tls.Config used by a node to accept peer
+// connections.
+func (c *TLSConfig) ServerConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load key pair: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.ClientAuth {
+		pool, err := c.caPool()
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ClientConfig builds the tls.Config used by a node to connect to its
+// peers. The node's own certificate is presented when configured, so the
+// same files serve both sides of mTLS.
+func (c *TLSConfig) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		pool, err := c.caPool()
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" && c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (c *TLSConfig) caPool() (*x509.CertPool, error) {
+	if c.CAFile == "" {
+		return nil, fmt.Errorf("client_auth requires ca_file")
+	}
+	data, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read ca file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+	}
+	return pool, nil
+}
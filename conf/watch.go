@@ -0,0 +1,93 @@
+package conf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+// Reload works out which settings of next can be applied to a node running
+// with cur. It returns cur with those settings taken from next, and one
+// reason for every other change, which needs a restart.
+//
+// replicas, expires and the max_entries and expires of existing groups
+// can change live; everything else, such as endpoints, discovery or adding
+// a group, cannot.
+func Reload(cur, next *Config) (*Config, []string) {
+	applied := *cur
+	applied.Replicas = next.Replicas
+	applied.Expires = next.Expires
+
+	var rejected []string
+	t := reflect.TypeOf(applied)
+	v, nv := reflect.ValueOf(applied), reflect.ValueOf(*next)
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		if name == "groups" {
+			continue
+		}
+		if !reflect.DeepEqual(v.Field(i).Interface(), nv.Field(i).Interface()) {
+			rejected = append(rejected, fmt.Sprintf("%s cannot change without restart", name))
+		}
+	}
+
+	applied.Groups = make([]GroupConfig, len(cur.Groups))
+	copy(applied.Groups, cur.Groups)
+	nextGroups := make(map[string]GroupConfig, len(next.Groups))
+	for _, g := range next.Groups {
+		nextGroups[g.Name] = g
+	}
+	for i, g := range applied.Groups {
+		ng, ok := nextGroups[g.Name]
+		if !ok {
+			rejected = append(rejected, fmt.Sprintf("group %q cannot be removed without restart", g.Name))
+			continue
+		}
+		delete(nextGroups, g.Name)
+		// 只有 max_entries 和 expires 可以在线修改
+		applied.Groups[i].MaxEntries, applied.Groups[i].Expires = ng.MaxEntries, ng.Expires
+		ng.MaxEntries, ng.Expires = g.MaxEntries, g.Expires
+		if !reflect.DeepEqual(g, ng) {
+			rejected = append(rejected, fmt.Sprintf("group %q: only max_entries and expires can change without restart", g.Name))
+		}
+	}
+	for _, g := range next.Groups {
+		if _, added := nextGroups[g.Name]; added {
+			rejected = append(rejected, fmt.Sprintf("group %q cannot be added without restart", g.Name))
+		}
+	}
+	return &applied, rejected
+}
+
+// Watch polls the config file at path every interval until ctx is done.
+// Whenever its content differs from what it was when Watch was called, the
+// file is loaded again like Load does, with the same overrides, and
+// onChange receives the new config or the error that made it unusable.
+// Watch returns at once; onChange is called from its own goroutine.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func(*Config, error), overrides ...Override) {
+	last, _ := os.ReadFile(path)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				// 编辑器保存时文件可能短暂不存在，下次再读
+				continue
+			}
+			if bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			onChange(Load(path, overrides...))
+		}
+	}()
+}
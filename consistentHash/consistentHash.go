@@ -20,6 +20,8 @@ type Map[K comparable] struct {
 	hashRing []uint32
 	//虚拟节点与真实节点的映射表
 	hashMap map[uint32]K
+	//环上的真实节点及其权重，虚拟节点数为权重乘以倍数
+	nodes map[K]int
 }
 
 // New creates a Map instance
@@ -28,6 +30,7 @@ func New[K comparable](replicas int, hash Hash) *Map[K] {
 		replicas: replicas,
 		hash:     hash,
 		hashMap:  make(map[uint32]K),
+		nodes:    make(map[K]int),
 	}
 	//不指定哈希函数使用默认哈希
 	if m.hash == nil {
@@ -36,12 +39,23 @@ func New[K comparable](replicas int, hash Hash) *Map[K] {
 	return m
 }
 
-// Add adds some keys to the hash.
+// Add adds some keys to the hash. Keys already on the ring are skipped.
 // 添加keys到哈希环
 func (m *Map[K]) Add(keys ...K) {
+	m.AddWeighted(1, keys...)
+}
+
+// AddWeighted adds keys with weight times the virtual nodes of Add, so
+// they own about weight times as many keys. Keys already on the ring are
+// skipped.
+func (m *Map[K]) AddWeighted(weight int, keys ...K) {
 	for _, key := range keys {
+		if _, ok := m.nodes[key]; ok {
+			continue
+		}
+		m.nodes[key] = weight
 		//每个key都要有虚拟节点 加入虚拟节点
-		for i := 0; i < m.replicas; i++ {
+		for i := 0; i < weight*m.replicas; i++ {
 			hash := m.hash([]byte(fmt.Sprintf("%v%v", i, key)))
 			m.hashRing = append(m.hashRing, hash)
 			m.hashMap[hash] = key
@@ -54,8 +68,10 @@ func (m *Map[K]) Add(keys ...K) {
 // Remove use to remove a key and its virtual keys on the ring and map
 func (m *Map[K]) Remove(keys ...K) {
 	for _, key := range keys {
+		weight := m.nodes[key]
+		delete(m.nodes, key)
 		//删除虚拟节点
-		for i := 0; i < m.replicas; i++ {
+		for i := 0; i < weight*m.replicas; i++ {
 			hash := m.hash([]byte(fmt.Sprintf("%v%v", i, key)))
 			idx, ok := slices.BinarySearch(m.hashRing, hash)
 			if !ok {
@@ -74,7 +90,65 @@ func (m *Map[K]) Get(key K) (addr K) {
 	if len(m.hashRing) == 0 {
 		return
 	}
+	return m.hashMap[m.hashRing[m.search(key)]]
+}
+
+// GetN returns up to n distinct items clockwise from the key, starting
+// with the one Get would return. It lets callers fall over to the next
+// owner on the ring.
+func (m *Map[K]) GetN(key K, n int) []K {
+	if len(m.hashRing) == 0 || n <= 0 {
+		return nil
+	}
+	owners := make([]K, 0, n)
+	seen := make(map[K]struct{}, n)
+	start := m.search(key)
+	for i := 0; i < len(m.hashRing) && len(owners) < n; i++ {
+		owner := m.hashMap[m.hashRing[(start+i)%len(m.hashRing)]]
+		if _, ok := seen[owner]; ok {
+			continue
+		}
+		seen[owner] = struct{}{}
+		owners = append(owners, owner)
+	}
+	return owners
+}
+
+// Len returns the number of distinct items on the ring.
+func (m *Map[K]) Len() int {
+	return len(m.nodes)
+}
 
+// Members returns each real node on the ring with its number of virtual
+// nodes.
+func (m *Map[K]) Members() map[K]int {
+	members := make(map[K]int)
+	for _, owner := range m.hashMap {
+		members[owner]++
+	}
+	return members
+}
+
+// Replicas returns the number of virtual nodes per real node.
+func (m *Map[K]) Replicas() int {
+	return m.replicas
+}
+
+// SetReplicas rebuilds the ring with replicas virtual nodes per unit of
+// weight for each real node already on it, keeping their weights.
+func (m *Map[K]) SetReplicas(replicas int) {
+	nodes := m.nodes
+	m.replicas = replicas
+	m.hashRing = nil
+	m.hashMap = make(map[uint32]K)
+	m.nodes = make(map[K]int)
+	for node, weight := range nodes {
+		m.AddWeighted(weight, node)
+	}
+}
+
+// search returns the index of the first virtual node clockwise from key.
+func (m *Map[K]) search(key K) int {
 	hash := m.hash([]byte(fmt.Sprintf("%v", key)))
 	//二分查找找第一个大于等于目标值的
 	left, right := 0, len(m.hashRing)-1
@@ -86,11 +160,9 @@ func (m *Map[K]) Get(key K) (addr K) {
 			left = mid + 1
 		}
 	}
-	//没有找到大于等于的  取顺时针第一个 映射成真实节点
+	//没有找到大于等于的  取顺时针第一个
 	if left == len(m.hashRing) {
-		return m.hashMap[m.hashRing[0]]
+		return 0
 	}
-
-	return m.hashMap[m.hashRing[left]]
-
+	return left
 }
@@ -2,6 +2,8 @@ package consistentHash
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"testing"
 )
@@ -58,3 +60,83 @@ func TestHash(t *testing.T) {
 		}
 	}
 }
+
+func TestGetN(t *testing.T) {
+	hash := New[string](3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	//  2  4  6 12 14 16 22 24 26
+	hash.Add("6", "4", "2")
+
+	testCases := map[string][]string{
+		"11": {"2", "4", "6"},
+		"23": {"4", "6", "2"},
+		"27": {"2", "4", "6"},
+		"5":  {"6", "2", "4"},
+	}
+	for k, v := range testCases {
+		if got := hash.GetN(k, 3); !slices.Equal(got, v) {
+			t.Errorf("GetN(%s, 3) = %v, want %v", k, got, v)
+		}
+		if got := hash.GetN(k, 10); !slices.Equal(got, v) {
+			t.Errorf("GetN(%s, 10) = %v, want %v", k, got, v)
+		}
+		if got := hash.GetN(k, 1); !slices.Equal(got, v[:1]) {
+			t.Errorf("GetN(%s, 1) = %v, want %v", k, got, v[:1])
+		}
+	}
+	if hash.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", hash.Len())
+	}
+	if got := hash.Members(); !maps.Equal(got, map[string]int{"2": 3, "4": 3, "6": 3}) {
+		t.Errorf("Members() = %v", got)
+	}
+	// 重复加入不会产生多余的虚拟节点
+	hash.Add("2")
+	hash.Remove("4")
+	if hash.Len() != 2 {
+		t.Errorf("after re-adding 2 and removing 4 Len() = %d, want 2", hash.Len())
+	}
+	if got := hash.Members(); !maps.Equal(got, map[string]int{"2": 3, "6": 3}) {
+		t.Errorf("Members() = %v", got)
+	}
+}
+
+func TestSetReplicas(t *testing.T) {
+	hash := New[string](3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+	hash.SetReplicas(2)
+	// 2 4 6 12 14 16
+	if got := hash.Members(); !maps.Equal(got, map[string]int{"2": 2, "4": 2, "6": 2}) {
+		t.Errorf("Members() = %v", got)
+	}
+	if got := hash.Get("23"); got != "2" {
+		t.Errorf("Get(23) = %s, want 2", got)
+	}
+	hash.Remove("2")
+	if hash.Len() != 2 || hash.Replicas() != 2 {
+		t.Errorf("Len() = %d, Replicas() = %d", hash.Len(), hash.Replicas())
+	}
+}
+
+func TestSetReplicasWeighted(t *testing.T) {
+	hash := New[string](2, nil)
+	hash.Add("a")
+	hash.AddWeighted(3, "b")
+	if got := hash.Members(); !maps.Equal(got, map[string]int{"a": 2, "b": 6}) {
+		t.Errorf("Members() = %v", got)
+	}
+	// 重建后权重不变
+	hash.SetReplicas(4)
+	if got := hash.Members(); !maps.Equal(got, map[string]int{"a": 4, "b": 12}) {
+		t.Errorf("after SetReplicas(4) Members() = %v", got)
+	}
+	hash.Remove("b")
+	if got := hash.Members(); hash.Len() != 1 || !maps.Equal(got, map[string]int{"a": 4}) {
+		t.Errorf("after removing b Len() = %d, Members() = %v", hash.Len(), got)
+	}
+}
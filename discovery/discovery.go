@@ -0,0 +1,147 @@
+// Package discovery registers cache nodes and tells every node which peers
+// are in the cluster. Implementations are backed by etcd, a static list,
+// DNS SRV records or an in-memory registry.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"kunCache/conf"
+	"kunCache/peer"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// Service describes a registered cache node.
+type Service struct {
+	Addr     string
+	IP       string
+	Port     string
+	Protocol string
+}
+
+// EventType is the kind of a membership change.
+type EventType int
+
+const (
+	// Put means a service joined or updated its registration.
+	Put EventType = iota
+	// Delete means a service left. Only Service.Addr is guaranteed to be
+	// set.
+	Delete
+)
+
+// Event is a membership change reported by Watch.
+type Event struct {
+	Type    EventType
+	Service Service
+}
+
+// Discovery registers this node and reports the other nodes of the cluster.
+type Discovery interface {
+	// Register announces the service and keeps the registration alive
+	// until Deregister or Close is called.
+	Register(ctx context.Context, service *Service) error
+	// Deregister withdraws a registration made by Register.
+	Deregister(ctx context.Context, service *Service) error
+	// Watch reports membership changes until ctx is done, then closes the
+	// channel.
+	Watch(ctx context.Context) (<-chan Event, error)
+	// List returns the services currently registered.
+	List(ctx context.Context) ([]*Service, error)
+	// Close releases the resources held by the implementation.
+	Close() error
+}
+
+// Factory creates a Discovery from the config.
+type Factory func(c *conf.Config) (Discovery, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// RegisterFactory makes a Discovery implementation living in another
+// package selectable by name in conf.Config.Discovery.
+func RegisterFactory(name string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = f
+}
+
+// New returns the Discovery selected by c.Discovery:
+// "etcd" (the default), "static", "dns", "memory" or one added with
+// RegisterFactory.
+func New(c *conf.Config) (Discovery, error) {
+	switch c.Discovery {
+	case "", "etcd":
+		return NewEtcd(c.Endpoints, time.Duration(c.DialTimeout)*time.Second, c.Prefix, c.LeaseTTL)
+	case "static":
+		services := make([]*Service, 0, len(c.Peers))
+		for _, p := range c.Peers {
+			services = append(services, NewService(p.Addr, p.Protocol))
+		}
+		return NewStatic(services...), nil
+	case "dns":
+		if c.SRVName == "" {
+			return nil, fmt.Errorf("dns discovery requires srv_name")
+		}
+		return NewDNS(c.SRVName, c.SRVProtocol, time.Duration(c.SRVInterval)*time.Second), nil
+	case "memory":
+		return DefaultMemory, nil
+	}
+	factoriesMu.RLock()
+	f, ok := factories[c.Discovery]
+	factoriesMu.RUnlock()
+	if ok {
+		return f(c)
+	}
+	return nil, fmt.Errorf("unknown discovery %q", c.Discovery)
+}
+
+// NewService builds a Service from a "host:port" address.
+func NewService(addr, protocol string) *Service {
+	s := &Service{Addr: addr, Protocol: protocol}
+	s.IP, s.Port, _ = net.SplitHostPort(addr)
+	return s
+}
+
+// Sync adds the registered services to picker and keeps it in step with
+// membership changes until ctx is done. Services are added with their
+// registered protocol when picker is a ProtocolPicker.
+func Sync[K comparable, V any](ctx context.Context, d Discovery, picker peer.Picker[K, V]) error {
+	// 先监听再全量拉取，避免遗漏两者之间的变化
+	events, err := d.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	services, err := d.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range services {
+		addPeer(picker, s)
+	}
+	for event := range events {
+		switch event.Type {
+		case Put:
+			addPeer(picker, &event.Service)
+			slog.Info("[Discovery] put", "addr", event.Service.Addr, "protocol", event.Service.Protocol)
+		case Delete:
+			picker.DelPeers(any(event.Service.Addr).(K))
+			slog.Info("[Discovery] delete", "addr", event.Service.Addr)
+		}
+	}
+	return ctx.Err()
+}
+
+func addPeer[K comparable, V any](picker peer.Picker[K, V], s *Service) {
+	addr := any(s.Addr).(K)
+	if pp, ok := picker.(peer.ProtocolPicker[K, V]); ok && s.Protocol != "" {
+		pp.AddProtocolPeers(s.Protocol, addr)
+		return
+	}
+	picker.AddPeers(addr)
+}
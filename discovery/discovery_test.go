@@ -0,0 +1,150 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"kunCache/internal/etcdtest"
+	"kunCache/peer"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordPicker 记录 Sync 加入和删除的节点
+type recordPicker struct {
+	mu    sync.Mutex
+	peers map[string]string // addr -> protocol
+}
+
+func (p *recordPicker) Pick(key string) (peer.Fetcher[string, string], bool) { return nil, false }
+
+func (p *recordPicker) AddPeers(peersAddr ...string) {
+	p.AddProtocolPeers("", peersAddr...)
+}
+
+func (p *recordPicker) AddProtocolPeers(protocol string, peersAddr ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, addr := range peersAddr {
+		p.peers[addr] = protocol
+	}
+}
+
+func (p *recordPicker) DelPeers(peersAddr ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, addr := range peersAddr {
+		delete(p.peers, addr)
+	}
+}
+
+func (p *recordPicker) snapshot() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m := make(map[string]string, len(p.peers))
+	for k, v := range p.peers {
+		m[k] = v
+	}
+	return m
+}
+
+// waitFor 等待 picker 中的节点变为 want
+func waitFor(t *testing.T, p *recordPicker, want map[string]string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		got := p.snapshot()
+		if len(got) == len(want) {
+			equal := true
+			for k, v := range want {
+				if got[k] != v {
+					equal = false
+				}
+			}
+			if equal {
+				return
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("peers = %v, want %v", p.snapshot(), want)
+}
+
+func TestMemorySync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemory()
+	a, b := NewService("127.0.0.1:8001", "HTTP"), NewService("127.0.0.1:8002", "GRPC")
+	m.Register(ctx, a)
+
+	p := &recordPicker{peers: make(map[string]string)}
+	done := make(chan error)
+	go func() { done <- Sync[string, string](ctx, m, p) }()
+	waitFor(t, p, map[string]string{a.Addr: "HTTP"})
+
+	m.Register(ctx, b)
+	waitFor(t, p, map[string]string{a.Addr: "HTTP", b.Addr: "GRPC"})
+
+	m.Deregister(ctx, a)
+	waitFor(t, p, map[string]string{b.Addr: "GRPC"})
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Sync returned %v after cancel", err)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewStatic(NewService("127.0.0.1:8001", "HTTP"), NewService("127.0.0.1:8002", "HTTP"))
+	p := &recordPicker{peers: make(map[string]string)}
+	go Sync[string, string](ctx, s, p)
+	waitFor(t, p, map[string]string{"127.0.0.1:8001": "HTTP", "127.0.0.1:8002": "HTTP"})
+	cancel()
+}
+
+func TestDNS(t *testing.T) {
+	var mu sync.Mutex
+	records := []*net.SRV{{Target: "node1.example.com.", Port: 8001}}
+	d := NewDNS("_kuncache._tcp.example.com", "GRPC", 10*time.Millisecond)
+	d.lookup = func(ctx context.Context, name string) ([]*net.SRV, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(records), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &recordPicker{peers: make(map[string]string)}
+	go Sync[string, string](ctx, d, p)
+	waitFor(t, p, map[string]string{"node1.example.com:8001": "GRPC"})
+
+	mu.Lock()
+	records = []*net.SRV{{Target: "node2.example.com.", Port: 8002}}
+	mu.Unlock()
+	waitFor(t, p, map[string]string{"node2.example.com:8002": "GRPC"})
+}
+
+func TestEtcdSync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e, err := NewEtcd([]string{etcdtest.Start(t)}, 5*time.Second, "clusters/", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	a, b := NewService("127.0.0.1:8001", "HTTP"), NewService("127.0.0.1:8002", "GRPC")
+	if err := e.Register(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &recordPicker{peers: make(map[string]string)}
+	go Sync[string, string](ctx, e, p)
+	waitFor(t, p, map[string]string{a.Addr: "HTTP"})
+	e.Register(ctx, b)
+	waitFor(t, p, map[string]string{a.Addr: "HTTP", b.Addr: "GRPC"})
+	e.Deregister(ctx, a)
+	waitFor(t, p, map[string]string{b.Addr: "GRPC"})
+}
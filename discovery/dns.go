@@ -0,0 +1,124 @@
+package discovery
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSRVProtocol = "HTTP"
+	defaultSRVInterval = 30 * time.Second
+)
+
+// DNS discovers services from the SRV records of a name such as
+// "_kuncache._tcp.example.com", polling it for changes. Registration is
+// managed outside kunCache, so Register and Deregister are no-ops.
+type DNS struct {
+	name     string
+	protocol string
+	interval time.Duration
+	lookup   func(ctx context.Context, name string) ([]*net.SRV, error)
+}
+
+// NewDNS creates a DNS discovery. Every target is assumed to speak
+// protocol ("HTTP" if empty), and the records are re-read every interval
+// (30s if zero).
+func NewDNS(name, protocol string, interval time.Duration) *DNS {
+	if protocol == "" {
+		protocol = defaultSRVProtocol
+	}
+	if interval <= 0 {
+		interval = defaultSRVInterval
+	}
+	return &DNS{
+		name:     name,
+		protocol: protocol,
+		interval: interval,
+		lookup: func(ctx context.Context, name string) ([]*net.SRV, error) {
+			_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+			return srvs, err
+		},
+	}
+}
+
+func (d *DNS) Register(ctx context.Context, service *Service) error   { return nil }
+func (d *DNS) Deregister(ctx context.Context, service *Service) error { return nil }
+
+// List resolves the SRV records into services.
+func (d *DNS) List(ctx context.Context) ([]*Service, error) {
+	srvs, err := d.lookup(ctx, d.name)
+	if err != nil {
+		return nil, err
+	}
+	services := make([]*Service, 0, len(srvs))
+	for _, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		port := strconv.Itoa(int(srv.Port))
+		services = append(services, &Service{
+			Addr:     net.JoinHostPort(host, port),
+			IP:       host,
+			Port:     port,
+			Protocol: d.protocol,
+		})
+	}
+	return services, nil
+}
+
+// Watch polls the SRV records and reports the difference between polls.
+func (d *DNS) Watch(ctx context.Context) (<-chan Event, error) {
+	known := make(map[string]*Service)
+	services, err := d.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range services {
+		known[s.Addr] = s
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			services, err := d.List(ctx)
+			if err != nil {
+				slog.Error("[Discovery] lookup srv failed", "name", d.name, "err", err)
+				continue
+			}
+			current := make(map[string]*Service, len(services))
+			var changes []Event
+			for _, s := range services {
+				current[s.Addr] = s
+				if _, ok := known[s.Addr]; !ok {
+					changes = append(changes, Event{Type: Put, Service: *s})
+				}
+			}
+			for addr, s := range known {
+				if _, ok := current[addr]; !ok {
+					changes = append(changes, Event{Type: Delete, Service: *s})
+				}
+			}
+			known = current
+			for _, event := range changes {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+func (d *DNS) Close() error { return nil }
@@ -0,0 +1,183 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kunCache/etcd"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const defaultLeaseTTL = 5
+
+// Etcd registers services under a key prefix in etcd, each key bound to a
+// lease that is kept alive while the service is registered.
+type Etcd struct {
+	cli      *clientv3.Client
+	prefix   string
+	leaseTTL int64
+
+	mu     sync.Mutex
+	leases map[string]registration // keyed by Service.Addr
+}
+
+type registration struct {
+	lease  clientv3.LeaseID
+	cancel context.CancelFunc
+}
+
+// NewEtcd connects to etcd. Services are stored under prefix+Addr with a
+// lease of leaseTTL seconds.
+func NewEtcd(endpoints []string, dialTimeout time.Duration, prefix string, leaseTTL int) (*Etcd, error) {
+	cli, err := etcd.NewClient(endpoints, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("create etcd client: %w", err)
+	}
+	if leaseTTL <= 0 {
+		leaseTTL = defaultLeaseTTL
+	}
+	return &Etcd{
+		cli:      cli,
+		prefix:   prefix,
+		leaseTTL: int64(leaseTTL),
+		leases:   make(map[string]registration),
+	}, nil
+}
+
+// Register puts the service under a new lease and keeps the lease alive
+// in the background.
+func (e *Etcd) Register(ctx context.Context, service *Service) error {
+	jsonService, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	//租约
+	lease, err := e.cli.Grant(ctx, e.leaseTTL)
+	if err != nil {
+		return fmt.Errorf("grant lease: %w", err)
+	}
+	if _, err := e.cli.Put(ctx, e.prefix+service.Addr, string(jsonService), clientv3.WithLease(lease.ID)); err != nil {
+		return fmt.Errorf("put service: %w", err)
+	}
+	keepCtx, cancel := context.WithCancel(context.Background())
+	liveChan, err := e.cli.KeepAlive(keepCtx, lease.ID)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("keep alive: %w", err)
+	}
+
+	e.mu.Lock()
+	if old, ok := e.leases[service.Addr]; ok {
+		old.cancel()
+	}
+	e.leases[service.Addr] = registration{lease: lease.ID, cancel: cancel}
+	e.mu.Unlock()
+
+	go func() {
+		for range liveChan {
+		}
+		if keepCtx.Err() == nil {
+			slog.Error("[Discovery] etcd lease lost", "addr", service.Addr, "lease", lease.ID)
+		}
+	}()
+	return nil
+}
+
+// Deregister revokes the lease of the service, deleting its key.
+func (e *Etcd) Deregister(ctx context.Context, service *Service) error {
+	e.mu.Lock()
+	reg, ok := e.leases[service.Addr]
+	delete(e.leases, service.Addr)
+	e.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	reg.cancel()
+	_, err := e.cli.Revoke(ctx, reg.lease)
+	return err
+}
+
+// List returns the services registered under the prefix.
+func (e *Etcd) List(ctx context.Context) ([]*Service, error) {
+	resp, err := e.cli.Get(ctx, e.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("get peer list from etcd: %w", err)
+	}
+	var services []*Service
+	for _, kv := range resp.Kvs {
+		service := &Service{}
+		if err := json.Unmarshal(kv.Value, service); err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
+
+// Watch reports puts and deletes under the prefix. A broken watch resumes
+// where it stopped, see etcd.WatchPrefix.
+func (e *Etcd) Watch(ctx context.Context) (<-chan Event, error) {
+	//监听节点上线和下线
+	changes, err := etcd.WatchPrefix(ctx, e.cli, e.prefix)
+	if err != nil {
+		return nil, fmt.Errorf("watch %s: %w", e.prefix, err)
+	}
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for ev := range changes {
+			event, ok := e.convert(ev)
+			if !ok {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+func (e *Etcd) convert(ev *clientv3.Event) (Event, bool) {
+	//   clusters/localhost:8002
+	addr := strings.TrimPrefix(string(ev.Kv.Key), e.prefix)
+	switch ev.Type {
+	case clientv3.EventTypeDelete:
+		return Event{Type: Delete, Service: Service{Addr: addr}}, true
+	case clientv3.EventTypePut:
+		service := Service{}
+		if err := json.Unmarshal(ev.Kv.Value, &service); err != nil {
+			slog.Error("[Discovery] bad service record", "key", string(ev.Kv.Key), "err", err)
+			return Event{}, false
+		}
+		if service.Addr == "" {
+			service.Addr = addr
+		}
+		return Event{Type: Put, Service: service}, true
+	}
+	return Event{}, false
+}
+
+// Client returns the underlying etcd client.
+func (e *Etcd) Client() *clientv3.Client {
+	return e.cli
+}
+
+// Close stops keeping registrations alive and closes the client. The
+// leases expire on their own after the TTL.
+func (e *Etcd) Close() error {
+	e.mu.Lock()
+	for addr, reg := range e.leases {
+		reg.cancel()
+		delete(e.leases, addr)
+	}
+	e.mu.Unlock()
+	return e.cli.Close()
+}
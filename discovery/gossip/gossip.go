@@ -0,0 +1,706 @@
+// Package gossip implements cluster membership with a SWIM-style gossip
+// protocol over UDP, as an etcd-free discovery.Discovery.
+//
+// Every protocol period a node pings one member. If no ack arrives within
+// the probe timeout it asks a few other members to ping it indirectly; if
+// that fails too the member is suspected. A suspected member that does not
+// refute the suspicion (by gossiping a higher incarnation) within the
+// suspicion timeout is declared dead, and forgotten after the dead timeout.
+// Membership updates are piggybacked on the ping/ack traffic and
+// retransmitted a logarithmic number of times.
+package gossip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kunCache/conf"
+	"kunCache/discovery"
+	"log/slog"
+	"math/bits"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+func init() {
+	discovery.RegisterFactory("gossip", func(c *conf.Config) (discovery.Discovery, error) {
+		n, err := New(Config{
+			BindAddr:         c.GossipAddr,
+			AdvertiseAddr:    c.GossipAdvertise,
+			ProbeInterval:    time.Duration(c.GossipProbeInterval) * time.Millisecond,
+			SuspicionTimeout: time.Duration(c.GossipSuspicionTimeout) * time.Millisecond,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(c.GossipSeeds) > 0 {
+			// 种子节点可能还没启动，后台重试直到加入集群
+			n.RetryJoin(c.GossipSeeds...)
+		}
+		return n, nil
+	})
+}
+
+const (
+	defaultProbeInterval    = time.Second
+	defaultIndirectChecks   = 3
+	defaultRetransmitMult   = 4
+	defaultSuspicionTimeout = 5 * time.Second
+	defaultDeadTimeout      = time.Minute
+	maxJoinBackoff          = 30 * time.Second
+	maxPiggyback            = 16
+	maxPacketSize           = 64 * 1024
+)
+
+// Config configures a Node. Zero values select the defaults.
+type Config struct {
+	// BindAddr is the UDP address to listen on, e.g. "0.0.0.0:7946".
+	// An empty port picks a free one.
+	BindAddr string
+	// AdvertiseAddr is the address other nodes reach this node at, which is
+	// also its identity in the cluster. It defaults to the bound address and
+	// must be set when BindAddr is unspecified, e.g. "0.0.0.0:7946".
+	AdvertiseAddr string
+	// ProbeInterval is the protocol period: one member is probed per
+	// period.
+	ProbeInterval time.Duration
+	// ProbeTimeout is how long to wait for a direct ack before asking
+	// other members to probe indirectly. It defaults to a fifth of
+	// ProbeInterval.
+	ProbeTimeout time.Duration
+	// IndirectChecks is the number of members asked to probe indirectly.
+	IndirectChecks int
+	// SuspicionTimeout is how long a member stays suspected before it is
+	// declared dead.
+	SuspicionTimeout time.Duration
+	// DeadTimeout is how long a dead member is remembered, so stale gossip
+	// does not bring it back, before it is forgotten.
+	DeadTimeout time.Duration
+	// RetransmitMult scales how many times an update is piggybacked:
+	// RetransmitMult * log2(members+1).
+	RetransmitMult int
+}
+
+func (c Config) withDefaults() Config {
+	if c.ProbeInterval <= 0 {
+		c.ProbeInterval = defaultProbeInterval
+	}
+	if c.ProbeTimeout <= 0 {
+		c.ProbeTimeout = c.ProbeInterval / 5
+	}
+	if c.IndirectChecks <= 0 {
+		c.IndirectChecks = defaultIndirectChecks
+	}
+	if c.SuspicionTimeout <= 0 {
+		c.SuspicionTimeout = defaultSuspicionTimeout
+	}
+	if c.DeadTimeout <= 0 {
+		c.DeadTimeout = defaultDeadTimeout
+	}
+	if c.RetransmitMult <= 0 {
+		c.RetransmitMult = defaultRetransmitMult
+	}
+	return c
+}
+
+type state int
+
+const (
+	stateAlive state = iota
+	stateSuspect
+	stateDead
+)
+
+// member is a node as seen locally. Addr is its gossip UDP address, which
+// identifies it; Service is the cache service it registered, if any.
+type member struct {
+	addr        string
+	service     *discovery.Service
+	state       state
+	incarnation uint64
+	suspectAt   time.Time
+	deadAt      time.Time
+}
+
+// update is a piece of membership gossip.
+type update struct {
+	Addr        string             `json:"a"`
+	Service     *discovery.Service `json:"s,omitempty"`
+	State       state              `json:"st"`
+	Incarnation uint64             `json:"i"`
+}
+
+type msgType int
+
+const (
+	msgPing msgType = iota
+	msgAck
+	msgPingReq
+	msgJoin
+	msgSync
+)
+
+type message struct {
+	Type    msgType  `json:"t"`
+	Seq     uint64   `json:"q,omitempty"`
+	From    string   `json:"f"`
+	Target  string   `json:"g,omitempty"` // ping-req 需要间接探测的节点
+	Updates []update `json:"u,omitempty"`
+}
+
+type broadcast struct {
+	update    update
+	remaining int
+}
+
+// Node is a member of a gossip cluster. It implements discovery.Discovery:
+// Register publishes the cache service of this node to the cluster and
+// Watch reports the services of members joining and leaving.
+type Node struct {
+	cfg  Config
+	conn *net.UDPConn
+	addr string
+
+	mu         sync.Mutex
+	self       *member
+	members    map[string]*member
+	broadcasts []*broadcast
+	acks       map[uint64]func()
+	seq        uint64
+	probeOrder []string
+	hub        discovery.Hub
+	// joining 正在等待种子节点应答的 Join，收到 sync 后全部关闭
+	joining map[chan struct{}]struct{}
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// New starts a Node listening on cfg.BindAddr. It is alone until Join is
+// called or another node joins it.
+func New(cfg Config) (*Node, error) {
+	cfg = cfg.withDefaults()
+	udpAddr, err := net.ResolveUDPAddr("udp", cfg.BindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", cfg.BindAddr, err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", cfg.BindAddr, err)
+	}
+	n := &Node{
+		cfg:     cfg,
+		conn:    conn,
+		addr:    cfg.AdvertiseAddr,
+		acks:    make(map[uint64]func()),
+		joining: make(map[chan struct{}]struct{}),
+		stop:    make(chan struct{}),
+	}
+	// 以启动时间作为初始版本，重启的节点能覆盖自己之前的下线记录
+	if n.addr == "" {
+		n.addr = conn.LocalAddr().String()
+	}
+	n.self = &member{addr: n.addr, state: stateAlive, incarnation: uint64(time.Now().UnixNano())}
+	n.members = map[string]*member{n.addr: n.self}
+
+	n.done.Add(2)
+	go n.receive()
+	go n.probeLoop()
+	return n, nil
+}
+
+// Addr returns the gossip address of the node.
+func (n *Node) Addr() string {
+	return n.addr
+}
+
+// errClosed 表示节点已经关闭
+var errClosed = errors.New("gossip: node closed")
+
+// Join contacts the seeds and pulls the membership from them. It succeeds
+// once a seed answers, and fails if none does within a protocol period.
+func (n *Node) Join(seeds ...string) error {
+	synced := make(chan struct{})
+	n.mu.Lock()
+	n.joining[synced] = struct{}{}
+	msg := message{Type: msgJoin, From: n.addr, Updates: []update{n.selfUpdate()}}
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.joining, synced)
+		n.mu.Unlock()
+	}()
+
+	var errs []error
+	sent := 0
+	for _, seed := range seeds {
+		if seed == n.addr {
+			continue
+		}
+		if err := n.sendRaw(seed, msg); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		// 没有其他种子节点时自己就是集群
+		return errors.Join(errs...)
+	}
+	timer := time.NewTimer(n.cfg.ProbeInterval)
+	defer timer.Stop()
+	select {
+	case <-synced:
+		return nil
+	case <-timer.C:
+		return errors.Join(append(errs, fmt.Errorf("no seed of %v answered within %v", seeds, n.cfg.ProbeInterval))...)
+	case <-n.stop:
+		return errClosed
+	}
+}
+
+// RetryJoin calls Join in the background until a seed answers or the node
+// is closed, backing off exponentially from the protocol period up to 30s,
+// so the nodes of a cluster can start in any order.
+func (n *Node) RetryJoin(seeds ...string) {
+	n.done.Add(1)
+	go func() {
+		defer n.done.Done()
+		backoff := n.cfg.ProbeInterval
+		for {
+			err := n.Join(seeds...)
+			if err == nil {
+				slog.Info("[Gossip] joined", "self", n.addr, "seeds", seeds)
+				return
+			}
+			if errors.Is(err, errClosed) {
+				return
+			}
+			slog.Warn("[Gossip] join failed, retrying", "seeds", seeds, "backoff", backoff, "err", err)
+			select {
+			case <-time.After(backoff):
+			case <-n.stop:
+				return
+			}
+			backoff = min(backoff*2, maxJoinBackoff)
+		}
+	}()
+}
+
+// Register sets the cache service advertised by this node.
+func (n *Node) Register(ctx context.Context, service *discovery.Service) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s := *service
+	n.self.service = &s
+	n.self.incarnation++
+	n.enqueue(n.selfUpdate())
+	n.hub.Publish(discovery.Event{Type: discovery.Put, Service: s})
+	return nil
+}
+
+// Deregister announces that this node leaves the cluster. The node keeps
+// gossiping until Close so the announcement spreads.
+func (n *Node) Deregister(ctx context.Context, service *discovery.Service) error {
+	n.mu.Lock()
+	if n.self.service == nil {
+		n.mu.Unlock()
+		return nil
+	}
+	leave := update{Addr: n.addr, Service: n.self.service, State: stateDead, Incarnation: n.self.incarnation}
+	n.hub.Publish(discovery.Event{Type: discovery.Delete, Service: *n.self.service})
+	n.self.service = nil
+	n.enqueue(leave)
+	peers := n.aliveLocked()
+	n.mu.Unlock()
+
+	// 直接通知其他节点，不等待下一个探测周期
+	for _, m := range peers {
+		n.sendRaw(m.addr, message{Type: msgPing, From: n.addr, Updates: []update{leave}})
+	}
+	return nil
+}
+
+// List returns the services of the live and suspected members, including
+// this node once it registered.
+func (n *Node) List(ctx context.Context) ([]*discovery.Service, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var services []*discovery.Service
+	for _, m := range n.members {
+		if m.state != stateDead && m.service != nil {
+			s := *m.service
+			services = append(services, &s)
+		}
+	}
+	return services, nil
+}
+
+// Watch reports members whose service joins (Put) or leaves (Delete).
+func (n *Node) Watch(ctx context.Context) (<-chan discovery.Event, error) {
+	return n.hub.Watch(ctx), nil
+}
+
+// Close stops the node without announcing it; the others will detect the
+// failure. Call Deregister first for a graceful leave.
+func (n *Node) Close() error {
+	select {
+	case <-n.stop:
+		return nil
+	default:
+	}
+	close(n.stop)
+	err := n.conn.Close()
+	n.done.Wait()
+	return err
+}
+
+// selfUpdate n.mu must be held.
+func (n *Node) selfUpdate() update {
+	return update{Addr: n.addr, Service: n.self.service, State: stateAlive, Incarnation: n.self.incarnation}
+}
+
+// aliveLocked returns the other members that are not dead. n.mu must be
+// held.
+func (n *Node) aliveLocked() []*member {
+	var ms []*member
+	for _, m := range n.members {
+		if m != n.self && m.state != stateDead {
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+// enqueue schedules an update for piggybacking. n.mu must be held.
+func (n *Node) enqueue(u update) {
+	// 同一个节点只保留最新的消息
+	for i, b := range n.broadcasts {
+		if b.update.Addr == u.Addr {
+			n.broadcasts = append(n.broadcasts[:i], n.broadcasts[i+1:]...)
+			break
+		}
+	}
+	limit := n.cfg.RetransmitMult * bits.Len(uint(len(n.members)+1))
+	n.broadcasts = append(n.broadcasts, &broadcast{update: u, remaining: limit})
+}
+
+// piggyback takes up to maxPiggyback pending updates. n.mu must be held.
+func (n *Node) piggyback() []update {
+	var updates []update
+	kept := n.broadcasts[:0]
+	for _, b := range n.broadcasts {
+		if len(updates) < maxPiggyback {
+			updates = append(updates, b.update)
+			b.remaining--
+		}
+		if b.remaining > 0 {
+			kept = append(kept, b)
+		}
+	}
+	n.broadcasts = kept
+	return updates
+}
+
+// send sends msg to addr with pending updates piggybacked.
+func (n *Node) send(addr string, msg message) error {
+	n.mu.Lock()
+	msg.From = n.addr
+	msg.Updates = append(msg.Updates, n.piggyback()...)
+	n.mu.Unlock()
+	return n.sendRaw(addr, msg)
+}
+
+func (n *Node) sendRaw(addr string, msg message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	_, err = n.conn.WriteToUDP(data, udpAddr)
+	return err
+}
+
+func (n *Node) receive() {
+	defer n.done.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		size, _, err := n.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-n.stop:
+				return
+			default:
+			}
+			slog.Error("[Gossip] read failed", "addr", n.addr, "err", err)
+			continue
+		}
+		var msg message
+		if err := json.Unmarshal(buf[:size], &msg); err != nil {
+			slog.Error("[Gossip] bad packet", "addr", n.addr, "err", err)
+			continue
+		}
+		n.handle(msg)
+	}
+}
+
+func (n *Node) handle(msg message) {
+	n.mu.Lock()
+	for _, u := range msg.Updates {
+		n.apply(u)
+	}
+	n.mu.Unlock()
+
+	switch msg.Type {
+	case msgPing:
+		n.send(msg.From, message{Type: msgAck, Seq: msg.Seq})
+	case msgAck:
+		n.mu.Lock()
+		cb, ok := n.acks[msg.Seq]
+		n.mu.Unlock()
+		if ok {
+			cb()
+		}
+	case msgPingReq:
+		// 替 msg.From 探测 msg.Target，收到 ack 后转告
+		from, seq := msg.From, msg.Seq
+		n.mu.Lock()
+		n.seq++
+		relaySeq := n.seq
+		n.acks[relaySeq] = func() {
+			n.send(from, message{Type: msgAck, Seq: seq})
+		}
+		n.mu.Unlock()
+		time.AfterFunc(n.cfg.ProbeInterval, func() {
+			n.mu.Lock()
+			delete(n.acks, relaySeq)
+			n.mu.Unlock()
+		})
+		n.send(msg.Target, message{Type: msgPing, Seq: relaySeq})
+	case msgJoin:
+		n.mu.Lock()
+		updates := make([]update, 0, len(n.members))
+		for _, m := range n.members {
+			if m.state != stateDead {
+				updates = append(updates, update{Addr: m.addr, Service: m.service, State: m.state, Incarnation: m.incarnation})
+			}
+		}
+		n.mu.Unlock()
+		n.sendRaw(msg.From, message{Type: msgSync, From: n.addr, Updates: updates})
+	case msgSync:
+		n.mu.Lock()
+		for ch := range n.joining {
+			close(ch)
+			delete(n.joining, ch)
+		}
+		n.mu.Unlock()
+	}
+}
+
+// apply merges a piece of gossip into the local view following the SWIM
+// precedence rules. n.mu must be held.
+func (n *Node) apply(u update) {
+	if u.Addr == n.addr {
+		// 别人怀疑或宣告自己下线，提高版本号反驳
+		if u.State != stateAlive && u.Incarnation >= n.self.incarnation && n.self.service != nil {
+			n.self.incarnation = u.Incarnation + 1
+			n.enqueue(n.selfUpdate())
+		}
+		return
+	}
+
+	m, known := n.members[u.Addr]
+	if !known {
+		if u.State == stateDead {
+			return
+		}
+		m = &member{addr: u.Addr, service: u.Service, state: u.State, incarnation: u.Incarnation}
+		if u.State == stateSuspect {
+			m.suspectAt = time.Now()
+		}
+		n.members[u.Addr] = m
+		n.probeOrder = append(n.probeOrder, u.Addr)
+		n.enqueue(u)
+		if m.service != nil {
+			n.hub.Publish(discovery.Event{Type: discovery.Put, Service: *m.service})
+		}
+		return
+	}
+
+	switch u.State {
+	case stateAlive:
+		if u.Incarnation <= m.incarnation {
+			return
+		}
+		wasDead, old := m.state == stateDead, m.service
+		m.state, m.incarnation = stateAlive, u.Incarnation
+		m.service = u.Service
+		n.enqueue(u)
+		switch {
+		case m.service != nil && (wasDead || old == nil || *old != *m.service):
+			n.hub.Publish(discovery.Event{Type: discovery.Put, Service: *m.service})
+		case m.service == nil && old != nil && !wasDead:
+			n.hub.Publish(discovery.Event{Type: discovery.Delete, Service: *old})
+		}
+	case stateSuspect:
+		if m.state == stateDead {
+			return
+		}
+		if (m.state == stateAlive && u.Incarnation >= m.incarnation) || (m.state == stateSuspect && u.Incarnation > m.incarnation) {
+			m.state, m.incarnation = stateSuspect, u.Incarnation
+			m.suspectAt = time.Now()
+			n.enqueue(u)
+		}
+	case stateDead:
+		if m.state == stateDead || u.Incarnation < m.incarnation {
+			return
+		}
+		n.markDead(m, u.Incarnation)
+	}
+}
+
+// markDead n.mu must be held.
+func (n *Node) markDead(m *member, incarnation uint64) {
+	m.state, m.incarnation = stateDead, incarnation
+	m.deadAt = time.Now()
+	n.enqueue(update{Addr: m.addr, State: stateDead, Incarnation: incarnation})
+	if m.service != nil {
+		n.hub.Publish(discovery.Event{Type: discovery.Delete, Service: *m.service})
+	}
+	slog.Info("[Gossip] member dead", "self", n.addr, "member", m.addr)
+}
+
+func (n *Node) probeLoop() {
+	defer n.done.Done()
+	ticker := time.NewTicker(n.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+		n.expireSuspects()
+		n.reapDead()
+		n.probe()
+	}
+}
+
+// expireSuspects declares members dead once their suspicion timed out.
+func (n *Node) expireSuspects() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, m := range n.members {
+		if m.state == stateSuspect && time.Since(m.suspectAt) >= n.cfg.SuspicionTimeout {
+			n.markDead(m, m.incarnation)
+		}
+	}
+}
+
+// reapDead forgets members that have been dead for the dead timeout.
+func (n *Node) reapDead() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for addr, m := range n.members {
+		if m.state == stateDead && time.Since(m.deadAt) >= n.cfg.DeadTimeout {
+			delete(n.members, addr)
+		}
+	}
+}
+
+// nextTarget picks members round-robin in a shuffled order. n.mu must be
+// held.
+func (n *Node) nextTarget() *member {
+	for range 2 {
+		for len(n.probeOrder) > 0 {
+			addr := n.probeOrder[0]
+			n.probeOrder = n.probeOrder[1:]
+			if m, ok := n.members[addr]; ok && m != n.self && m.state != stateDead {
+				return m
+			}
+		}
+		// 一轮结束，重新打乱
+		for addr, m := range n.members {
+			if m != n.self && m.state != stateDead {
+				n.probeOrder = append(n.probeOrder, addr)
+			}
+		}
+		rand.Shuffle(len(n.probeOrder), func(i, j int) {
+			n.probeOrder[i], n.probeOrder[j] = n.probeOrder[j], n.probeOrder[i]
+		})
+	}
+	return nil
+}
+
+// probe runs one protocol period against the next member.
+func (n *Node) probe() {
+	n.mu.Lock()
+	target := n.nextTarget()
+	if target == nil {
+		n.mu.Unlock()
+		return
+	}
+	n.seq++
+	seq := n.seq
+	acked := make(chan struct{}, 1)
+	n.acks[seq] = func() {
+		select {
+		case acked <- struct{}{}:
+		default:
+		}
+	}
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.acks, seq)
+		n.mu.Unlock()
+	}()
+
+	deadline := time.NewTimer(n.cfg.ProbeTimeout)
+	defer deadline.Stop()
+	n.send(target.addr, message{Type: msgPing, Seq: seq})
+	select {
+	case <-acked:
+		return
+	case <-deadline.C:
+	case <-n.stop:
+		return
+	}
+
+	// 直接探测超时，请其他节点间接探测
+	n.mu.Lock()
+	var helpers []*member
+	for _, m := range n.aliveLocked() {
+		if m != target && m.state == stateAlive {
+			helpers = append(helpers, m)
+		}
+	}
+	n.mu.Unlock()
+	rand.Shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	for _, h := range helpers[:min(len(helpers), n.cfg.IndirectChecks)] {
+		n.send(h.addr, message{Type: msgPingReq, Seq: seq, Target: target.addr})
+	}
+
+	remaining := time.NewTimer(n.cfg.ProbeInterval - n.cfg.ProbeTimeout)
+	defer remaining.Stop()
+	select {
+	case <-acked:
+		return
+	case <-remaining.C:
+	case <-n.stop:
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if target.state == stateAlive {
+		slog.Info("[Gossip] suspect member", "self", n.addr, "member", target.addr)
+		n.apply(update{Addr: target.addr, State: stateSuspect, Incarnation: target.incarnation})
+	}
+}
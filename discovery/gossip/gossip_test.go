@@ -0,0 +1,212 @@
+package gossip
+
+import (
+	"context"
+	"kunCache/discovery"
+	"net"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestNode(t *testing.T, addr string) *Node {
+	t.Helper()
+	n, err := New(Config{
+		BindAddr:         "127.0.0.1:0",
+		ProbeInterval:    50 * time.Millisecond,
+		ProbeTimeout:     20 * time.Millisecond,
+		SuspicionTimeout: 200 * time.Millisecond,
+		DeadTimeout:      300 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Close() })
+	if err := n.Register(context.Background(), &discovery.Service{Addr: addr, Protocol: "http"}); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func listAddrs(n *Node) []string {
+	services, _ := n.List(context.Background())
+	var addrs []string
+	for _, s := range services {
+		addrs = append(addrs, s.Addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMembership(t *testing.T) {
+	a := newTestNode(t, "a:1")
+	b := newTestNode(t, "b:1")
+	c := newTestNode(t, "c:1")
+
+	events, _ := a.Watch(context.Background())
+
+	// c 只认识 b，需要通过 gossip 得知 a
+	if err := b.Join(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Join(b.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	all := []string{"a:1", "b:1", "c:1"}
+	for _, n := range []*Node{a, b, c} {
+		waitFor(t, func() bool { return equal(listAddrs(n), all) })
+	}
+
+	// c 异常退出，其余节点应探测到并宣告下线
+	c.Close()
+	for _, n := range []*Node{a, b} {
+		waitFor(t, func() bool { return equal(listAddrs(n), []string{"a:1", "b:1"}) })
+	}
+
+	var deleted bool
+	for !deleted {
+		select {
+		case e := <-events:
+			deleted = e.Type == discovery.Delete && e.Service.Addr == "c:1"
+		case <-time.After(time.Second):
+			t.Fatal("no delete event for c")
+		}
+	}
+}
+
+func TestDeregister(t *testing.T) {
+	a := newTestNode(t, "a:1")
+	b := newTestNode(t, "b:1")
+	if err := b.Join(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return equal(listAddrs(a), []string{"a:1", "b:1"}) })
+
+	b.Deregister(context.Background(), nil)
+	waitFor(t, func() bool { return equal(listAddrs(a), []string{"a:1"}) })
+}
+
+func TestRefuteSuspicion(t *testing.T) {
+	a := newTestNode(t, "a:1")
+	b := newTestNode(t, "b:1")
+	if err := b.Join(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return equal(listAddrs(a), []string{"a:1", "b:1"}) })
+
+	// a 错误地怀疑 b，b 仍然存活应能反驳
+	a.mu.Lock()
+	m := a.members[b.Addr()]
+	a.apply(update{Addr: m.addr, State: stateSuspect, Incarnation: m.incarnation})
+	a.mu.Unlock()
+
+	waitFor(t, func() bool {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.members[b.Addr()].state == stateAlive
+	})
+	time.Sleep(300 * time.Millisecond)
+	if got := listAddrs(a); !equal(got, []string{"a:1", "b:1"}) {
+		t.Fatalf("members = %v", got)
+	}
+}
+
+func TestRetryJoin(t *testing.T) {
+	// 先占用一个地址再释放，种子节点稍后在这个地址启动
+	seed := newTestNode(t, "a:1")
+	seedAddr := seed.Addr()
+	seed.Close()
+
+	b := newTestNode(t, "b:1")
+	if err := b.Join(seedAddr); err == nil {
+		t.Fatal("Join succeeded without a seed answering")
+	}
+	b.RetryJoin(seedAddr)
+	time.Sleep(100 * time.Millisecond)
+
+	a, err := New(Config{BindAddr: seedAddr, ProbeInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	if err := a.Register(context.Background(), &discovery.Service{Addr: "a:1", Protocol: "http"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*Node{a, b} {
+		waitFor(t, func() bool { return equal(listAddrs(n), []string{"a:1", "b:1"}) })
+	}
+}
+
+func TestAdvertiseAddr(t *testing.T) {
+	// 监听 0.0.0.0 时两个节点的本地地址只有端口不同，必须靠 AdvertiseAddr 区分
+	var nodes []*Node
+	for _, addr := range []string{"a:1", "b:1"} {
+		n, err := New(Config{BindAddr: "0.0.0.0:0", ProbeInterval: 50 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.Close()
+		_, port, _ := net.SplitHostPort(n.conn.LocalAddr().String())
+		n, err = New(Config{
+			BindAddr:      "0.0.0.0:" + port,
+			AdvertiseAddr: "127.0.0.1:" + port,
+			ProbeInterval: 50 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { n.Close() })
+		if err := n.Register(context.Background(), &discovery.Service{Addr: addr, Protocol: "http"}); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, n)
+	}
+	a, b := nodes[0], nodes[1]
+	if err := b.Join(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range nodes {
+		waitFor(t, func() bool { return equal(listAddrs(n), []string{"a:1", "b:1"}) })
+	}
+}
+
+func TestReapDead(t *testing.T) {
+	a := newTestNode(t, "a:1")
+	b := newTestNode(t, "b:1")
+	if err := b.Join(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return equal(listAddrs(a), []string{"a:1", "b:1"}) })
+
+	// 下线的节点超过 DeadTimeout 后被遗忘
+	b.Close()
+	waitFor(t, func() bool {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		_, ok := a.members[b.Addr()]
+		return !ok
+	})
+}
@@ -0,0 +1,8 @@
+package discovery
+
+import "kunCache/internal/hub"
+
+// Hub fans membership events out to any number of watchers. Publish never
+// blocks: every watcher has its own unbounded queue, so a slow watcher
+// cannot stall the registry. The zero value is ready to use.
+type Hub = hub.Hub[Event]
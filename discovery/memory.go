@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultMemory is the process-wide registry selected by the "memory"
+// discovery setting.
+var DefaultMemory = NewMemory()
+
+// Memory is an in-process registry, mainly for tests: several nodes in one
+// process share a Memory and see each other's registrations.
+type Memory struct {
+	mu       sync.Mutex
+	services map[string]*Service
+	hub      Hub
+}
+
+// NewMemory creates an empty registry.
+func NewMemory() *Memory {
+	return &Memory{
+		services: make(map[string]*Service),
+	}
+}
+
+func (m *Memory) Register(ctx context.Context, service *Service) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := *service
+	m.services[s.Addr] = &s
+	m.hub.Publish(Event{Type: Put, Service: s})
+	return nil
+}
+
+func (m *Memory) Deregister(ctx context.Context, service *Service) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.services[service.Addr]; !ok {
+		return nil
+	}
+	delete(m.services, service.Addr)
+	m.hub.Publish(Event{Type: Delete, Service: *service})
+	return nil
+}
+
+func (m *Memory) List(ctx context.Context) ([]*Service, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	services := make([]*Service, 0, len(m.services))
+	for _, s := range m.services {
+		c := *s
+		services = append(services, &c)
+	}
+	return services, nil
+}
+
+func (m *Memory) Watch(ctx context.Context) (<-chan Event, error) {
+	return m.hub.Watch(ctx), nil
+}
+
+func (m *Memory) Close() error { return nil }
@@ -0,0 +1,32 @@
+package discovery
+
+import "context"
+
+// Static is a fixed list of services, e.g. from the config file. Register
+// and Deregister are no-ops and Watch never reports a change.
+type Static struct {
+	services []*Service
+}
+
+// NewStatic creates a Static discovery for services.
+func NewStatic(services ...*Service) *Static {
+	return &Static{services: services}
+}
+
+func (s *Static) Register(ctx context.Context, service *Service) error   { return nil }
+func (s *Static) Deregister(ctx context.Context, service *Service) error { return nil }
+
+func (s *Static) Watch(ctx context.Context) (<-chan Event, error) {
+	events := make(chan Event)
+	go func() {
+		<-ctx.Done()
+		close(events)
+	}()
+	return events, nil
+}
+
+func (s *Static) List(ctx context.Context) ([]*Service, error) {
+	return s.services, nil
+}
+
+func (s *Static) Close() error { return nil }
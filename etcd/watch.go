@@ -0,0 +1,144 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	watchMinBackoff = 100 * time.Millisecond
+	watchMaxBackoff = 10 * time.Second
+)
+
+// WatchPrefix reports the changes of the keys under prefix made after it
+// was called, until ctx is done. A broken watch resumes after the last
+// revision seen, retrying with backoff while etcd is unreachable; if that
+// revision was compacted away, the keys are read again and the
+// differences reported as puts and deletes, so no change is missed.
+func WatchPrefix(ctx context.Context, cli *clientv3.Client, prefix string) (<-chan *clientv3.Event, error) {
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	w := &prefixWatch{cli: cli, prefix: prefix, rev: resp.Header.Revision, known: make(map[string]int64)}
+	for _, kv := range resp.Kvs {
+		w.known[string(kv.Key)] = kv.ModRevision
+	}
+	events := make(chan *clientv3.Event)
+	go w.run(ctx, events)
+	return events, nil
+}
+
+// prefixWatch 记录已经报告到的 revision 和每个 key 的版本，用于断线续传和压缩后的全量对比
+type prefixWatch struct {
+	cli    *clientv3.Client
+	prefix string
+	rev    int64
+	known  map[string]int64
+}
+
+func (w *prefixWatch) run(ctx context.Context, events chan<- *clientv3.Event) {
+	defer close(events)
+	backoff := watchMinBackoff
+	for {
+		progressed, err := w.watch(ctx, events)
+		if errors.Is(err, errCompacted) {
+			if err = w.resync(ctx, events); err == nil {
+				backoff = watchMinBackoff
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if progressed {
+			backoff = watchMinBackoff
+		}
+		slog.Warn("[Etcd] watch broken, resuming", "prefix", w.prefix, "rev", w.rev, "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, watchMaxBackoff)
+	}
+}
+
+// errCompacted 表示续传的 revision 已被压缩
+var errCompacted = errors.New("watch revision compacted")
+
+// watch 从 w.rev 之后开始监听，直到 watch 断开。progressed 表示期间收到过正常应答
+func (w *prefixWatch) watch(ctx context.Context, events chan<- *clientv3.Event) (progressed bool, err error) {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wch := w.cli.Watch(clientv3.WithRequireLeader(wctx), w.prefix, clientv3.WithPrefix(), clientv3.WithRev(w.rev+1))
+	for resp := range wch {
+		if resp.CompactRevision != 0 {
+			return progressed, errCompacted
+		}
+		if err := resp.Err(); err != nil {
+			return progressed, err
+		}
+		progressed = true
+		for _, ev := range resp.Events {
+			if !w.send(ctx, events, ev) {
+				return progressed, ctx.Err()
+			}
+			w.rev = ev.Kv.ModRevision
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return progressed, err
+	}
+	return progressed, errors.New("watch channel closed")
+}
+
+// resync 重新读取所有 key，报告与已知状态的差异
+func (w *prefixWatch) resync(ctx context.Context, events chan<- *clientv3.Event) error {
+	resp, err := w.cli.Get(ctx, w.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	slog.Info("[Etcd] watch revision compacted, resyncing", "prefix", w.prefix, "rev", w.rev, "now", resp.Header.Revision)
+	current := make(map[string]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		current[string(kv.Key)] = true
+		if w.known[string(kv.Key)] == kv.ModRevision {
+			continue
+		}
+		if !w.send(ctx, events, &clientv3.Event{Type: clientv3.EventTypePut, Kv: kv}) {
+			return ctx.Err()
+		}
+	}
+	for key := range w.known {
+		if current[key] {
+			continue
+		}
+		ev := &clientv3.Event{Type: clientv3.EventTypeDelete, Kv: &mvccpb.KeyValue{Key: []byte(key), ModRevision: resp.Header.Revision}}
+		if !w.send(ctx, events, ev) {
+			return ctx.Err()
+		}
+	}
+	w.rev = resp.Header.Revision
+	return nil
+}
+
+// send 报告一个事件并更新已知状态，ctx 结束时返回 false
+func (w *prefixWatch) send(ctx context.Context, events chan<- *clientv3.Event, ev *clientv3.Event) bool {
+	select {
+	case events <- ev:
+	case <-ctx.Done():
+		return false
+	}
+	if ev.Type == clientv3.EventTypeDelete {
+		delete(w.known, string(ev.Kv.Key))
+	} else {
+		w.known[string(ev.Kv.Key)] = ev.Kv.ModRevision
+	}
+	return true
+}
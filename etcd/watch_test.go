@@ -0,0 +1,114 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"kunCache/internal/etcdtest"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// next 读取下一个事件，格式为 "PUT a=1" 或 "DELETE a"
+func next(t *testing.T, events <-chan *clientv3.Event) string {
+	t.Helper()
+	select {
+	case ev := <-events:
+		if ev.Type == clientv3.EventTypeDelete {
+			return fmt.Sprintf("DELETE %s", ev.Kv.Key)
+		}
+		return fmt.Sprintf("PUT %s=%s", ev.Kv.Key, ev.Kv.Value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+		return ""
+	}
+}
+
+func TestWatchPrefix(t *testing.T) {
+	cli, err := NewClient([]string{etcdtest.Start(t)}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli.Put(ctx, "p/old", "0")
+	events, err := WatchPrefix(ctx, cli, "p/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Put(ctx, "p/a", "1")
+	cli.Put(ctx, "other", "x")
+	cli.Delete(ctx, "p/old")
+	for _, want := range []string{"PUT p/a=1", "DELETE p/old"} {
+		if got := next(t, events); got != want {
+			t.Fatalf("event = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestWatchResume(t *testing.T) {
+	cli, err := NewClient([]string{etcdtest.Start(t)}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli.Put(ctx, "p/a", "1")
+	resp, _ := cli.Put(ctx, "p/b", "1")
+	seen := resp.Header.Revision
+	known := func() map[string]int64 {
+		r, _ := cli.Get(ctx, "p/", clientv3.WithPrefix())
+		m := make(map[string]int64)
+		for _, kv := range r.Kvs {
+			m[string(kv.Key)] = kv.ModRevision
+		}
+		return m
+	}()
+
+	// watch 断开期间的变化在续传时补上
+	cli.Put(ctx, "p/c", "1")
+	cli.Delete(ctx, "p/a")
+	w := &prefixWatch{cli: cli, prefix: "p/", rev: seen, known: copyMap(known)}
+	events := make(chan *clientv3.Event)
+	wctx, stop := context.WithCancel(ctx)
+	go w.run(wctx, events)
+	for _, want := range []string{"PUT p/c=1", "DELETE p/a"} {
+		if got := next(t, events); got != want {
+			t.Fatalf("resumed event = %s, want %s", got, want)
+		}
+	}
+	stop()
+
+	// 续传的 revision 被压缩后全量对比
+	cli.Put(ctx, "p/b", "2")
+	last, _ := cli.Put(ctx, "p/d", "1")
+	if _, err := cli.Compact(ctx, last.Header.Revision); err != nil {
+		t.Fatal(err)
+	}
+	w = &prefixWatch{cli: cli, prefix: "p/", rev: seen, known: copyMap(known)}
+	events = make(chan *clientv3.Event)
+	go w.run(ctx, events)
+	for _, want := range []string{"PUT p/b=2", "PUT p/c=1", "PUT p/d=1", "DELETE p/a"} {
+		if got := next(t, events); got != want {
+			t.Fatalf("resync event = %s, want %s", got, want)
+		}
+	}
+	// 之后继续监听
+	cli.Put(ctx, "p/e", "1")
+	if got := next(t, events); got != "PUT p/e=1" {
+		t.Fatalf("event after resync = %s", got)
+	}
+}
+
+func copyMap(m map[string]int64) map[string]int64 {
+	c := make(map[string]int64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
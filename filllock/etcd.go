@@ -0,0 +1,199 @@
+package filllock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kunCache/etcd"
+	"kunCache/peer"
+	"log/slog"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Etcd is a FillLock shared by every node using the same etcd cluster and
+// prefix. The node filling a key holds prefix+"lock/"+group+"/"+key under
+// a lease, so the lock is released if it crashes, and stores the result
+// under prefix+"result/"+group+"/"+key for at most ttl, where the nodes
+// that were waiting, and those missing on the key shortly after, find it.
+// Only values and ErrNotFound are shared: after any other error the lock
+// is released without a result and the next node tries the key itself.
+type Etcd struct {
+	cli    *clientv3.Client
+	prefix string
+	ttl    int64 // 租约秒数
+	// timeout 每次 etcd 请求的超时时间，etcd 不可用时尽快放弃加锁
+	timeout time.Duration
+}
+
+// result 是保存在 etcd 中的填充结果
+type result struct {
+	Value []byte      `json:"value,omitempty"`
+	Error *peer.Error `json:"error,omitempty"`
+}
+
+// NewEtcd connects to etcd. Locks and results are stored under prefix and
+// expire after ttl. Requests to etcd give up after dialTimeout, and Fill
+// then fails with peer.ErrLockUnavailable.
+func NewEtcd(endpoints []string, dialTimeout time.Duration, prefix string, ttl time.Duration) (*Etcd, error) {
+	cli, err := etcd.NewClient(endpoints, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("create etcd client: %w", err)
+	}
+	return &Etcd{cli: cli, prefix: prefix, ttl: max(int64(ttl/time.Second), 1), timeout: dialTimeout}, nil
+}
+
+func (e *Etcd) Fill(ctx context.Context, group, key string, fill func() ([]byte, error)) ([]byte, error) {
+	lockKey := e.prefix + "lock/" + group + "/" + key
+	resultKey := e.prefix + "result/" + group + "/" + key
+	for {
+		// 刚完成的填充结果可以直接使用
+		if r, ok, err := e.result(ctx, resultKey); err != nil {
+			return nil, err
+		} else if ok {
+			return r.Value, r.err()
+		}
+
+		lease, held, rev, err := e.tryLock(ctx, lockKey)
+		if err != nil {
+			return nil, unavailable(err)
+		}
+		if held {
+			return e.lead(lease, lockKey, resultKey, fill)
+		}
+
+		// 其他节点正在填充，等它释放锁后读取结果；它失败或崩溃时没有结果，重新竞争
+		if err := e.waitReleased(ctx, lockKey, rev); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tryLock 在 lockKey 不存在时以新租约创建它。没有拿到锁时返回当时的 revision
+func (e *Etcd) tryLock(ctx context.Context, lockKey string) (lease clientv3.LeaseID, held bool, rev int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	grant, err := e.cli.Grant(ctx, e.ttl)
+	if err != nil {
+		return 0, false, 0, err
+	}
+	resp, err := e.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(lockKey), "=", 0)).
+		Then(clientv3.OpPut(lockKey, "", clientv3.WithLease(grant.ID))).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		e.revoke(grant.ID)
+	}
+	if err != nil {
+		return 0, false, 0, err
+	}
+	return grant.ID, resp.Succeeded, resp.Header.Revision, nil
+}
+
+// lead 持有锁执行 fill。成功或 key 不存在时把结果挂在锁的租约上保存到 resultKey 并删除锁，
+// 停止续约后结果随租约在 ttl 内过期；其他错误是暂时的，不共享，直接撤销租约释放锁
+func (e *Etcd) lead(lease clientv3.LeaseID, lockKey, resultKey string, fill func() ([]byte, error)) ([]byte, error) {
+	keepCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	// 填充可能比租约更久，续约直到完成
+	if ch, err := e.cli.KeepAlive(keepCtx, lease); err == nil {
+		go func() {
+			for range ch {
+			}
+		}()
+	}
+
+	value, err := fill()
+	stop()
+	if err != nil && !errors.Is(err, peer.ErrNotFound) {
+		e.revoke(lease)
+		return value, err
+	}
+
+	r := result{Value: value}
+	if err != nil {
+		r = result{Error: peer.NewError(err)}
+	}
+	data, _ := json.Marshal(r)
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	if _, serr := e.cli.Txn(ctx).
+		Then(clientv3.OpPut(resultKey, string(data), clientv3.WithLease(lease)), clientv3.OpDelete(lockKey)).
+		Commit(); serr != nil {
+		slog.Warn("[FillLock] store result", "key", resultKey, "err", serr)
+		e.revoke(lease)
+	}
+	return value, err
+}
+
+// Forget deletes the result shared for group/key, so the next Fill calls
+// fill again instead of returning a value that was just overwritten.
+func (e *Etcd) Forget(ctx context.Context, group, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	if _, err := e.cli.Delete(ctx, e.prefix+"result/"+group+"/"+key); err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+// waitReleased 等待 lockKey 在 rev 之后被删除
+func (e *Etcd) waitReleased(ctx context.Context, lockKey string, rev int64) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for resp := range e.cli.Watch(clientv3.WithRequireLeader(wctx), lockKey, clientv3.WithRev(rev+1)) {
+		if err := resp.Err(); err != nil {
+			return unavailable(err)
+		}
+		for _, ev := range resp.Events {
+			if ev.Type == clientv3.EventTypeDelete {
+				return nil
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return unavailable(fmt.Errorf("watch %s closed", lockKey))
+}
+
+// result 读取保存的填充结果
+func (e *Etcd) result(ctx context.Context, resultKey string) (result, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	resp, err := e.cli.Get(ctx, resultKey)
+	if err != nil {
+		return result{}, false, unavailable(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return result{}, false, nil
+	}
+	var r result
+	if err := json.Unmarshal(resp.Kvs[0].Value, &r); err != nil {
+		return result{}, false, unavailable(fmt.Errorf("bad fill result %s: %w", resultKey, err))
+	}
+	return r, true, nil
+}
+
+func (r result) err() error {
+	if r.Error == nil {
+		return nil
+	}
+	return r.Error
+}
+
+func (e *Etcd) revoke(lease clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	e.cli.Revoke(ctx, lease)
+}
+
+func (e *Etcd) Close() error {
+	return e.cli.Close()
+}
+
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %w", peer.ErrLockUnavailable, err)
+}
@@ -0,0 +1,89 @@
+package filllock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kunCache/internal/etcdtest"
+	"kunCache/peer"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEtcd(t *testing.T) {
+	endpoint := etcdtest.Start(t)
+	var nodes [2]*Etcd
+	for i := range nodes {
+		l, err := NewEtcd([]string{endpoint}, 5*time.Second, "fills/", 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		nodes[i] = l
+	}
+	ctx := context.Background()
+	var fills atomic.Int32
+	fillWith := func(data []byte, err error) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			fills.Add(1)
+			time.Sleep(50 * time.Millisecond)
+			return data, err
+		}
+	}
+
+	// 两个节点同时未命中，只有一个调用 fill
+	var wg sync.WaitGroup
+	for _, l := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data, err := l.Fill(ctx, "scores", "Tom", fillWith([]byte("630"), nil)); err != nil || string(data) != "630" {
+				t.Errorf("Fill = %q, %v", data, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := fills.Load(); n != 1 {
+		t.Fatalf("fills = %d, want 1", n)
+	}
+	// 稍后未命中的节点直接使用共享的结果，Forget 之后重新加载
+	if data, err := nodes[1].Fill(ctx, "scores", "Tom", fillWith([]byte("631"), nil)); err != nil || string(data) != "630" || fills.Load() != 1 {
+		t.Fatalf("Fill = %q, %v after %d fills; want the shared result", data, err, fills.Load())
+	}
+	if err := nodes[0].Forget(ctx, "scores", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := nodes[1].Fill(ctx, "scores", "Tom", fillWith([]byte("631"), nil)); err != nil || string(data) != "631" || fills.Load() != 2 {
+		t.Fatalf("Fill after Forget = %q, %v after %d fills; want a new fill", data, err, fills.Load())
+	}
+
+	// key 不存在的结果共享，其他错误不共享
+	fills.Store(0)
+	notFound := fmt.Errorf("%w: Jack", peer.ErrNotFound)
+	if _, err := nodes[0].Fill(ctx, "scores", "Jack", fillWith(nil, notFound)); !errors.Is(err, peer.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+	if _, err := nodes[1].Fill(ctx, "scores", "Jack", fillWith([]byte("x"), nil)); !errors.Is(err, peer.ErrNotFound) || fills.Load() != 1 {
+		t.Fatalf("err = %v after %d fills; want the shared ErrNotFound", err, fills.Load())
+	}
+	errDown := errors.New("db is down")
+	if _, err := nodes[0].Fill(ctx, "scores", "Sam", fillWith(nil, errDown)); !errors.Is(err, errDown) {
+		t.Fatalf("err = %v, want %v", err, errDown)
+	}
+	if data, err := nodes[1].Fill(ctx, "scores", "Sam", fillWith([]byte("567"), nil)); err != nil || string(data) != "567" || fills.Load() != 3 {
+		t.Fatalf("Fill = %q, %v after %d fills; want a new fill after a transient error", data, err, fills.Load())
+	}
+}
+
+func TestEtcdUnavailable(t *testing.T) {
+	l, err := NewEtcd([]string{"127.0.0.1:1"}, 100*time.Millisecond, "fills/", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.Fill(context.Background(), "scores", "Tom", nil); !errors.Is(err, peer.ErrLockUnavailable) {
+		t.Fatalf("err = %v, want ErrLockUnavailable", err)
+	}
+}
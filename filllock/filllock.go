@@ -0,0 +1,26 @@
+// Package filllock provides peer.FillLock implementations, so that when
+// several nodes miss on the same key, for instance while the ring changes
+// or its owner is unreachable, only one of them calls the Getter and the
+// others wait for its result.
+package filllock
+
+import (
+	"fmt"
+	"kunCache/conf"
+	"kunCache/peer"
+	"time"
+)
+
+// New returns the FillLock selected by c.FillLock: "etcd" or "memory". It
+// returns nil when no fill lock is configured.
+func New(c *conf.Config) (peer.FillLock, error) {
+	switch c.FillLock {
+	case "":
+		return nil, nil
+	case "etcd":
+		return NewEtcd(c.Endpoints, time.Duration(c.DialTimeout)*time.Second, c.FillLockPrefix, time.Duration(c.FillLockTTL)*time.Second)
+	case "memory":
+		return DefaultMemory, nil
+	}
+	return nil, fmt.Errorf("unknown fill lock %q", c.FillLock)
+}
@@ -0,0 +1,67 @@
+package filllock
+
+import (
+	"context"
+	"errors"
+	"kunCache/conf"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	var fills atomic.Int32
+	release := make(chan struct{})
+	fill := func() ([]byte, error) {
+		fills.Add(1)
+		<-release
+		return []byte("630"), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := m.Fill(context.Background(), "scores", "Tom", fill)
+			if err != nil || string(data) != "630" {
+				t.Errorf("Fill = %q, %v", data, err)
+			}
+		}()
+	}
+	// 其他 key 不等待
+	if _, err := m.Fill(context.Background(), "scores", "Jack", func() ([]byte, error) { return nil, nil }); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := fills.Load(); n != 1 {
+		t.Fatalf("fills = %d, want 1", n)
+	}
+
+	// 等待者可以放弃等待
+	block := make(chan struct{})
+	defer close(block)
+	go m.Fill(context.Background(), "scores", "Sam", func() ([]byte, error) { <-block; return nil, nil })
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.Fill(ctx, "scores", "Sam", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if l, err := New(&conf.Config{}); l != nil || err != nil {
+		t.Fatalf("New without fill_lock = %v, %v", l, err)
+	}
+	if l, err := New(&conf.Config{FillLock: "memory"}); l != DefaultMemory || err != nil {
+		t.Fatalf("New(memory) = %v, %v", l, err)
+	}
+	if _, err := New(&conf.Config{FillLock: "zk"}); err == nil {
+		t.Fatal("unknown fill lock accepted")
+	}
+}
@@ -0,0 +1,32 @@
+package filllock
+
+import (
+	"context"
+	"kunCache/singleflight"
+)
+
+// DefaultMemory is the process-wide lock selected by the "memory" fill_lock
+// setting.
+var DefaultMemory = NewMemory()
+
+// Memory is an in-process FillLock, mainly for tests: several nodes in one
+// process share a Memory and wait for each other's fills. Unlike Etcd it
+// does not keep results after the fill returns.
+type Memory struct {
+	flight singleflight.Group[string, []byte]
+}
+
+// NewMemory creates a lock no fill is holding.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Fill(ctx context.Context, group, key string, fill func() ([]byte, error)) ([]byte, error) {
+	data, err, _ := m.flight.DoContext(ctx, group+"/"+key, fill)
+	return data, err
+}
+
+// Forget does nothing: Memory keeps no results.
+func (m *Memory) Forget(ctx context.Context, group, key string) error {
+	return nil
+}
@@ -1,16 +1,29 @@
 package gcache
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"kunCache/cache"
-	"kunCache/conf"
 	"kunCache/peer"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"kunCache/singleflight"
 )
 
+// ErrNotFound is returned, possibly wrapped, by a Getter when the key does
+// not exist in the data source, and by Get for such keys. Remote peers
+// report it as well, so a missing key is not loaded again locally.
+var ErrNotFound = peer.ErrNotFound
+
+// ErrLoader wraps the other errors of a Getter, so callers and remote
+// peers can tell a failed data source from a failed peer.
+var ErrLoader = peer.ErrLoader
+
 // A Getter loads data for a key.
 type Getter[K comparable, V any] interface {
 	Get(key K) (V, error)
@@ -24,46 +37,75 @@ func (f GetterFunc[K, V]) Get(key K) (V, error) {
 	return f(key)
 }
 
+// A TTLGetter is a Getter that also tells how long each value stays fresh,
+// e.g. from the Cache-Control header of an HTTP origin. Groups cache the
+// value for ttl instead of their expiration; zero keeps the latter and a
+// negative ttl serves the value without caching it.
+type TTLGetter[K comparable, V any] interface {
+	Getter[K, V]
+	GetWithTTL(key K) (value V, ttl time.Duration, err error)
+}
+
 // 分组cache
 type Group[K comparable, V any] struct {
 	name      string
 	getter    Getter[K, V]
 	mainCache *cache.Cache[K, V]
+	//不存在的 key，开启负缓存时使用
+	misses *cache.Cache[K, struct{}]
 	//分布式节点
 	peers peer.Picker[K, V]
 	//并发请求同一个key只执行一次
 	loader *singleflight.Group[K, V]
+	//限制同时执行的 Getter 调用数，为 nil 不限制
+	loadSlots chan struct{}
+	//Getter 调用限速，为 nil 不限速
+	limiter *tokenBucket
+	opts    options
+	//新缓存条目的有效期，可在运行时修改
+	expiration atomic.Int64
+	//远端请求延迟统计，用于自适应对冲
+	peerLatency latencies
+	//哈希环变化后延迟执行的迁移任务
+	handoffMu    sync.Mutex
+	handoffTimer *time.Timer
+	closed       bool
+	//正在后台刷新的 key
+	refreshMu  sync.Mutex
+	refreshing map[K]struct{}
+	stats      stats
 }
 
-var (
-	mu     sync.RWMutex
-	groups = make(map[string]any)
-)
-
-// NewGroup create a new instance of Group
-func NewGroup[K comparable, V any](name string, maxEntries int64, getter Getter[K, V]) *Group[K, V] {
+// NewGroup creates a group and registers it under name. It fails with
+// ErrGroupExists if the name is taken; the existing group must be removed
+// with DeleteGroup first.
+func NewGroup[K comparable, V any](name string, maxEntries int64, getter Getter[K, V], opts ...Option) (*Group[K, V], error) {
 	if getter == nil {
 		panic("nil Getter")
 	}
-	mu.Lock()
-	defer mu.Unlock()
 	g := &Group[K, V]{
 		name:      name,
 		getter:    getter,
 		mainCache: cache.New[K, V](maxEntries, nil),
 		loader:    &singleflight.Group[K, V]{},
 	}
-	groups[name] = g
-	return g
-}
-
-// GetGroup returns the named group previously created with NewGroup, or
-// nil if there's no such group.
-func GetGroup[K comparable, V any](name string) *Group[K, V] {
-	mu.RLock()
-	g := groups[name]
-	mu.RUnlock()
-	return g.(*Group[K, V])
+	for _, opt := range opts {
+		opt(&g.opts)
+	}
+	g.expiration.Store(int64(g.opts.expiration))
+	if g.opts.negativeTTL > 0 {
+		g.misses = cache.New[K, struct{}](maxEntries, nil)
+	}
+	if g.opts.maxLoads > 0 {
+		g.loadSlots = make(chan struct{}, g.opts.maxLoads)
+	}
+	if g.opts.loadRate > 0 {
+		g.limiter = newTokenBucket(g.opts.loadRate, max(g.opts.loadBurst, 1))
+	}
+	if err := register(g); err != nil {
+		return nil, err
+	}
+	return g, nil
 }
 
 // RegisterServer registers a PeerPicker for choosing remote peer
@@ -73,36 +115,154 @@ func (g *Group[K, V]) RegisterServer(peers peer.Picker[K, V]) {
 		return
 	}
 	g.peers = peers
+	if r, ok := peers.(peer.Rebalancer[K, V]); ok && g.opts.handoffDelay > 0 {
+		r.OnRingChange(g.scheduleHandoff)
+	}
 }
 
 // Get value for a key from cache
 // 没有缓存会调用回调函数加载
 func (g *Group[K, V]) Get(key K) (V, error) {
-	if v, ok := g.mainCache.Get(key); ok {
-		slog.Info("[GCache] hit")
-		// fmt.Println("cache", v)
-		return v, nil
+	value, _, err := g.GetWithStaleness(key)
+	return value, err
+}
+
+// GetWithTTL is like Get but also reports how long the value stays fresh
+// in g, so a Group is a TTLGetter and another group in front of it expires
+// the value no later than g does. The ttl is 0 when g keeps the value
+// forever or did not cache it, e.g. it came from a peer, and negative for
+// a stale value, which must not be cached again.
+func (g *Group[K, V]) GetWithTTL(key K) (V, time.Duration, error) {
+	value, staleness, err := g.GetWithStaleness(key)
+	if err != nil || staleness > 0 {
+		return value, -1, err
+	}
+	_, expires, ok := g.mainCache.GetStale(key, 0)
+	if !ok || expires == 0 {
+		return value, 0, nil
+	}
+	// 刚好在两次读取之间过期时同样不再缓存
+	ttl := time.Until(time.Unix(0, expires))
+	if ttl <= 0 {
+		ttl = -1
+	}
+	return value, ttl, nil
+}
+
+// GetWithStaleness is like Get but also reports how long ago the returned
+// value expired, 0 for a fresh value. Expired values are only returned
+// with WithStaleWhileRevalidate, or with WithServeStaleOnError when
+// loading the key failed.
+func (g *Group[K, V]) GetWithStaleness(key K) (V, time.Duration, error) {
+	g.stats.gets.Add(1)
+	//加载失败时使用的旧值
+	var (
+		stale    V
+		staleAge time.Duration
+		hasStale bool
+	)
+	if v, expires, ok := g.mainCache.GetStale(key, max(g.opts.staleGrace, g.opts.maxStale)); ok {
+		// left 剩余有效期，过期后为负
+		var left, age time.Duration
+		if expires != 0 {
+			left = time.Until(time.Unix(0, expires))
+			age = max(-left, 0)
+		}
+		if age > g.opts.staleGrace {
+			// 过期超过 staleGrace，只在加载失败时返回
+			stale, staleAge, hasStale = v, age, true
+		} else {
+			if expires != 0 && g.needsRefresh(left) {
+				g.refresh(key)
+			}
+			if age > 0 {
+				g.stats.staleHits.Add(1)
+				slog.Info("[GCache] stale hit", "key", key)
+				return v, age, nil
+			}
+			g.stats.cacheHits.Add(1)
+			slog.Info("[GCache] hit")
+			// fmt.Println("cache", v)
+			return v, 0, nil
+		}
 	}
+	if g.misses != nil {
+		if _, ok := g.misses.Get(key); ok {
+			g.stats.negativeHits.Add(1)
+			var zero V
+			return zero, 0, fmt.Errorf("%w: %v", ErrNotFound, key)
+		}
+	}
+
+	value, err := g.load(key)
+	if err == nil || !hasStale {
+		return value, 0, err
+	}
+	if errors.Is(err, ErrNotFound) {
+		// 数据源中已经删除，旧值不能再用
+		g.mainCache.Remove(key)
+		return value, 0, err
+	}
+	g.stats.staleServes.Add(1)
+	slog.Warn("[GCache] serving stale value after load failed", "key", key, "staleness", staleAge, "err", err)
+	return stale, staleAge, nil
+}
+
+// needsRefresh 剩余有效期为 left 的条目被读取时是否需要后台刷新
+func (g *Group[K, V]) needsRefresh(left time.Duration) bool {
+	if left <= 0 {
+		// 只有开启 staleGrace 时才会读到过期条目
+		return true
+	}
+	lifetime := time.Duration(g.expiration.Load())
+	return g.opts.refreshAhead > 0 && lifetime > 0 && float64(left) < g.opts.refreshAhead*float64(lifetime)
+}
+
+// refresh 在后台重新加载 key，同一个 key 同时只有一个刷新
+func (g *Group[K, V]) refresh(key K) {
+	g.refreshMu.Lock()
+	if _, ok := g.refreshing[key]; ok {
+		g.refreshMu.Unlock()
+		return
+	}
+	if g.refreshing == nil {
+		g.refreshing = make(map[K]struct{})
+	}
+	g.refreshing[key] = struct{}{}
+	g.refreshMu.Unlock()
 
-	return g.load(key)
+	g.stats.refreshes.Add(1)
+	go func() {
+		defer func() {
+			g.refreshMu.Lock()
+			delete(g.refreshing, key)
+			g.refreshMu.Unlock()
+		}()
+		// 与前台的加载共用 singleflight
+		if _, err := g.load(key); err != nil {
+			slog.Warn("[GCache] refresh failed", "key", key, "err", err)
+		}
+	}()
 }
 
 // 没有缓存  可选本地和远端加载
 func (g *Group[K, V]) load(key K) (V, error) {
-	value, err := g.loader.Do(key, func() (V, error) {
+	g.stats.loads.Add(1)
+	value, err, _ := g.loader.Do(key, func() (V, error) {
 		//优先从远端加载缓存
 		if g.peers != nil {
-			if p, ok := g.peers.Pick(key); ok {
-				value, err := g.getFromPeer(p, key)
-				if err == nil {
-					return value, nil
+			if fetchers := g.pick(key); len(fetchers) > 0 {
+				value, triedLocally, err := g.getFromPeer(fetchers, key)
+				// 只有连不上远端时才本地加载，远端给出的应答（key 不存在、加载失败、过载等）直接返回
+				if err == nil || triedLocally || !peer.Unreachable(err) {
+					return value, err
 				}
 				slog.Info("[GCache] Failed to get from peer", "err", err)
 			}
 			slog.Info("[GCache] Failed to get from peer")
-			return g.getLocally(key)
+			return g.getLocally(context.Background(), key)
 		}
-		return g.getLocally(key)
+		return g.getLocally(context.Background(), key)
 	})
 	if err != nil {
 		return value, err
@@ -110,28 +270,250 @@ func (g *Group[K, V]) load(key K) (V, error) {
 	return value, err
 }
 
+// pick 选出负责 key 的远端节点，开启对冲时额外选出下一个副本
+func (g *Group[K, V]) pick(key K) []peer.Fetcher[K, V] {
+	if rp, ok := g.peers.(peer.ReplicaPicker[K, V]); ok && g.opts.hedgeDelay > 0 {
+		return rp.PickN(key, 2)
+	}
+	if p, ok := g.peers.Pick(key); ok {
+		return []peer.Fetcher[K, V]{p}
+	}
+	return nil
+}
+
+// hedgeDelay returns how long to wait for the owner before hedging.
+func (g *Group[K, V]) hedgeDelay() time.Duration {
+	if g.opts.hedgeAdaptive {
+		if d, ok := g.peerLatency.quantile(0.95); ok {
+			return d
+		}
+	}
+	return g.opts.hedgeDelay
+}
+
+type fetchResult[V any] struct {
+	value V
+	err   error
+}
+
 // 从远端加载数据
-func (g *Group[K, V]) getFromPeer(peer peer.Fetcher[K, V], key K) (V, error) {
-	value, err := peer.Fetch(g.name, key)
+// 开启对冲时，主节点超过对冲延迟未返回则向下一个副本（没有副本则本地）再发一次请求，
+// 取先成功返回的结果并取消另一路。triedLocally 表示本地加载已经尝试过。
+func (g *Group[K, V]) getFromPeer(fetchers []peer.Fetcher[K, V], key K) (value V, triedLocally bool, err error) {
+	delay := g.hedgeDelay()
+	if delay <= 0 {
+		value, err = g.fetch(context.Background(), fetchers[0], key)
+		return value, false, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan fetchResult[V], 2)
+	go func() {
+		v, err := g.fetch(ctx, fetchers[0], key)
+		results <- fetchResult[V]{v, err}
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.value, false, r.err
+	case <-timer.C:
+	}
+
+	if len(fetchers) > 1 {
+		slog.Info("[GCache] hedging to next replica", "key", key, "delay", delay)
+		go func() {
+			v, err := g.fetch(ctx, fetchers[1], key)
+			results <- fetchResult[V]{v, err}
+		}()
+	} else {
+		slog.Info("[GCache] hedging to local getter", "key", key, "delay", delay)
+		triedLocally = true
+		go func() {
+			v, err := g.getLocally(ctx, key)
+			results <- fetchResult[V]{v, err}
+		}()
+	}
+
+	first := <-results
+	if first.err == nil || errors.Is(first.err, ErrNotFound) {
+		return first.value, triedLocally, first.err
+	}
+	second := <-results
+	if second.err == nil {
+		return second.value, triedLocally, nil
+	}
+	return value, triedLocally, first.err
+}
+
+// fetch 向单个远端节点请求，受 peerTimeout 限制
+func (g *Group[K, V]) fetch(ctx context.Context, peer peer.Fetcher[K, V], key K) (V, error) {
+	if g.opts.peerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.opts.peerTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	value, err := peer.Fetch(ctx, g.name, key)
 	if err != nil {
+		// 对冲时被主动取消的请求和 key 不存在都不算失败
+		if ctx.Err() != context.Canceled && !errors.Is(err, ErrNotFound) {
+			g.stats.peerErrors.Add(1)
+		}
 		return value, err
 	}
+	g.stats.peerLoads.Add(1)
+	g.peerLatency.observe(time.Since(start))
 	return value, nil
 }
 
-// 从本地加载数据
-func (g *Group[K, V]) getLocally(key K) (V, error) {
-	value, err := g.getter.Get(key)
+// 从本地加载数据，ctx 结束后不再重试
+func (g *Group[K, V]) getLocally(ctx context.Context, key K) (V, error) {
+	if g.opts.fillLock != nil {
+		return g.fillLocked(ctx, key)
+	}
+	value, _, err := g.loadLocally(ctx, key)
+	return value, err
+}
+
+// fillResult 是通过填充锁共享的加载结果，TTL 为 Getter 给出的有效期，0 表示使用分组的过期时间
+type fillResult[V any] struct {
+	Value V             `json:"value"`
+	TTL   time.Duration `json:"ttl,omitempty"`
+}
+
+// errNotShared 表示加载结果不能通过填充锁共享，等待者各自加载：数据源要求不缓存，
+// 或者本节点的限速拒绝了加载，其他节点未必被拒绝
+var errNotShared = errors.New("load result not shared")
+
+// fillLocked 持有集群的填充锁时才调用 Getter，其他节点正在加载同一个 key 时等待并使用它的结果
+func (g *Group[K, V]) fillLocked(ctx context.Context, key K) (V, error) {
+	var (
+		value   V
+		loadErr error
+		filled  bool
+	)
+	data, err := g.opts.fillLock.Fill(ctx, g.name, fmt.Sprint(key), func() ([]byte, error) {
+		filled = true
+		var ttl time.Duration
+		value, ttl, loadErr = g.loadLocally(ctx, key)
+		switch {
+		case errors.Is(loadErr, ErrOverloaded), loadErr == nil && ttl < 0:
+			return nil, errNotShared
+		case loadErr != nil:
+			return nil, loadErr
+		}
+		return json.Marshal(fillResult[V]{Value: value, TTL: ttl})
+	})
+	if filled {
+		return value, loadErr
+	}
+	if errors.Is(err, peer.ErrLockUnavailable) {
+		slog.Warn("[GCache] fill lock unavailable, loading without it", "key", key, "err", err)
+	}
+	if errors.Is(err, peer.ErrLockUnavailable) || errors.Is(err, errNotShared) {
+		value, _, err = g.loadLocally(ctx, key)
+		return value, err
+	}
+	g.stats.fillFollows.Add(1)
 	if err != nil {
+		if errors.Is(err, ErrNotFound) && g.misses != nil {
+			g.misses.Add(key, struct{}{}, time.Now().Add(g.opts.negativeTTL).UnixNano())
+		}
 		return value, err
+	}
+	var r fillResult[V]
+	if err := json.Unmarshal(data, &r); err != nil {
+		return value, fmt.Errorf("%w: %w", peer.ErrDecode, err)
+	}
+	g.cacheLoaded(key, r.Value, r.TTL)
+	return r.Value, nil
+}
 
+// loadLocally 调用本节点的 Getter 并缓存结果，同时返回 Getter 给出的有效期
+func (g *Group[K, V]) loadLocally(ctx context.Context, key K) (V, time.Duration, error) {
+	value, ttl, err := g.callGetter(ctx, key)
+	if errors.Is(err, ErrOverloaded) {
+		// 没有调用 Getter，不算加载失败
+		return value, 0, err
 	}
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			err = fmt.Errorf("%w: %w", ErrLoader, err)
+		} else if g.misses != nil {
+			g.misses.Add(key, struct{}{}, time.Now().Add(g.opts.negativeTTL).UnixNano())
+		}
+		g.stats.loadErrors.Add(1)
+		return value, 0, err
+	}
+	g.stats.localLoads.Add(1)
 	// fmt.Println("local", value)
-	g.populateCache(key, value, time.Now().Add(time.Duration(conf.GConfig.Expires)*time.Minute).UnixNano())
-	return value, nil
+	g.cacheLoaded(key, value, ttl)
+	return value, ttl, nil
+}
+
+// cacheLoaded 按 Getter 给出的有效期缓存加载的值
+func (g *Group[K, V]) cacheLoaded(key K, value V, ttl time.Duration) {
+	switch {
+	case ttl < 0:
+		// 数据源要求不缓存
+	case ttl > 0:
+		g.populateCache(key, value, time.Now().Add(ttl).UnixNano())
+	default:
+		g.populateCache(key, value, g.expires())
+	}
+}
+
+// Set stores value for key in the cache of this node, replacing any cached
+// value. The Getter's data source is not written. A value shared through
+// the fill lock for key is dropped, so other nodes missing on it load it
+// again.
+func (g *Group[K, V]) Set(key K, value V) {
+	g.populateCache(key, value, g.expires())
+	g.forgetFill(key)
+}
+
+// forgetFill 丢弃填充锁中为 key 共享的结果，避免其他节点读到被覆盖的旧值
+func (g *Group[K, V]) forgetFill(key K) {
+	if g.opts.fillLock == nil {
+		return
+	}
+	if err := g.opts.fillLock.Forget(context.Background(), g.name, fmt.Sprint(key)); err != nil {
+		slog.Warn("[GCache] forget fill result", "key", key, "err", err)
+	}
+}
+
+// SetExpiration changes the lifetime of entries cached from now on, as
+// WithExpiration does at creation. Entries already cached keep theirs.
+func (g *Group[K, V]) SetExpiration(d time.Duration) {
+	g.expiration.Store(int64(d))
+}
+
+// Resize changes the maximum number of cached entries, evicting the least
+// recently used ones if the group holds more. Zero means no limit. The
+// misses remembered by WithNegativeCaching get the same limit.
+func (g *Group[K, V]) Resize(maxEntries int64) {
+	g.mainCache.Resize(maxEntries)
+	if g.misses != nil {
+		g.misses.Resize(maxEntries)
+	}
+}
+
+// expires 新缓存条目的过期时间，0 表示不过期
+func (g *Group[K, V]) expires() int64 {
+	d := time.Duration(g.expiration.Load())
+	if d <= 0 {
+		return 0
+	}
+	return time.Now().Add(d).UnixNano()
 }
 
 // 加载到缓存
 func (g *Group[K, V]) populateCache(key K, value V, expires int64) {
+	if g.misses != nil {
+		g.misses.Remove(key)
+	}
 	g.mainCache.Add(key, value, expires)
 }
@@ -1,8 +1,15 @@
 package gcache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"kunCache/filllock"
+	"kunCache/peer"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"log/slog"
 )
@@ -16,7 +23,7 @@ var db = map[string]string{
 
 func TestGet(t *testing.T) {
 	loadCounts := make(map[string]int, len(db))
-	g := NewGroup[string, []byte]("scores", 2<<10, GetterFunc[string, []byte](
+	g, err := NewGroup[string, []byte]("scores", 2<<10, GetterFunc[string, []byte](
 		func(key string) ([]byte, error) {
 			slog.Info("[SlowDB] ", "search key", key)
 			if v, ok := db[key]; ok {
@@ -28,6 +35,9 @@ func TestGet(t *testing.T) {
 			}
 			return nil, fmt.Errorf("%s not exist", key)
 		}))
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	for k, v := range db {
 		if view, err := g.Get(k); err != nil || string(view) != v {
@@ -45,3 +55,853 @@ func TestGet(t *testing.T) {
 		slog.Error("[Err]", "err", err)
 	}
 }
+
+// fakePeer 模拟远端节点，delay 后返回 value，ctx 取消时提前返回
+type fakePeer struct {
+	value     string
+	delay     time.Duration
+	cancelled atomic.Bool
+}
+
+func (p *fakePeer) Fetch(ctx context.Context, group string, key string) ([]byte, error) {
+	select {
+	case <-time.After(p.delay):
+		return []byte(p.value), nil
+	case <-ctx.Done():
+		p.cancelled.Store(true)
+		return nil, ctx.Err()
+	}
+}
+
+type fakePicker struct {
+	peers []peer.Fetcher[string, []byte]
+}
+
+func (p *fakePicker) Pick(key string) (peer.Fetcher[string, []byte], bool) {
+	if len(p.peers) == 0 {
+		return nil, false
+	}
+	return p.peers[0], true
+}
+
+func (p *fakePicker) PickN(key string, n int) []peer.Fetcher[string, []byte] {
+	return p.peers[:min(n, len(p.peers))]
+}
+
+func (p *fakePicker) AddPeers(peersAddr ...string) {}
+func (p *fakePicker) DelPeers(peersAddr ...string) {}
+
+func localGetter(value string) GetterFunc[string, []byte] {
+	return func(key string) ([]byte, error) {
+		return []byte(value), nil
+	}
+}
+
+func TestPeerTimeout(t *testing.T) {
+	slow := &fakePeer{value: "remote", delay: time.Second}
+	g, err := NewGroup[string, []byte]("peer-timeout", 2<<10, localGetter("local"), WithPeerTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.RegisterServer(&fakePicker{peers: []peer.Fetcher[string, []byte]{slow}})
+
+	start := time.Now()
+	v, err := g.Get("Tom")
+	if err != nil || string(v) != "local" {
+		t.Fatalf("got %q, %v; want local value after peer timeout", v, err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("peer timeout was not applied")
+	}
+}
+
+func TestHedgeToReplica(t *testing.T) {
+	slow := &fakePeer{value: "slow", delay: time.Second}
+	fast := &fakePeer{value: "fast", delay: 0}
+	g, err := NewGroup[string, []byte]("hedge-replica", 2<<10, localGetter("local"), WithHedging(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.RegisterServer(&fakePicker{peers: []peer.Fetcher[string, []byte]{slow, fast}})
+
+	v, err := g.Get("Tom")
+	if err != nil || string(v) != "fast" {
+		t.Fatalf("got %q, %v; want value from hedged replica", v, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if !slow.cancelled.Load() {
+		t.Fatalf("slow primary request should be cancelled")
+	}
+}
+
+func TestHedgeToLocal(t *testing.T) {
+	slow := &fakePeer{value: "slow", delay: time.Second}
+	g, err := NewGroup[string, []byte]("hedge-local", 2<<10, localGetter("local"), WithHedging(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.RegisterServer(&fakePicker{peers: []peer.Fetcher[string, []byte]{slow}})
+
+	v, err := g.Get("Tom")
+	if err != nil || string(v) != "local" {
+		t.Fatalf("got %q, %v; want locally loaded value", v, err)
+	}
+}
+
+func TestAdaptiveHedgeDelay(t *testing.T) {
+	g, err := NewGroup[string, []byte]("hedge-adaptive", 2<<10, localGetter("local"), WithAdaptiveHedging(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := g.hedgeDelay(); d != time.Second {
+		t.Fatalf("hedge delay without samples = %v, want 1s", d)
+	}
+	for i := 1; i <= 100; i++ {
+		g.peerLatency.observe(time.Duration(i) * time.Millisecond)
+	}
+	if d := g.hedgeDelay(); d != 95*time.Millisecond {
+		t.Fatalf("hedge delay = %v, want p95 95ms", d)
+	}
+}
+
+// fakeRebalancer 把 remote 中的 key 分配给远端节点，记录推送过去的条目
+type fakeRebalancer struct {
+	fakePicker
+	remote      map[string]bool
+	transferred []peer.Entry[string, []byte]
+	onChange    func()
+}
+
+func (r *fakeRebalancer) Owner(key string) (string, peer.Transferer[string, []byte], bool) {
+	if r.remote[key] {
+		return "remote", r, true
+	}
+	return "self", nil, false
+}
+
+func (r *fakeRebalancer) OnRingChange(f func()) { r.onChange = f }
+
+func (r *fakeRebalancer) Transfer(ctx context.Context, group string, entries []peer.Entry[string, []byte]) error {
+	r.transferred = append(r.transferred, entries...)
+	return nil
+}
+
+func TestHandoff(t *testing.T) {
+	g, err := NewGroup[string, []byte]("handoff", 2<<10, localGetter("local"), WithHandoff(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRebalancer{remote: map[string]bool{"Tom": true}}
+	g.RegisterServer(r)
+	if r.onChange == nil {
+		t.Fatalf("group should subscribe to ring changes")
+	}
+	expires := time.Now().Add(time.Minute).UnixNano()
+	g.populateCache("Tom", []byte("630"), expires)
+	g.populateCache("Jack", []byte("589"), expires)
+
+	moved, err := g.Handoff(context.Background())
+	if err != nil || moved != 1 {
+		t.Fatalf("handoff moved %d, %v; want 1", moved, err)
+	}
+	if len(r.transferred) != 1 || r.transferred[0].Key != "Tom" || r.transferred[0].Expires != expires {
+		t.Fatalf("transferred %+v", r.transferred)
+	}
+	if _, ok := g.mainCache.Get("Tom"); ok {
+		t.Fatalf("moved key should be dropped locally")
+	}
+	if _, ok := g.mainCache.Get("Jack"); !ok {
+		t.Fatalf("key still owned locally should stay cached")
+	}
+}
+
+func TestImport(t *testing.T) {
+	g, err := NewGroup[string, []byte]("import", 2<<10, localGetter("local"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.populateCache("Jack", []byte("fresh"), 0)
+	g.Import([]peer.Entry[string, []byte]{
+		{Key: "Tom", Value: []byte("630")},
+		{Key: "Jack", Value: []byte("stale")},
+		{Key: "Sam", Value: []byte("567"), Expires: time.Now().Add(-time.Minute).UnixNano()},
+	})
+	if v, _ := g.Get("Tom"); string(v) != "630" {
+		t.Fatalf("imported key = %q", v)
+	}
+	if v, _ := g.Get("Jack"); string(v) != "fresh" {
+		t.Fatalf("import should not overwrite cached key, got %q", v)
+	}
+	if v, _ := g.Get("Sam"); string(v) != "local" {
+		t.Fatalf("expired entry should not be imported, got %q", v)
+	}
+}
+
+func TestStats(t *testing.T) {
+	g, err := NewGroup[string, []byte]("stats", 2<<10, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Get("Tom")
+	g.Get("Tom")
+	g.Get("unknown")
+
+	want := Stats{Gets: 3, CacheHits: 1, Loads: 2, LocalLoads: 1, LoadErrors: 1}
+	if got := g.Stats(); got != want {
+		t.Fatalf("stats = %+v, want %+v", got, want)
+	}
+	if g.Len() != 1 {
+		t.Fatalf("len = %d, want 1", g.Len())
+	}
+	if info, ok := LookupGroup("stats"); !ok || info.Name() != "stats" {
+		t.Fatalf("group stats not found")
+	}
+	g.Purge()
+	if g.Len() != 0 {
+		t.Fatalf("len after purge = %d", g.Len())
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	g, err := NewGroup[string, []byte]("reconfigure", 0, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Set("Tom", []byte("630"))
+	g.SetExpiration(time.Minute)
+	g.Set("Jack", []byte("589"))
+	g.Set("Sam", []byte("567"))
+
+	expires := make(map[string]int64)
+	g.mainCache.Range(func(key string, value []byte, exp int64) bool {
+		expires[key] = exp
+		return true
+	})
+	if expires["Tom"] != 0 || expires["Jack"] == 0 {
+		t.Fatalf("expires = %v, want only entries after SetExpiration to expire", expires)
+	}
+
+	g.Resize(2)
+	if g.Len() != 2 {
+		t.Fatalf("len after resize = %d, want 2", g.Len())
+	}
+	if _, ok := g.mainCache.Get("Tom"); ok {
+		t.Fatal("least recently used entry should be evicted")
+	}
+
+	// 缓存的 miss 同样受限
+	n, err := NewGroup[string, []byte]("resize-misses", 0, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}), WithNegativeCaching(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("resize-misses") })
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		n.Get(key)
+	}
+	n.Resize(1)
+	if l := n.misses.Len(); l != 1 {
+		t.Fatalf("misses after resize = %d, want 1", l)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	g, err := NewGroup[string, []byte]("registry", 0, localGetter("local"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewGroup[string, []byte]("registry", 0, localGetter("other")); !errors.Is(err, ErrGroupExists) {
+		t.Fatalf("duplicate name: err = %v, want ErrGroupExists", err)
+	}
+	if got, err := GetGroup[string, []byte]("registry"); err != nil || got != g {
+		t.Fatalf("GetGroup = %p, %v", got, err)
+	}
+	if _, err := GetGroup[string, string]("registry"); !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("wrong types: err = %v, want ErrTypeMismatch", err)
+	}
+	if _, err := GetGroup[string, []byte]("unknown"); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("unknown group: err = %v, want ErrGroupNotFound", err)
+	}
+
+	if err := DeleteGroup("registry"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := LookupGroup("registry"); ok {
+		t.Fatal("deleted group still listed")
+	}
+	if err := DeleteGroup("registry"); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("second delete: err = %v, want ErrGroupNotFound", err)
+	}
+	// 删除后可以重新创建同名分组
+	if _, err := NewGroup[string, []byte]("registry", 0, localGetter("local")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNegativeCaching(t *testing.T) {
+	var loads atomic.Int32
+	g, err := NewGroup[string, []byte]("negative", 2<<10, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			loads.Add(1)
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}), WithNegativeCaching(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("err = %v, want ErrNotFound", err)
+		}
+	}
+	if loads.Load() != 1 || g.Stats().NegativeHits != 2 {
+		t.Fatalf("loads = %d, negative hits = %d; want the miss cached", loads.Load(), g.Stats().NegativeHits)
+	}
+
+	// 写入后不再返回缓存的 miss
+	g.Set("missing", []byte("set"))
+	if v, err := g.Get("missing"); err != nil || string(v) != "set" {
+		t.Fatalf("after set got %q, %v", v, err)
+	}
+
+	g.Remove("missing")
+	g.Get("missing")
+	time.Sleep(60 * time.Millisecond)
+	g.Get("missing")
+	if loads.Load() != 3 {
+		t.Fatalf("loads = %d, want the miss to expire after its ttl", loads.Load())
+	}
+}
+
+// missingPeer 远端节点上不存在任何 key
+type missingPeer struct{}
+
+func (missingPeer) Fetch(ctx context.Context, group string, key string) ([]byte, error) {
+	return nil, fmt.Errorf("%w: %s", peer.ErrNotFound, key)
+}
+
+func TestPeerNotFound(t *testing.T) {
+	var loads atomic.Int32
+	g, err := NewGroup[string, []byte]("peer-not-found", 2<<10, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			loads.Add(1)
+			return []byte("local"), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.RegisterServer(&fakePicker{peers: []peer.Fetcher[string, []byte]{missingPeer{}}})
+
+	if _, err := g.Get("Tom"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound from the owner", err)
+	}
+	if loads.Load() != 0 || g.Stats().PeerErrors != 0 {
+		t.Fatalf("loads = %d, peer errors = %d; a miss on the owner is not a peer failure", loads.Load(), g.Stats().PeerErrors)
+	}
+}
+
+// errPeer 远端节点对所有 key 返回 err
+type errPeer struct{ err error }
+
+func (p errPeer) Fetch(ctx context.Context, group string, key string) ([]byte, error) {
+	return nil, p.err
+}
+
+func TestPeerError(t *testing.T) {
+	var loads atomic.Int32
+	g, err := NewGroup[string, []byte]("peer-error", 2<<10, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			loads.Add(1)
+			return []byte("local"), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	picker := &fakePicker{}
+	g.RegisterServer(picker)
+
+	// 远端加载失败或过载时原样返回，不在本地重复加载
+	for _, code := range []peer.Code{peer.CodeLoader, peer.CodeOverloaded} {
+		picker.peers = []peer.Fetcher[string, []byte]{errPeer{&peer.Error{Code: code, Message: "remote"}}}
+		if _, err := g.Get(string(code)); peer.CodeOf(err) != code {
+			t.Fatalf("err = %v, want %s from the owner", err, code)
+		}
+	}
+	if loads.Load() != 0 {
+		t.Fatalf("loads = %d, want no local load on a remote answer", loads.Load())
+	}
+
+	// 连不上远端时本地加载
+	picker.peers = []peer.Fetcher[string, []byte]{errPeer{fmt.Errorf("%w: connection refused", peer.ErrUnavailable)}}
+	if v, err := g.Get("Tom"); err != nil || string(v) != "local" {
+		t.Fatalf("Get = %q, %v; want a local load", v, err)
+	}
+}
+
+// versionGetter 每次加载返回新的版本号，第一次之后的加载等待 release
+func versionGetter(loads *atomic.Int32, release <-chan struct{}) Getter[string, []byte] {
+	return GetterFunc[string, []byte](func(key string) ([]byte, error) {
+		n := loads.Add(1)
+		if n > 1 {
+			<-release
+		}
+		return []byte(fmt.Sprint("v", n)), nil
+	})
+}
+
+// waitFor 等待 g.Get(key) 返回 want
+func waitFor(t *testing.T, g *Group[string, []byte], key, want string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if v, _ := g.Get(key); string(v) == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s never became %q", key, want)
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	g, err := NewGroup[string, []byte]("stale", 2<<10, versionGetter(&loads, release),
+		WithExpiration(30*time.Millisecond), WithStaleWhileRevalidate(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("stale") })
+
+	g.Get("Tom")
+	time.Sleep(40 * time.Millisecond)
+	// 刷新被阻塞，过期后仍立即返回旧值
+	for i := 0; i < 3; i++ {
+		if v, err := g.Get("Tom"); err != nil || string(v) != "v1" {
+			t.Fatalf("stale get = %q, %v; want v1", v, err)
+		}
+	}
+	if s := g.Stats(); s.StaleHits != 3 || s.Refreshes != 1 {
+		t.Fatalf("stale hits = %d, refreshes = %d; want 3 and 1", s.StaleHits, s.Refreshes)
+	}
+	close(release)
+	waitFor(t, g, "Tom", "v2")
+	if loads.Load() != 2 {
+		t.Fatalf("loads = %d, want one refresh", loads.Load())
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	close(release)
+	g, err := NewGroup[string, []byte]("refresh-ahead", 2<<10, versionGetter(&loads, release),
+		WithExpiration(200*time.Millisecond), WithRefreshAhead(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("refresh-ahead") })
+
+	g.Get("Tom")
+	g.Get("Tom")
+	if s := g.Stats(); s.Refreshes != 0 {
+		t.Fatalf("refreshes = %d for a fresh entry", s.Refreshes)
+	}
+	// 进入最后 50% 的有效期后读取触发刷新，条目在过期前被替换
+	time.Sleep(120 * time.Millisecond)
+	if v, _ := g.Get("Tom"); string(v) != "v1" {
+		t.Fatalf("got %q, want v1 while refreshing", v)
+	}
+	waitFor(t, g, "Tom", "v2")
+	if s := g.Stats(); s.Refreshes != 1 || s.StaleHits != 0 {
+		t.Fatalf("refreshes = %d, stale hits = %d; want 1 and 0", s.Refreshes, s.StaleHits)
+	}
+}
+
+func TestServeStaleOnError(t *testing.T) {
+	var down atomic.Bool
+	var missing atomic.Bool
+	g, err := NewGroup[string, []byte]("stale-on-error", 2<<10, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			switch {
+			case missing.Load():
+				return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+			case down.Load():
+				return nil, errors.New("db is down")
+			}
+			return []byte("v1"), nil
+		}), WithExpiration(20*time.Millisecond), WithServeStaleOnError(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("stale-on-error") })
+
+	g.Get("Tom")
+	time.Sleep(30 * time.Millisecond)
+	// 数据源正常时过期条目照常重新加载
+	if v, age, err := g.GetWithStaleness("Tom"); err != nil || string(v) != "v1" || age != 0 {
+		t.Fatalf("reload = %q, %v, %v", v, age, err)
+	}
+
+	down.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	v, age, err := g.GetWithStaleness("Tom")
+	if err != nil || string(v) != "v1" || age <= 0 {
+		t.Fatalf("with the getter down got %q, staleness %v, %v; want the stale value", v, age, err)
+	}
+	if s := g.Stats(); s.StaleServes != 1 || s.LoadErrors != 1 {
+		t.Fatalf("stale serves = %d, load errors = %d; want 1 and 1", s.StaleServes, s.LoadErrors)
+	}
+	// 没有旧值的 key 仍然返回错误
+	if _, err := g.Get("Jack"); !errors.Is(err, ErrLoader) {
+		t.Fatalf("uncached key: err = %v, want ErrLoader", err)
+	}
+
+	// key 从数据源删除后不再返回旧值
+	missing.Store(true)
+	if _, err := g.Get("Tom"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleted key: err = %v, want ErrNotFound", err)
+	}
+	missing.Store(false)
+	if _, err := g.Get("Tom"); !errors.Is(err, ErrLoader) {
+		t.Fatalf("after delete: err = %v, want the load error", err)
+	}
+}
+
+// otherNode 模拟另一个节点持有填充锁，直接返回它共享的结果
+type otherNode struct {
+	data []byte
+	err  error
+}
+
+func (o otherNode) Fill(ctx context.Context, group, key string, fill func() ([]byte, error)) ([]byte, error) {
+	return o.data, o.err
+}
+
+func (o otherNode) Forget(ctx context.Context, group, key string) error {
+	return nil
+}
+
+func TestFillLock(t *testing.T) {
+	var loads atomic.Int32
+	getter := GetterFunc[string, []byte](func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte("local"), nil
+	})
+	tests := []struct {
+		name    string
+		lock    peer.FillLock
+		want    string
+		wantErr error
+		loads   int32
+		follows int64
+	}{
+		// 值以 JSON 共享，[]byte 编码为 base64
+		{"follower", otherNode{data: []byte(`{"value":"b3RoZXI="}`)}, "other", nil, 0, 1},
+		{"shared miss", otherNode{err: fmt.Errorf("%w: Tom", peer.ErrNotFound)}, "", ErrNotFound, 0, 1},
+		{"lock down", otherNode{err: fmt.Errorf("%w: etcd down", peer.ErrLockUnavailable)}, "local", nil, 1, 0},
+		{"leader", filllock.NewMemory(), "local", nil, 1, 0},
+	}
+	for _, tt := range tests {
+		loads.Store(0)
+		g, err := NewGroup[string, []byte]("fill-"+tt.name, 2<<10, getter, WithFillLock(tt.lock))
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := g.Get("Tom")
+		if string(v) != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Get = %q, %v; want %q, %v", tt.name, v, err, tt.want, tt.wantErr)
+		}
+		if loads.Load() != tt.loads || g.Stats().FillFollows != tt.follows {
+			t.Errorf("%s: loads = %d, follows = %d; want %d, %d", tt.name, loads.Load(), g.Stats().FillFollows, tt.loads, tt.follows)
+		}
+		DeleteGroup(g.Name())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls atomic.Int32
+	errFlaky := errors.New("connection reset")
+	g, err := NewGroup[string, []byte]("retry", 2<<10, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			n := calls.Add(1)
+			if key == "missing" {
+				return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+			}
+			if key == "down" || n < 3 {
+				return nil, errFlaky
+			}
+			return []byte("630"), nil
+		}), WithRetry(RetryPolicy{Attempts: 3, Backoff: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("retry") })
+
+	if v, err := g.Get("Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("Get = %q, %v; want success on the third call", v, err)
+	}
+	if s := g.Stats(); s.Retries != 2 || s.LoadErrors != 0 {
+		t.Fatalf("retries = %d, load errors = %d; want 2 and 0", s.Retries, s.LoadErrors)
+	}
+
+	calls.Store(0)
+	if _, err := g.Get("down"); !errors.Is(err, errFlaky) || !errors.Is(err, ErrLoader) || calls.Load() != 3 {
+		t.Fatalf("Get = %v after %d calls; want the last error after 3", err, calls.Load())
+	}
+	// key 不存在不重试
+	calls.Store(0)
+	if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) || calls.Load() != 1 {
+		t.Fatalf("Get = %v after %d calls; want ErrNotFound after 1", err, calls.Load())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for n, limit := range []time.Duration{10, 20, 40, 50, 50} {
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(n); d < 0 || d > limit*time.Millisecond {
+				t.Fatalf("backoff(%d) = %v, want within [0, %v]", n, d, limit*time.Millisecond)
+			}
+		}
+	}
+}
+
+func TestMaxConcurrentLoads(t *testing.T) {
+	var running, peak atomic.Int32
+	g, err := NewGroup[string, []byte]("max-loads", 2<<10, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return []byte(key), nil
+		}), WithMaxConcurrentLoads(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("max-loads") })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := g.Get(fmt.Sprint("key", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if p := peak.Load(); p != 2 {
+		t.Fatalf("peak concurrent loads = %d, want 2", p)
+	}
+
+	// 名额用完时等待可以被取消
+	g.loadSlots <- struct{}{}
+	g.loadSlots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := g.callGetter(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded while waiting for a load slot", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	g, err := NewGroup[string, []byte]("rate-limit", 2<<10, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithRateLimit(1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("rate-limit") })
+
+	for _, key := range []string{"Tom", "Jack"} {
+		if _, err := g.Get(key); err != nil {
+			t.Fatalf("Get(%s) within burst: %v", key, err)
+		}
+	}
+	if _, err := g.Get("Sam"); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Get beyond burst: err = %v, want ErrOverloaded", err)
+	}
+	// 命中缓存不受限速影响
+	if _, err := g.Get("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if s := g.Stats(); s.Rejected != 1 || s.LoadErrors != 0 {
+		t.Fatalf("rejected = %d, load errors = %d; want 1 and 0", s.Rejected, s.LoadErrors)
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	errFlaky := errors.New("connection reset")
+	lock := &recordLock{}
+	g, err := NewGroup[string, []byte]("rate-limit-retry", 2<<10, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			return nil, errFlaky
+		}), WithRateLimit(0.01, 1), WithRetry(RetryPolicy{Attempts: 3}), WithFillLock(lock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("rate-limit-retry") })
+
+	// 重试被拒绝时返回数据源的错误
+	if _, err := g.Get("Tom"); !errors.Is(err, errFlaky) || !errors.Is(err, ErrLoader) || errors.Is(err, ErrOverloaded) {
+		t.Fatalf("err = %v, want the loader error", err)
+	}
+	// 限速拒绝只影响本节点，不通过填充锁共享
+	if _, err := g.Get("Jack"); !errors.Is(err, ErrOverloaded) || !errors.Is(lock.err, errNotShared) {
+		t.Fatalf("err = %v, shared %v; want ErrOverloaded, not shared", err, lock.err)
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	var calls atomic.Int32
+	g, err := NewGroup[string, []byte]("retry-cancel", 2<<10, GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			calls.Add(1)
+			return nil, errors.New("connection reset")
+		}), WithRetry(RetryPolicy{Attempts: 3, Backoff: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("retry-cancel") })
+
+	// ctx 结束后不再等待重试
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := g.callGetter(ctx, "Tom"); err == nil || calls.Load() != 1 {
+		t.Fatalf("err = %v after %d calls; want the first error", err, calls.Load())
+	}
+}
+
+// ttlGetter 返回的值在 ttl 后过期
+type ttlGetter struct {
+	ttl   time.Duration
+	loads atomic.Int32
+}
+
+func (g *ttlGetter) Get(key string) ([]byte, error) {
+	v, _, err := g.GetWithTTL(key)
+	return v, err
+}
+
+func (g *ttlGetter) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	g.loads.Add(1)
+	return []byte(key), g.ttl, nil
+}
+
+func TestTTLGetter(t *testing.T) {
+	getter := &ttlGetter{ttl: 20 * time.Millisecond}
+	g, err := NewGroup[string, []byte]("ttl-getter", 2<<10, getter, WithExpiration(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("ttl-getter") })
+
+	g.Get("Tom")
+	g.Get("Tom")
+	if n := getter.loads.Load(); n != 1 {
+		t.Fatalf("loads = %d, want 1", n)
+	}
+	// Getter 给出的有效期优先于分组的过期时间
+	time.Sleep(30 * time.Millisecond)
+	g.Get("Tom")
+	if n := getter.loads.Load(); n != 2 {
+		t.Fatalf("loads after ttl = %d, want 2", n)
+	}
+	// 负的有效期表示不缓存
+	getter.ttl = -1
+	g.Get("Jack")
+	g.Get("Jack")
+	if n := getter.loads.Load(); n != 4 {
+		t.Fatalf("loads of uncached key = %d, want 4", n)
+	}
+}
+
+// recordLock 直接执行 fill 并记录它共享的结果
+type recordLock struct {
+	data []byte
+	err  error
+}
+
+func (l *recordLock) Fill(ctx context.Context, group, key string, fill func() ([]byte, error)) ([]byte, error) {
+	l.data, l.err = fill()
+	return l.data, l.err
+}
+
+func (l *recordLock) Forget(ctx context.Context, group, key string) error {
+	return nil
+}
+
+func TestFillLockTTL(t *testing.T) {
+	getter := &ttlGetter{ttl: 20 * time.Millisecond}
+	lock := &recordLock{}
+	leader, err := NewGroup[string, []byte]("fill-ttl-leader", 2<<10, getter, WithExpiration(time.Hour), WithFillLock(lock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("fill-ttl-leader") })
+
+	// Getter 给出的有效期随值一起共享
+	if v, err := leader.Get("Tom"); err != nil || string(v) != "Tom" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if want := `{"value":"VG9t","ttl":20000000}`; string(lock.data) != want {
+		t.Fatalf("shared %s, want %s", lock.data, want)
+	}
+	// 不缓存的值不共享
+	getter.ttl = -1
+	if v, err := leader.Get("Jack"); err != nil || string(v) != "Jack" || !errors.Is(lock.err, errNotShared) {
+		t.Fatalf("Get = %q, %v, shared error %v; want the value and errNotShared", v, err, lock.err)
+	}
+
+	var loads atomic.Int32
+	local := GetterFunc[string, []byte](func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte("local"), nil
+	})
+	follower, err := NewGroup[string, []byte]("fill-ttl-follower", 2<<10, local, WithExpiration(time.Hour),
+		WithFillLock(otherNode{data: []byte(`{"value":"VG9t","ttl":20000000}`)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("fill-ttl-follower") })
+	follower.Get("Tom")
+	follower.Get("Tom")
+	if n := follower.Stats().FillFollows; n != 1 {
+		t.Fatalf("follows = %d, want 1", n)
+	}
+	// 等待者使用共享的有效期而不是分组的过期时间
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := follower.Get("Tom"); string(v) != "Tom" || follower.Stats().FillFollows != 2 || loads.Load() != 0 {
+		t.Fatalf("Get after ttl = %q, follows = %d, loads = %d; want Tom, 2, 0", v, follower.Stats().FillFollows, loads.Load())
+	}
+
+	// 共享了 errNotShared 时自己加载
+	self, err := NewGroup[string, []byte]("fill-ttl-self", 2<<10, local, WithFillLock(otherNode{err: errNotShared}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DeleteGroup("fill-ttl-self") })
+	if v, err := self.Get("Tom"); err != nil || string(v) != "local" || loads.Load() != 1 {
+		t.Fatalf("Get = %q, %v after %d loads; want a local load", v, err, loads.Load())
+	}
+}
@@ -0,0 +1,106 @@
+package gcache
+
+import (
+	"context"
+	"kunCache/peer"
+	"log/slog"
+	"time"
+)
+
+// transferBatch 每次 Transfer 请求最多携带的条目数
+const transferBatch = 256
+
+// scheduleHandoff 在哈希环变化后延迟执行迁移，期间的多次变化合并为一次
+func (g *Group[K, V]) scheduleHandoff() {
+	g.handoffMu.Lock()
+	defer g.handoffMu.Unlock()
+	if g.closed {
+		return
+	}
+	if g.handoffTimer != nil {
+		g.handoffTimer.Stop()
+	}
+	g.handoffTimer = time.AfterFunc(g.opts.handoffDelay, func() {
+		if moved, err := g.Handoff(context.Background()); err != nil {
+			slog.Error("[GCache] handoff failed", "group", g.name, "moved", moved, "err", err)
+		}
+	})
+}
+
+// close 分组被删除后不再迁移
+func (g *Group[K, V]) close() {
+	g.handoffMu.Lock()
+	defer g.handoffMu.Unlock()
+	g.closed = true
+	if g.handoffTimer != nil {
+		g.handoffTimer.Stop()
+	}
+}
+
+type handoffBatch[K comparable, V any] struct {
+	transferer peer.Transferer[K, V]
+	entries    []peer.Entry[K, V]
+}
+
+// Handoff pushes every cached key that is now owned by another peer to
+// that peer and drops the local copy. Keys whose owner cannot be reached
+// stay cached locally. It returns the number of keys moved.
+func (g *Group[K, V]) Handoff(ctx context.Context) (int, error) {
+	r, ok := g.peers.(peer.Rebalancer[K, V])
+	if !ok {
+		return 0, nil
+	}
+
+	batches := make(map[K]*handoffBatch[K, V])
+	g.mainCache.Range(func(key K, value V, expires int64) bool {
+		addr, t, ok := r.Owner(key)
+		if !ok {
+			return true
+		}
+		b := batches[addr]
+		if b == nil {
+			b = &handoffBatch[K, V]{transferer: t}
+			batches[addr] = b
+		}
+		b.entries = append(b.entries, peer.Entry[K, V]{Key: key, Value: value, Expires: expires})
+		return true
+	})
+
+	var moved int
+	var firstErr error
+	for addr, b := range batches {
+		for start := 0; start < len(b.entries); start += transferBatch {
+			chunk := b.entries[start:min(start+transferBatch, len(b.entries))]
+			if err := b.transferer.Transfer(ctx, g.name, chunk); err != nil {
+				slog.Error("[GCache] transfer failed", "group", g.name, "peer", addr, "err", err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				break
+			}
+			for _, e := range chunk {
+				g.mainCache.Remove(e.Key)
+			}
+			moved += len(chunk)
+		}
+	}
+	if moved > 0 {
+		slog.Info("[GCache] handoff done", "group", g.name, "moved", moved)
+	}
+	return moved, firstErr
+}
+
+// Import adds entries handed off by another peer. Keys already cached are
+// kept, since a local copy is at least as fresh as the transferred one.
+func (g *Group[K, V]) Import(entries []peer.Entry[K, V]) {
+	now := time.Now().UnixNano()
+	for _, e := range entries {
+		if e.Expires != 0 && e.Expires < now {
+			continue
+		}
+		if _, ok := g.mainCache.Get(e.Key); ok {
+			continue
+		}
+		g.populateCache(e.Key, e.Value, e.Expires)
+	}
+}
@@ -0,0 +1,43 @@
+package gcache
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindow     = 256
+	latencyMinSamples = 20
+)
+
+// latencies keeps a sliding window of recent peer fetch latencies.
+type latencies struct {
+	mu      sync.Mutex
+	samples [latencyWindow]time.Duration
+	n       int // 已写入的样本总数
+}
+
+func (l *latencies) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples[l.n%latencyWindow] = d
+	l.n++
+}
+
+// quantile returns the q-quantile of the window, or false if there are
+// not enough samples yet.
+func (l *latencies) quantile(q float64) (time.Duration, bool) {
+	l.mu.Lock()
+	n := min(l.n, latencyWindow)
+	if n < latencyMinSamples {
+		l.mu.Unlock()
+		return 0, false
+	}
+	window := slices.Clone(l.samples[:n])
+	l.mu.Unlock()
+
+	slices.Sort(window)
+	idx := int(float64(n-1) * q)
+	return window[idx], true
+}
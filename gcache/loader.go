@@ -0,0 +1,131 @@
+package gcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kunCache/peer"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is returned by Get when the group rejected a load to
+// protect its data source, see WithRateLimit. Remote peers report it as
+// well.
+var ErrOverloaded = peer.ErrOverloaded
+
+// RetryPolicy configures how a failed Getter call is retried.
+type RetryPolicy struct {
+	// Attempts is the number of calls made for one load, the first
+	// included. Values below 2 disable retries.
+	Attempts int
+	// Backoff is the delay before the first retry; it doubles for every
+	// following one up to MaxBackoff. The actual delay is drawn uniformly
+	// between zero and that value, so nodes do not retry in lockstep.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable reports whether err is worth retrying. By default every
+	// error is, except ErrNotFound.
+	Retryable func(err error) bool
+}
+
+// retryable 判断 err 是否需要重试
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return !errors.Is(err, ErrNotFound)
+}
+
+// backoff 第 n 次重试（从 0 开始）前等待的时间，带随机抖动
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.Backoff
+	for i := 0; i < n && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d + 1)
+}
+
+// callGetter 按分组的加载策略调用 Getter：限速、限制并发并重试，ctx 结束后不再等待并发名额或重试。
+// ttl 是 TTLGetter 给出的有效期，其他 Getter 为 0
+func (g *Group[K, V]) callGetter(ctx context.Context, key K) (value V, ttl time.Duration, err error) {
+	retry := g.opts.retry
+	for attempt := 0; ; attempt++ {
+		if g.limiter != nil && !g.limiter.allow() {
+			g.stats.rejectedLoads.Add(1)
+			if attempt > 0 {
+				// 重试被限速拒绝时返回数据源的错误，数据源本身没有被拒绝
+				return value, 0, fmt.Errorf("%w (retry rejected by the load rate limit of group %s)", err, g.name)
+			}
+			return value, 0, fmt.Errorf("%w: load rate limit of group %s reached", ErrOverloaded, g.name)
+		}
+		if g.loadSlots != nil {
+			select {
+			case g.loadSlots <- struct{}{}:
+			case <-ctx.Done():
+				return value, 0, ctx.Err()
+			}
+		}
+		if tg, ok := g.getter.(TTLGetter[K, V]); ok {
+			value, ttl, err = tg.GetWithTTL(key)
+		} else {
+			value, err = g.getter.Get(key)
+		}
+		if g.loadSlots != nil {
+			<-g.loadSlots
+		}
+		if err == nil || attempt+1 >= retry.Attempts || !retry.retryable(err) {
+			return value, ttl, err
+		}
+		g.stats.retries.Add(1)
+		d := retry.backoff(attempt)
+		slog.Info("[GCache] retrying load", "key", key, "attempt", attempt+1, "backoff", d, "err", err)
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return value, ttl, err
+		}
+	}
+}
+
+// tokenBucket 令牌桶限速器：每秒补充 rate 个令牌，最多积累 burst 个
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow 取走一个令牌，没有令牌时返回 false
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,175 @@
+package gcache
+
+import (
+	"kunCache/admission"
+	"kunCache/peer"
+	"time"
+)
+
+// Option configures a Group.
+type Option func(*options)
+
+type options struct {
+	// expiration 缓存条目的有效期，0 表示不过期
+	expiration time.Duration
+	// peerTimeout 每次向远端节点请求的超时时间，0 表示不限制
+	peerTimeout time.Duration
+	// hedgeDelay 主请求超过该时间未返回则发起对冲请求，0 表示不对冲
+	hedgeDelay time.Duration
+	// hedgeAdaptive 使用观测到的 p95 延迟作为对冲延迟，hedgeDelay 作为样本不足时的取值
+	hedgeAdaptive bool
+	// handoffDelay 哈希环变化后等待多久开始迁移缓存，0 表示不迁移
+	handoffDelay time.Duration
+	// negativeTTL 不存在的 key 的缓存时间，0 表示不缓存
+	negativeTTL time.Duration
+	// staleGrace 条目过期后仍可返回旧值的时间，同时在后台刷新，0 表示不返回旧值
+	staleGrace time.Duration
+	// refreshAhead 剩余有效期低于该比例时被读取的条目在后台提前刷新，0 表示不提前刷新
+	refreshAhead float64
+	// maxStale 加载失败时可以返回过期多久以内的旧值，0 表示不返回
+	maxStale time.Duration
+	// fillLock 不为 nil 时集群中同一时间只有一个节点为 key 调用 Getter
+	fillLock peer.FillLock
+	// retry Getter 失败后的重试策略
+	retry RetryPolicy
+	// maxLoads 同时执行的 Getter 调用数上限，0 表示不限制
+	maxLoads int
+	// loadRate、loadBurst 每秒允许的 Getter 调用数和突发数，loadRate 为 0 表示不限速
+	loadRate  float64
+	loadBurst int
+	// admission 限制同时处理的请求数，为 nil 不限制
+	admission *admission.Limiter
+}
+
+// WithPeerTimeout bounds every fetch from a remote peer. A peer that does
+// not answer in time is treated as failed and the key is loaded locally.
+func WithPeerTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.peerTimeout = d
+	}
+}
+
+// WithHedging sends a second request when the owner has not answered
+// within delay: to the next replica on the ring, or to the local Getter if
+// there is none. Whichever returns first wins and the other is cancelled.
+func WithHedging(delay time.Duration) Option {
+	return func(o *options) {
+		o.hedgeDelay = delay
+		o.hedgeAdaptive = false
+	}
+}
+
+// WithAdaptiveHedging is like WithHedging but derives the hedge delay from
+// the observed p95 latency of peer fetches. initial is used until enough
+// samples have been collected.
+func WithAdaptiveHedging(initial time.Duration) Option {
+	return func(o *options) {
+		o.hedgeDelay = initial
+		o.hedgeAdaptive = true
+	}
+}
+
+// WithHandoff pushes cached keys to their new owner when the ring changes,
+// so a joining node starts warm instead of missing on every key it took
+// over. Ring changes within delay of each other are handled in one pass.
+// The peer picker must implement peer.Rebalancer.
+func WithHandoff(delay time.Duration) Option {
+	return func(o *options) {
+		o.handoffDelay = delay
+	}
+}
+
+// WithExpiration makes cached entries expire d after they are loaded. By
+// default entries stay until evicted.
+func WithExpiration(d time.Duration) Option {
+	return func(o *options) {
+		o.expiration = d
+	}
+}
+
+// WithNegativeCaching remembers for ttl that a key does not exist when the
+// Getter returns ErrNotFound, so repeated requests for missing keys are
+// answered from the cache instead of hitting the data source. Setting or
+// loading the key ends the negative entry early.
+func WithNegativeCaching(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithStaleWhileRevalidate keeps serving an expired entry for up to grace
+// after it expired while one background load refreshes it, so callers do
+// not wait for the Getter when a hot key expires.
+func WithStaleWhileRevalidate(grace time.Duration) Option {
+	return func(o *options) {
+		o.staleGrace = grace
+	}
+}
+
+// WithRefreshAhead reloads an entry in the background when it is read
+// with less than fraction of its lifetime left, e.g. 0.1 for the last 10%,
+// so keys that are read often are replaced before they expire. It has no
+// effect on entries that do not expire.
+func WithRefreshAhead(fraction float64) Option {
+	return func(o *options) {
+		o.refreshAhead = fraction
+	}
+}
+
+// WithServeStaleOnError keeps expired entries for up to maxStale after
+// they expired and returns them when loading the key from peers and the
+// Getter fails, so an outage of the data source does not fail requests for
+// keys that were cached. GetWithStaleness tells such values apart.
+func WithServeStaleOnError(maxStale time.Duration) Option {
+	return func(o *options) {
+		o.maxStale = maxStale
+	}
+}
+
+// WithFillLock makes the nodes sharing l take turns calling the Getter for
+// a key: while one node loads it, the others wait and use its result, so
+// nodes falling back to their Getter at the same time, e.g. when the owner
+// of the key is unreachable, do not all hit the data source. Values are
+// shared as JSON along with the TTL a TTLGetter gave them; values it marks
+// as uncacheable are not shared. Without a working lock the Getter is
+// called directly.
+func WithFillLock(l peer.FillLock) Option {
+	return func(o *options) {
+		o.fillLock = l
+	}
+}
+
+// WithRetry retries failed Getter calls as p describes. The key stays
+// locked by singleflight while retrying, so callers share the retries.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// WithMaxConcurrentLoads lets at most n Getter calls of the group run at a
+// time; further loads wait for one to finish.
+func WithMaxConcurrentLoads(n int) Option {
+	return func(o *options) {
+		o.maxLoads = n
+	}
+}
+
+// WithRateLimit allows rate Getter calls per second with bursts of up to
+// burst calls. Loads beyond that fail at once with ErrOverloaded instead
+// of reaching the data source. Retries count against the limit; a retry
+// beyond it fails with the error of the previous call.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(o *options) {
+		o.loadRate = rate
+		o.loadBurst = burst
+	}
+}
+
+// WithAdmission makes Admit wait for l, so servers handle at most as many
+// requests for the group at a time as l admits and shed the others.
+func WithAdmission(l *admission.Limiter) Option {
+	return func(o *options) {
+		o.admission = l
+	}
+}
@@ -0,0 +1,109 @@
+package gcache
+
+import (
+	"errors"
+	"fmt"
+	"kunCache/peer"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrGroupNotFound is returned for a name no group is registered under.
+	// It is the same error remote peers report for an unknown group.
+	ErrGroupNotFound = peer.ErrGroupNotFound
+	// ErrGroupExists is returned by NewGroup for a name already taken.
+	ErrGroupExists = errors.New("gcache: group already exists")
+	// ErrTypeMismatch is returned by GetGroup when the group was created
+	// with other key or value types.
+	ErrTypeMismatch = errors.New("gcache: group type mismatch")
+)
+
+// GroupInfo is the part of a Group that does not depend on its key and
+// value types, so groups of any type can be listed and managed together.
+type GroupInfo interface {
+	Name() string
+	Len() int64
+	Stats() Stats
+	Purge()
+	SetExpiration(d time.Duration)
+	Resize(maxEntries int64)
+}
+
+// registered 注册表中的分组，删除时停止后台任务
+type registered interface {
+	GroupInfo
+	close()
+}
+
+var (
+	mu     sync.RWMutex
+	groups = make(map[string]registered)
+)
+
+func register(g registered) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := groups[g.Name()]; ok {
+		return fmt.Errorf("%w: %s", ErrGroupExists, g.Name())
+	}
+	groups[g.Name()] = g
+	return nil
+}
+
+// GetGroup returns the named group previously created with NewGroup. It
+// fails with ErrGroupNotFound if there is no such group and with
+// ErrTypeMismatch if the group has other key or value types.
+func GetGroup[K comparable, V any](name string) (*Group[K, V], error) {
+	mu.RLock()
+	g, ok := groups[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+	typed, ok := g.(*Group[K, V])
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is %T, not %T", ErrTypeMismatch, name, g, typed)
+	}
+	return typed, nil
+}
+
+// DeleteGroup unregisters the named group and drops its cached entries.
+// Callers still holding the group can use it, but it no longer hands off
+// keys when the ring changes.
+func DeleteGroup(name string) error {
+	mu.Lock()
+	g, ok := groups[name]
+	delete(groups, name)
+	mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+	g.close()
+	g.Purge()
+	return nil
+}
+
+// ListGroups returns every registered group sorted by name.
+func ListGroups() []GroupInfo {
+	mu.RLock()
+	defer mu.RUnlock()
+	infos := make([]GroupInfo, 0, len(groups))
+	for _, g := range groups {
+		infos = append(infos, g)
+	}
+	slices.SortFunc(infos, func(a, b GroupInfo) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return infos
+}
+
+// LookupGroup returns the named group whatever its key and value types.
+func LookupGroup(name string) (GroupInfo, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	g, ok := groups[name]
+	return g, ok
+}
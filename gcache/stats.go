@@ -0,0 +1,91 @@
+package gcache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Stats are per-group statistics.
+type Stats struct {
+	Gets         int64 `json:"gets"`          // any Get request
+	CacheHits    int64 `json:"cache_hits"`    // served from the local cache
+	PeerLoads    int64 `json:"peer_loads"`    // loaded from a remote peer
+	PeerErrors   int64 `json:"peer_errors"`   // remote peer failed
+	Loads        int64 `json:"loads"`         // Get requests that missed the cache
+	LoadErrors   int64 `json:"load_errors"`   // Getter failed
+	LocalLoads   int64 `json:"local_loads"`   // loaded by the local Getter
+	NegativeHits int64 `json:"negative_hits"` // answered by a cached ErrNotFound
+	StaleHits    int64 `json:"stale_hits"`    // served an expired entry while it is refreshed
+	Refreshes    int64 `json:"refreshes"`     // background loads of stale or expiring entries
+	StaleServes  int64 `json:"stale_serves"`  // served an expired entry because loading failed
+	FillFollows  int64 `json:"fill_follows"`  // loaded by another node holding the fill lock
+	Retries      int64 `json:"retries"`       // Getter calls retried after an error
+	Rejected     int64 `json:"rejected"`      // loads refused with ErrOverloaded
+	Shed         int64 `json:"shed"`          // requests refused by admission control
+}
+
+// stats 并发更新的统计计数
+type stats struct {
+	gets, cacheHits, peerLoads, peerErrors, loads, loadErrors, localLoads, negativeHits, staleHits, refreshes, staleServes, fillFollows, retries, rejectedLoads atomic.Int64
+}
+
+func (s *stats) snapshot() Stats {
+	return Stats{
+		Gets:         s.gets.Load(),
+		CacheHits:    s.cacheHits.Load(),
+		PeerLoads:    s.peerLoads.Load(),
+		PeerErrors:   s.peerErrors.Load(),
+		Loads:        s.loads.Load(),
+		LoadErrors:   s.loadErrors.Load(),
+		LocalLoads:   s.localLoads.Load(),
+		NegativeHits: s.negativeHits.Load(),
+		StaleHits:    s.staleHits.Load(),
+		Refreshes:    s.refreshes.Load(),
+		StaleServes:  s.staleServes.Load(),
+		FillFollows:  s.fillFollows.Load(),
+		Retries:      s.retries.Load(),
+		Rejected:     s.rejectedLoads.Load(),
+	}
+}
+
+// Name returns the name of the group.
+func (g *Group[K, V]) Name() string {
+	return g.name
+}
+
+// Stats returns a snapshot of the group statistics.
+func (g *Group[K, V]) Stats() Stats {
+	s := g.stats.snapshot()
+	s.Shed = g.opts.admission.Stats().Shed
+	return s
+}
+
+// Admit admits a request for the group before a server handles it, see
+// WithAdmission. On success done must be called with the outcome of the
+// request; otherwise the error wraps ErrOverloaded or is ctx.Err().
+func (g *Group[K, V]) Admit(ctx context.Context) (done func(err error), err error) {
+	return g.opts.admission.Acquire(ctx)
+}
+
+// Len returns the number of cached entries.
+func (g *Group[K, V]) Len() int64 {
+	return g.mainCache.Len()
+}
+
+// Purge drops every cached entry of the group on this node.
+func (g *Group[K, V]) Purge() {
+	g.mainCache.Clear()
+	if g.misses != nil {
+		g.misses.Clear()
+	}
+}
+
+// Remove drops key from the cache on this node, and the value shared
+// through the fill lock for it.
+func (g *Group[K, V]) Remove(key K) {
+	g.mainCache.Remove(key)
+	if g.misses != nil {
+		g.misses.Remove(key)
+	}
+	g.forgetFill(key)
+}
@@ -5,42 +5,179 @@ import (
 	"encoding/json"
 	"fmt"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"kunCache/auth"
+	"kunCache/conf"
 	"kunCache/grpc/pb/gcachepb"
+	"kunCache/peer"
+	"sync"
 )
 
 // client 模块实现了 groupcache 访问其他远程节点从而获取缓存的能力
 type client[K comparable, V any] struct {
 	name K // 服务名称 ip:port
+	opts []grpc.DialOption
+
+	mu   sync.Mutex
+	conn *grpc.ClientConn // 延迟建立，多次 Fetch 复用同一个连接
+}
+
+// dial returns the connection to the remote peer, creating it on first use.
+func (c *client[K, V]) dial() (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return c.conn, nil
+	}
+	// 默认明文，opts 中的 WithTransportCredentials 会覆盖
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, c.opts...)
+	conn, err := grpc.NewClient(fmt.Sprintf("%v", c.name), opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return conn, nil
 }
 
 // Fetch 从 remote peer 获取对应的缓存值
-func (c *client[K, V]) Fetch(group string, key K) (value V, err error) {
-	conn, err := grpc.Dial(fmt.Sprintf("%v", c.name), grpc.WithTransportCredentials(insecure.NewCredentials()))
+func (c *client[K, V]) Fetch(ctx context.Context, group string, key K) (value V, err error) {
+	conn, err := c.dial()
 	if err != nil {
 		return
 	}
 
 	grpcClient := gcachepb.NewGroupCacheClient(conn)
-	resp, err := grpcClient.Get(context.Background(), &gcachepb.Request{
+	resp, err := grpcClient.Get(ctx, &gcachepb.Request{
 		Group: group,
 		Key:   fmt.Sprintf("%v", key),
 	})
 	if err != nil {
-		fmt.Println(err)
-		return
+		return value, fromStatus(err)
 	}
-	err = json.Unmarshal(resp.Value, &value)
-	if err != nil {
-		fmt.Println(err)
-		return
+	if err := json.Unmarshal(resp.Value, &value); err != nil {
+		return value, fmt.Errorf("%w: %w", peer.ErrDecode, err)
 	}
 	//fmt.Println("value:", value)
-	return
+	return value, nil
+}
+
+// Transfer 把缓存条目批量推送给远端节点
+func (c *client[K, V]) Transfer(ctx context.Context, group string, entries []peer.Entry[K, V]) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	req := &gcachepb.TransferRequest{Group: group, Entries: make([]*gcachepb.Entry, 0, len(entries))}
+	for _, e := range entries {
+		data, err := json.Marshal(e.Value)
+		if err != nil {
+			return err
+		}
+		req.Entries = append(req.Entries, &gcachepb.Entry{Key: fmt.Sprintf("%v", e.Key), Value: data, Expires: e.Expires})
+	}
+	_, err = gcachepb.NewGroupCacheClient(conn).Transfer(ctx, req)
+	return fromStatus(err)
+}
+
+// Set 写入远端节点的缓存
+func (c *client[K, V]) Set(ctx context.Context, group string, key K, value V) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = gcachepb.NewGroupCacheClient(conn).Set(ctx, &gcachepb.SetRequest{
+		Group: group,
+		Key:   fmt.Sprintf("%v", key),
+		Value: data,
+	})
+	return fromStatus(err)
+}
+
+// Delete 删除远端节点缓存中的 key
+func (c *client[K, V]) Delete(ctx context.Context, group string, key K) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	_, err = gcachepb.NewGroupCacheClient(conn).Delete(ctx, &gcachepb.Request{
+		Group: group,
+		Key:   fmt.Sprintf("%v", key),
+	})
+	return fromStatus(err)
 }
 
-func NewClient[K comparable, V any](service K) *client[K, V] {
-	return &client[K, V]{name: service}
+// Check 调用远端节点的 gRPC 健康检查服务
+func (c *client[K, V]) Check(ctx context.Context) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("peer %v is %v", c.name, resp.GetStatus())
+	}
+	return nil
+}
+
+// Close 关闭到远端节点的连接
+func (c *client[K, V]) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// NewClient 创建访问远端节点的 client，opts 可以指定传输层凭证等连接参数
+func NewClient[K comparable, V any](service K, opts ...grpc.DialOption) *client[K, V] {
+	return &client[K, V]{name: service, opts: opts}
+}
+
+// NewFetcherFactory 按 c 中的 TLS 和鉴权配置创建访问 GRPC 节点的 FetcherFactory
+func NewFetcherFactory[K comparable, V any](c *conf.Config) (peer.FetcherFactory[K, V], error) {
+	opts, err := dialOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	return func(addr K) peer.Fetcher[K, V] {
+		return NewClient[K, V](addr, opts...)
+	}, nil
+}
+
+// dialOptions 连接其他节点时使用的传输层凭证和鉴权凭证
+func dialOptions(c *conf.Config) ([]grpc.DialOption, error) {
+	creds := insecure.NewCredentials()
+	if t := c.TLS; t != nil {
+		clientTLS, err := t.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("client tls: %w", err)
+		}
+		creds = credentials.NewTLS(clientTLS)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	guard, err := auth.FromConfig(c.Auth)
+	if err != nil {
+		return nil, err
+	}
+	if guard != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(auth.RPCCredentials{
+			Authenticator: guard.Authenticator,
+			Insecure:      c.TLS == nil,
+		}))
+	}
+	return opts, nil
 }
 
 // 测试 client 是否实现了 Fetcher 接口
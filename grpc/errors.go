@@ -0,0 +1,66 @@
+package grpcserver
+
+import (
+	"fmt"
+	"kunCache/peer"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain 是 ErrorInfo 中标识 kuncache 错误的 domain
+const errorDomain = "kuncache"
+
+// statusCodes 每种错误对应的 gRPC 状态码，其余为 Internal
+var statusCodes = map[peer.Code]codes.Code{
+	peer.CodeNotFound:      codes.NotFound,
+	peer.CodeGroupNotFound: codes.NotFound,
+	peer.CodeUnavailable:   codes.Unavailable,
+	peer.CodeTimeout:       codes.DeadlineExceeded,
+	peer.CodeLoader:        codes.Unavailable, // 与 HTTP 的 502 对应
+	peer.CodeDecode:        codes.InvalidArgument,
+	peer.CodeOverloaded:    codes.ResourceExhausted,
+}
+
+// statusError converts err to a gRPC status carrying its peer.Code as the
+// reason of an ErrorInfo detail, so the client can tell, say, a missing
+// key from a missing group although both are NotFound.
+func statusError(err error) error {
+	e := peer.NewError(err)
+	code, ok := statusCodes[e.Code]
+	if !ok {
+		code = codes.Internal
+	}
+	st := status.New(code, e.Message)
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: string(e.Code), Domain: errorDomain}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// fromStatus 还原 statusError 转换前的错误。没有 ErrorInfo 的状态由 gRPC 自身产生，
+// 例如连接不上节点或请求超时，按状态码判断
+func fromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.GetDomain() == errorDomain {
+			return &peer.Error{Code: peer.Code(info.GetReason()), Message: st.Message()}
+		}
+	}
+	switch st.Code() {
+	case codes.Unavailable:
+		return fmt.Errorf("%w: %w", peer.ErrUnavailable, err)
+	case codes.DeadlineExceeded:
+		return fmt.Errorf("%w: %w", peer.ErrTimeout, err)
+	case codes.ResourceExhausted:
+		return fmt.Errorf("%w: %w", peer.ErrOverloaded, err)
+	}
+	return err
+}
@@ -1,13 +1,23 @@
 package grpcserver
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"kunCache/admission"
 	"kunCache/conf"
-	"kunCache/etcd"
+	"kunCache/discovery"
 	"kunCache/gcache"
+	httpserver "kunCache/http"
+	"kunCache/internal/testcert"
+	"kunCache/peer"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -20,8 +30,8 @@ var db = map[string]string{
 	"CXK":  "2.5",
 }
 
-func createGroup(name string) *gcache.Group[string, []byte] {
-	return gcache.NewGroup[string, []byte]("scores", 2<<10, gcache.GetterFunc[string, []byte](
+func createGroup(t testing.TB, name string) *gcache.Group[string, []byte] {
+	g, err := gcache.NewGroup[string, []byte](name, 2<<10, gcache.GetterFunc[string, []byte](
 		func(key string) ([]byte, error) {
 			slog.Info("[SlowDB] search key", "key", key)
 			if v, ok := db[key]; ok {
@@ -30,22 +40,21 @@ func createGroup(name string) *gcache.Group[string, []byte] {
 			slog.Info("[not exist]", "key", key)
 			return nil, fmt.Errorf("%s not exist", key)
 		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup(name) })
+	return g
 }
 
 // 启动缓存服务器：创建 GRPC，添加节点信息，注册到 g 中，启动 GRPC 服务
-func startCacheGRPCServer(addr, ip, port, protocol string, g *gcache.Group[string, []byte]) {
-	server, err := NewServer[string, []byte](addr, ip, port, protocol)
+func startCacheGRPCServer(c *conf.Config, addr, ip, port, protocol string, g *gcache.Group[string, []byte]) {
+	server, err := NewServer[string, []byte](c, addr, ip, port, protocol)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	addrs, err := etcd.DiscoverPeers(conf.GConfig.Prefix)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	// 将节点打到哈希环上
-	server.AddPeers(addrs...)
+	// 节点由 Start 通过服务发现加入哈希环
 	// 为 Group 注册服务 Picker
 	g.RegisterServer(server)
 	log.Println("groupcache is running at ", fmt.Sprintf("%v:%v", ip, port))
@@ -79,21 +88,405 @@ func startAPIServer(apiAddr string, g *gcache.Group[string, []byte]) {
 }
 func TestGrpc(t *testing.T) {
 
-	//conf.Init("../conf/conf.json")
+	//c, _ := conf.Load("../conf/conf.json")
 	//go func() {
-	//	g := createGroup("ikun666")
-	//	go startAPIServer(conf.GConfig.ApiAddr, g)
-	//	startCacheGRPCServer("localhost:8000", "localhost", "8000", "GRPC", g)
+	//	g := createGroup(t, "ikun666")
+	//	go startAPIServer(c.ApiAddr, g)
+	//	startCacheGRPCServer(c, "localhost:8000", "localhost", "8000", "GRPC", g)
 	//}()
 	//go func() {
-	//	g := createGroup("ikun666")
-	//	startCacheGRPCServer("localhost:8100", "localhost", "8100", "GRPC", g)
+	//	g := createGroup(t, "ikun666")
+	//	startCacheGRPCServer(c, "localhost:8100", "localhost", "8100", "GRPC", g)
 	//}()
 	//go func() {
-	//	g := createGroup("ikun666")
-	//	startCacheGRPCServer("localhost:8200", "localhost", "8200", "GRPC", g)
+	//	g := createGroup(t, "ikun666")
+	//	startCacheGRPCServer(c, "localhost:8200", "localhost", "8200", "GRPC", g)
 	//}()
 	//
 	//select {}
 
 }
+
+func TestFetchOverMutualTLS(t *testing.T) {
+	certs := testcert.Generate(t)
+	c := &conf.Config{Replicas: 50, TLS: certs.Config(true)}
+	createGroup(t, "scores")
+
+	s, err := NewServer[string, []byte](c, "127.0.0.1:0", "127.0.0.1", "0", "GRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := s.newGRPCServer()
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	peerAddr := lis.Addr().String()
+	s.AddPeers(peerAddr)
+	v, err := s.clients[peerAddr].Fetch(context.Background(), "scores", "Tom")
+	if err != nil || string(v) != "630" {
+		t.Fatalf("fetch over mTLS got %q, %v", v, err)
+	}
+	if err := s.probe(context.Background(), peerAddr); err != nil {
+		t.Fatalf("health check over mTLS: %v", err)
+	}
+
+	// 明文客户端无法访问开启 TLS 的节点
+	plain := NewClient[string, []byte](peerAddr)
+	defer plain.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := plain.Fetch(ctx, "scores", "Tom"); err == nil {
+		t.Fatalf("plaintext fetch from a TLS server should fail")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	c := &conf.Config{Replicas: 50, Auth: &conf.AuthConfig{
+		Mode:    "jwt",
+		Secret:  "secret",
+		Subject: "node",
+		ACL:     map[string]conf.ACLRule{"scores": {Read: []string{"node"}}},
+	}}
+	createGroup(t, "scores")
+
+	s, err := NewServer[string, []byte](c, "127.0.0.1:0", "127.0.0.1", "0", "GRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := s.newGRPCServer()
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	peerAddr := lis.Addr().String()
+	s.AddPeers(peerAddr)
+	if v, err := s.clients[peerAddr].Fetch(context.Background(), "scores", "Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("authenticated fetch got %q, %v", v, err)
+	}
+	// 健康检查不需要凭证
+	anonymous := NewClient[string, []byte](peerAddr)
+	defer anonymous.Close()
+	if err := anonymous.Check(context.Background()); err != nil {
+		t.Fatalf("health check without credentials: %v", err)
+	}
+	if _, err := anonymous.Fetch(context.Background(), "scores", "Tom"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("fetch without credentials returned %v, want Unauthenticated", err)
+	}
+}
+
+func TestMixedProtocolPeers(t *testing.T) {
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50}
+	createGroup(t, "scores")
+
+	pool, err := httpserver.NewHTTPPool[string, []byte](c, "127.0.0.1:0", "127.0.0.1", "0", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpPeer := httptest.NewServer(pool)
+	defer httpPeer.Close()
+
+	s, err := NewServer[string, []byte](c, "127.0.0.1:0", "127.0.0.1", "0", "GRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpFetcher, err := httpserver.NewFetcherFactory[string, []byte](c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RegisterFetcher("HTTP", httpFetcher)
+
+	httpAddr := httpPeer.Listener.Addr().String()
+	s.AddProtocolPeers("HTTP", httpAddr)
+	s.AddProtocolPeers("SMTP", "127.0.0.1:25")
+	if s.consHash.Len() != 1 {
+		t.Fatalf("ring has %d peers, want only the HTTP peer", s.consHash.Len())
+	}
+
+	f, ok := s.Pick("Tom")
+	if !ok {
+		t.Fatalf("HTTP peer should be picked")
+	}
+	if v, err := f.Fetch(context.Background(), "scores", "Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("fetch from HTTP peer got %q, %v", v, err)
+	}
+	if err := s.probe(context.Background(), httpAddr); err != nil {
+		t.Fatalf("probe HTTP peer: %v", err)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	c := &conf.Config{Replicas: 50}
+	g, err := gcache.NewGroup[string, []byte]("transfer", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServer[string, []byte](c, "127.0.0.1:0", "127.0.0.1", "0", "GRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := s.newGRPCServer()
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	peerAddr := lis.Addr().String()
+	s.AddPeers(peerAddr)
+	addr, transferer, ok := s.Owner("Tom")
+	if !ok || addr != peerAddr {
+		t.Fatalf("owner of Tom = %v, %v; want %v", addr, ok, peerAddr)
+	}
+	expires := time.Now().Add(time.Minute).UnixNano()
+	err = transferer.Transfer(context.Background(), "transfer", []peer.Entry[string, []byte]{{Key: "Tom", Value: []byte("630"), Expires: expires}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("transferred key got %q, %v", v, err)
+	}
+}
+
+func TestSetDelete(t *testing.T) {
+	c := &conf.Config{Replicas: 50}
+	g, err := gcache.NewGroup[string, []byte]("mutate", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			return []byte("origin"), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServer[string, []byte](c, "127.0.0.1:0", "127.0.0.1", "0", "GRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := s.newGRPCServer()
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	cli := NewClient[string, []byte](lis.Addr().String())
+	defer cli.Close()
+	if err := cli.Set(context.Background(), "mutate", "Tom", []byte("set")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("Tom"); string(v) != "set" {
+		t.Fatalf("after set got %q", v)
+	}
+	if err := cli.Delete(context.Background(), "mutate", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("Tom"); string(v) != "origin" {
+		t.Fatalf("after delete got %q, want reloaded value", v)
+	}
+	if _, err := cli.Fetch(context.Background(), "unknown", "Tom"); !errors.Is(err, gcache.ErrGroupNotFound) {
+		t.Fatalf("unknown group: err = %v, want ErrGroupNotFound", err)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	c := &conf.Config{Replicas: 50}
+	_, err := gcache.NewGroup[string, []byte]("errors", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			switch key {
+			case "broken":
+				return nil, errors.New("db is down")
+			case "busy":
+				return nil, gcache.ErrOverloaded
+			}
+			return nil, fmt.Errorf("%w: %s", gcache.ErrNotFound, key)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("errors") })
+	s, err := NewServer[string, []byte](c, "127.0.0.1:0", "127.0.0.1", "0", "GRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := s.newGRPCServer()
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	cli := NewClient[string, []byte](lis.Addr().String())
+	defer cli.Close()
+	tests := []struct {
+		group, key string
+		want       error
+		notWant    error
+	}{
+		{"errors", "Tom", peer.ErrNotFound, peer.ErrGroupNotFound},
+		{"unknown", "Tom", peer.ErrGroupNotFound, peer.ErrNotFound},
+		{"errors", "broken", peer.ErrLoader, peer.ErrUnavailable},
+		{"errors", "busy", peer.ErrOverloaded, peer.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		if _, err := cli.Fetch(context.Background(), tt.group, tt.key); !errors.Is(err, tt.want) || errors.Is(err, tt.notWant) {
+			t.Errorf("Fetch(%s, %s) err = %v, want %v", tt.group, tt.key, err, tt.want)
+		}
+	}
+
+	grpcServer.Stop()
+	if _, err := cli.Fetch(context.Background(), "errors", "Tom"); !errors.Is(err, peer.ErrUnavailable) {
+		t.Fatalf("stopped peer: err = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestStatusCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{fmt.Errorf("%w: Tom", peer.ErrNotFound), codes.NotFound},
+		{fmt.Errorf("%w: db is down", peer.ErrLoader), codes.Unavailable},
+		{peer.ErrOverloaded, codes.ResourceExhausted},
+		{errors.New("boom"), codes.Internal},
+	}
+	for _, tt := range tests {
+		err := statusError(tt.err)
+		if got := status.Code(err); got != tt.code {
+			t.Errorf("statusError(%v) code = %v, want %v", tt.err, got, tt.code)
+		}
+		// 状态码相同的错误靠 ErrorInfo 还原
+		back := fromStatus(err)
+		if peer.CodeOf(back) != peer.CodeOf(tt.err) || back.Error() != tt.err.Error() {
+			t.Errorf("fromStatus(statusError(%v)) = %v", tt.err, back)
+		}
+	}
+	if peer.Unreachable(fromStatus(statusError(peer.ErrLoader))) {
+		t.Error("a remote load failure was taken for an unreachable peer")
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	c := &conf.Config{Replicas: 50, Admission: &conf.AdmissionConfig{MaxInFlight: 4, TargetLatency: 3600000}}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	g, err := gcache.NewGroup[string, []byte]("admission", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			close(started)
+			<-release
+			return []byte("slow"), nil
+		}), gcache.WithAdmission(admission.New(admission.Options{MaxInFlight: 1})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("admission") })
+	s, err := NewServer[string, []byte](c, "127.0.0.1:0", "127.0.0.1", "0", "GRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := s.newGRPCServer()
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+	cli := NewClient[string, []byte](lis.Addr().String())
+	defer cli.Close()
+
+	slow := make(chan error)
+	go func() {
+		_, err := cli.Fetch(context.Background(), "admission", "Tom")
+		slow <- err
+	}()
+	<-started
+	// 分组的名额被慢请求占用，其余请求以 ResourceExhausted 拒绝
+	_, err = cli.Fetch(context.Background(), "admission", "Jack")
+	if !errors.Is(err, peer.ErrOverloaded) {
+		t.Fatalf("err = %v, want ErrOverloaded", err)
+	}
+	// 写入同样受分组的并发限制
+	if err := cli.Set(context.Background(), "admission", "Jack", []byte("589")); !errors.Is(err, peer.ErrOverloaded) {
+		t.Fatalf("Set: err = %v, want ErrOverloaded", err)
+	}
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+	if n := g.Stats().Shed; n != 2 {
+		t.Fatalf("shed = %d, want 2", n)
+	}
+	// 分组拒绝的请求不让节点的上限收缩
+	if l := s.admission.Stats().Limit; l != 4 {
+		t.Fatalf("node limit = %d, want 4", l)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	_, err := gcache.NewGroup[string, []byte]("shutdown", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			close(started)
+			<-release
+			return []byte("slow"), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("shutdown") })
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	host, port, _ := net.SplitHostPort(addr)
+	s, err := NewServer[string, []byte](&conf.Config{Replicas: 50}, addr, host, port, "GRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetDiscovery(discovery.NewMemory())
+	served := make(chan error, 1)
+	go func() { served <- s.Start() }()
+	cli := NewClient[string, []byte](addr)
+	defer cli.Close()
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := cli.Fetch(context.Background(), "shutdown", "Tom")
+		slow <- err
+	}()
+	<-started
+	// 慢请求不结束时，ctx 到期后强制停止
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Shutdown took %v", d)
+	}
+	if err := <-slow; err == nil {
+		t.Fatal("in-flight request succeeded after a forced stop")
+	}
+	// Serve 在处理函数返回后才结束
+	close(release)
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -4,18 +4,28 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/google/go-cmp/cmp"
+	"io"
+	"kunCache/auth"
 	"kunCache/gcache"
+	"kunCache/health"
 	"kunCache/peer"
 	"log"
+	"log/slog"
 
 	"fmt"
 	"net"
 	"sync"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"kunCache/admission"
 	"kunCache/conf"
 	"kunCache/consistentHash"
-	"kunCache/etcd"
+	"kunCache/discovery"
 	"kunCache/grpc/pb/gcachepb"
 )
 
@@ -26,27 +36,101 @@ import (
 // server 和 Group 是解耦合的，所以 server 要自己实现并发控制
 type Server[K comparable, V any] struct {
 	gcachepb.UnimplementedGroupCacheServer
+	conf *conf.Config
 
 	Addr     string
 	IP       string
 	Port     string
 	Protocol string
-	Status   bool // true: running false: stop
-	mu       sync.Mutex
-	consHash *consistentHash.Map[K]
-	clients  map[K]*client[K, V]
+	// ListenAddr 监听地址，为空时监听 IP:Port；IP:Port 是注册到服务发现的对外地址
+	ListenAddr string
+	Status     bool // true: running false: stop
+	mu         sync.Mutex
+	consHash   *consistentHash.Map[K]
+	// 每个远端节点对应一个 Fetcher，按节点注册的协议由 factories 创建
+	clients   map[K]peer.Fetcher[K, V]
+	factories map[string]peer.FetcherFactory[K, V]
+	// health 记录远端节点的熔断状态，healthServer 对外提供 gRPC 健康检查
+	health       *health.Tracker[K]
+	healthServer *grpchealth.Server
+	// serverCreds 为 nil 时使用明文
+	serverCreds credentials.TransportCredentials
+	// guard 不为 nil 时校验请求的身份和分组权限，并为发出的请求附加凭证
+	guard *auth.Guard
+	// admission 限制同时处理的缓存请求数，为 nil 不限制
+	admission *admission.Limiter
+	// discovery 注册本节点并同步其他节点，cancelSync 停止同步
+	discovery  discovery.Discovery
+	cancelSync context.CancelFunc
+	grpcServer *grpc.Server
+	// ringListeners 哈希环变化后依次调用
+	ringListeners []func()
+}
+
+// methodOps 记录每个 RPC 方法对分组的操作类型，用于鉴权
+var methodOps = map[string]auth.Op{
+	"/GroupCache/Get":      auth.Read,
+	"/GroupCache/Transfer": auth.Write,
+	"/GroupCache/Set":      auth.Write,
+	"/GroupCache/Delete":   auth.Write,
 }
 
 // NewServer 创建 cache 的 server，若 addr 为空，则使用 defaultAddr
-func NewServer[K comparable, V any](addr, ip, port, protocol string) (*Server[K, V], error) {
-	return &Server[K, V]{
-		Addr:     addr,
-		IP:       ip,
-		Port:     port,
-		Protocol: protocol,
-		consHash: consistentHash.New[K](conf.GConfig.Replicas, nil),
-		clients:  make(map[K]*client[K, V]),
-	}, nil
+func NewServer[K comparable, V any](c *conf.Config, addr, ip, port, protocol string) (*Server[K, V], error) {
+	s := &Server[K, V]{
+		conf:         c,
+		Addr:         addr,
+		IP:           ip,
+		Port:         port,
+		Protocol:     protocol,
+		consHash:     consistentHash.New[K](c.Replicas, nil),
+		clients:      make(map[K]peer.Fetcher[K, V]),
+		factories:    make(map[string]peer.FetcherFactory[K, V]),
+		healthServer: grpchealth.NewServer(),
+	}
+	if t := c.TLS; t != nil {
+		serverTLS, err := t.ServerConfig()
+		if err != nil {
+			return nil, fmt.Errorf("server tls: %w", err)
+		}
+		s.serverCreds = credentials.NewTLS(serverTLS)
+	}
+	guard, err := auth.FromConfig(c.Auth)
+	if err != nil {
+		return nil, err
+	}
+	s.guard = guard
+	s.admission = admission.FromConfig(c.Admission)
+	factory, err := NewFetcherFactory[K, V](c)
+	if err != nil {
+		return nil, err
+	}
+	s.factories[protocol] = factory
+	s.health = health.NewTracker[K](health.OptionsFromConfig(c), s.probe)
+	return s, nil
+}
+
+// RegisterFetcher 指定访问某种协议节点时使用的 Fetcher，
+// 例如为 GRPC 节点注册 "HTTP" 协议，使其能访问 HTTP 节点
+func (s *Server[K, V]) RegisterFetcher(protocol string, factory peer.FetcherFactory[K, V]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.factories[protocol] = factory
+}
+
+// probe 通过远端节点的健康检查服务探测其状态
+func (s *Server[K, V]) probe(ctx context.Context, addr K) error {
+	s.mu.Lock()
+	f, ok := s.clients[addr]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("peer %v not found", addr)
+	}
+	c, ok := f.(peer.Checker)
+	if !ok {
+		return nil
+	}
+	return c.Check(ctx)
 }
 
 // Get 实现了 Groupcache service 的 Get 方法
@@ -56,21 +140,95 @@ func (s *Server[K, V]) Get(ctx context.Context, req *gcachepb.Request) (*gcachep
 	// logger.Logger.Infof("[groupcache server %s] Recv RPC Request - (%s)/(%s)", s.Addr, group, key)
 	log.Printf("[groupcache server %s] Recv RPC Request - (%s)/(%s)", fmt.Sprintf("%v:%v", s.IP, s.Port), groupName, key)
 	if key == "" || groupName == "" {
-		return resp, fmt.Errorf("key and group name is reqiured")
+		return resp, status.Error(codes.InvalidArgument, "key and group name is reqiured")
 	}
 
-	g := gcache.GetGroup[K, V](groupName)
-	if g == nil {
-		return resp, fmt.Errorf("group %s not found", groupName)
+	g, err := gcache.GetGroup[K, V](groupName)
+	if err != nil {
+		return resp, statusError(err)
+	}
+	done, err := s.admit(ctx, g)
+	if err != nil {
+		return resp, statusError(err)
 	}
 	view, err := g.Get((any)(key).(K))
+	done(err)
 	if err != nil {
-		return resp, err
+		return resp, statusError(err)
 	}
 	//fmt.Println("view:", view)
 	data, err := json.Marshal(view)
+	if err != nil {
+		return resp, statusError(err)
+	}
 	resp.Value = data
-	return resp, err
+	return resp, nil
+}
+
+// Transfer 接收其他节点迁移过来的缓存
+func (s *Server[K, V]) Transfer(ctx context.Context, req *gcachepb.TransferRequest) (*gcachepb.TransferResponse, error) {
+	resp := &gcachepb.TransferResponse{}
+	g, err := gcache.GetGroup[K, V](req.GetGroup())
+	if err != nil {
+		return resp, statusError(err)
+	}
+	done, err := s.admit(ctx, g)
+	if err != nil {
+		return resp, statusError(err)
+	}
+	defer done(nil)
+	entries := make([]peer.Entry[K, V], 0, len(req.GetEntries()))
+	for _, e := range req.GetEntries() {
+		var value V
+		if err := json.Unmarshal(e.GetValue(), &value); err != nil {
+			return resp, statusError(fmt.Errorf("%w: value of %s: %w", peer.ErrDecode, e.GetKey(), err))
+		}
+		entries = append(entries, peer.Entry[K, V]{Key: any(e.GetKey()).(K), Value: value, Expires: e.GetExpires()})
+	}
+	g.Import(entries)
+	return resp, nil
+}
+
+// Set 写入本节点的缓存
+func (s *Server[K, V]) Set(ctx context.Context, req *gcachepb.SetRequest) (*gcachepb.SetResponse, error) {
+	resp := &gcachepb.SetResponse{}
+	if req.GetKey() == "" || req.GetGroup() == "" {
+		return resp, status.Error(codes.InvalidArgument, "key and group name is reqiured")
+	}
+	g, err := gcache.GetGroup[K, V](req.GetGroup())
+	if err != nil {
+		return resp, statusError(err)
+	}
+	done, err := s.admit(ctx, g)
+	if err != nil {
+		return resp, statusError(err)
+	}
+	defer done(nil)
+	var value V
+	if err := json.Unmarshal(req.GetValue(), &value); err != nil {
+		return resp, statusError(fmt.Errorf("%w: %w", peer.ErrDecode, err))
+	}
+	g.Set(any(req.GetKey()).(K), value)
+	return resp, nil
+}
+
+// Delete 删除本节点缓存中的 key
+func (s *Server[K, V]) Delete(ctx context.Context, req *gcachepb.Request) (*gcachepb.DeleteResponse, error) {
+	resp := &gcachepb.DeleteResponse{}
+	if req.GetKey() == "" || req.GetGroup() == "" {
+		return resp, status.Error(codes.InvalidArgument, "key and group name is reqiured")
+	}
+	g, err := gcache.GetGroup[K, V](req.GetGroup())
+	if err != nil {
+		return resp, statusError(err)
+	}
+	done, err := s.admit(ctx, g)
+	if err != nil {
+		return resp, statusError(err)
+	}
+	defer done(nil)
+	g.Remove(any(req.GetKey()).(K))
+	return resp, nil
 }
 
 // Start 启动 Cache 服务
@@ -91,32 +249,40 @@ func (s *Server[K, V]) Start() error {
 	// 指定服务的 IP，无需将它们写死在 client 代码中
 	s.Status = true
 
-	lis, err := net.Listen("tcp", fmt.Sprintf("%v:%v", s.IP, s.Port))
+	listenAddr := s.ListenAddr
+	if listenAddr == "" {
+		listenAddr = fmt.Sprintf("%v:%v", s.IP, s.Port)
+	}
+	lis, err := net.Listen("tcp", listenAddr)
 	if err != nil {
-		return fmt.Errorf("failed to listen %s, error: %v", fmt.Sprintf("%v:%v", s.IP, s.Port), err)
+		s.Status = false
+		s.mu.Unlock()
+		return fmt.Errorf("failed to listen %s, error: %v", listenAddr, err)
 	}
-	grpcServer := grpc.NewServer()
-	gcachepb.RegisterGroupCacheServer(grpcServer, s)
+	grpcServer := s.newGRPCServer()
+	s.grpcServer = grpcServer
 
-	// 注册服务至 etcd
-	go func() {
-		// Register never return unless stop signal received (blocked)
-		etcd.Register(&etcd.Service{
-			Addr:     s.Addr,
-			IP:       s.IP,
-			Port:     s.Port,
-			Protocol: s.Protocol,
-		})
-
-		// close tcp listen
-		err = lis.Close()
+	// 注册服务并监听其他节点的上下线
+	if s.discovery == nil {
+		d, err := discovery.New(s.conf)
 		if err != nil {
-			log.Fatalln(err)
+			s.Status = false
+			s.mu.Unlock()
+			lis.Close()
+			return fmt.Errorf("create discovery: %w", err)
 		}
-		// logger.Logger.Infof("[%s] Revoke service and close tcp socket ok.", s.Addr)
-		fmt.Printf("[%s] Revoke service and close tcp socket ok.\n", fmt.Sprintf("%v:%v", s.IP, s.Port))
-	}()
-	go etcd.WatchPeers[K, V](s, conf.GConfig.Prefix)
+		s.discovery = d
+	}
+	if err := s.discovery.Register(context.Background(), s.Service()); err != nil {
+		s.Status = false
+		s.mu.Unlock()
+		lis.Close()
+		return fmt.Errorf("register %s, error: %v", s.Addr, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelSync = cancel
+	go discovery.Sync[K, V](ctx, s.discovery, s)
+	s.health.Start()
 	// logger.Logger.Infof("[%s] register service ok\n", s.Addr)
 	s.mu.Unlock()
 	// Serve接受侦听器列表上的传入连接，为每个连接创建一个新的ServerTransport和服务Goroutine。
@@ -128,61 +294,253 @@ func (s *Server[K, V]) Start() error {
 	return nil
 }
 
+// SetDiscovery 指定服务发现方式，需在 Start 之前调用，未指定时按配置创建
+func (s *Server[K, V]) SetDiscovery(d discovery.Discovery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.discovery = d
+}
+
+// Service 返回本节点在服务发现中的注册信息
+func (s *Server[K, V]) Service() *discovery.Service {
+	return &discovery.Service{
+		Addr:     s.Addr,
+		IP:       s.IP,
+		Port:     s.Port,
+		Protocol: s.Protocol,
+	}
+}
+
+// Discovery 返回使用的服务发现，Start 之前未指定时为 nil
+func (s *Server[K, V]) Discovery() discovery.Discovery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.discovery
+}
+
+// RingMembers 返回哈希环上的节点及其虚拟节点数
+func (s *Server[K, V]) RingMembers() map[K]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.consHash.Members()
+}
+
+// newGRPCServer 创建 grpc.Server 并注册缓存服务和健康检查服务
+func (s *Server[K, V]) newGRPCServer() *grpc.Server {
+	var opts []grpc.ServerOption
+	if s.serverCreds != nil {
+		opts = append(opts, grpc.Creds(s.serverCreds))
+	}
+	var interceptors []grpc.UnaryServerInterceptor
+	if s.guard != nil {
+		interceptors = append(interceptors, auth.UnaryServerInterceptor(s.guard, methodOps))
+	}
+	if len(interceptors) > 0 {
+		opts = append(opts, grpc.ChainUnaryInterceptor(interceptors...))
+	}
+	grpcServer := grpc.NewServer(opts...)
+	gcachepb.RegisterGroupCacheServer(grpcServer, s)
+	healthpb.RegisterHealthServer(grpcServer, s.healthServer)
+	s.healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	return grpcServer
+}
+
+// admit 先后经过节点和分组的并发限制，超过上限时排队，排不上则返回 ErrOverloaded。
+// done 传入请求的结果，只有超时和过载会让自适应上限收缩，分组拒绝的请求不影响节点
+func (s *Server[K, V]) admit(ctx context.Context, g *gcache.Group[K, V]) (done func(err error), err error) {
+	nodeDone, err := s.admission.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groupDone, err := g.Admit(ctx)
+	if err != nil {
+		nodeDone(nil)
+		return nil, err
+	}
+	return func(err error) {
+		groupDone(err)
+		nodeDone(err)
+	}, nil
+}
+
 // AddPeers 将远端主机 IP 配置到 Server 里
 // 这样 Server 就可以 Pick 它们了
 func (s *Server[K, V]) AddPeers(peersAddr ...K) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.AddProtocolPeers(s.Protocol, peersAddr...)
+}
 
+// AddProtocolPeers 加入使用 protocol 协议的远端节点，
+// 没有注册对应 Fetcher 的节点不会加入哈希环
+func (s *Server[K, V]) AddProtocolPeers(protocol string, peersAddr ...K) {
+	s.mu.Lock()
+	factory, ok := s.factories[protocol]
+	if !ok {
+		s.mu.Unlock()
+		slog.Error("[Server] no fetcher for protocol", "protocol", protocol, "peers", peersAddr)
+		return
+	}
 	s.consHash.Add(peersAddr...)
+	s.health.Add(peersAddr...)
 
 	for _, peersAddr := range peersAddr {
-		s.clients[peersAddr] = NewClient[K, V](peersAddr)
+		closeFetcher(s.clients[peersAddr])
+		s.clients[peersAddr] = factory(peersAddr)
 	}
+	s.mu.Unlock()
+	s.ringChanged()
 }
+
 func (s *Server[K, V]) DelPeers(peersAddr ...K) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	s.consHash.Remove(peersAddr...)
+	s.health.Remove(peersAddr...)
 
 	for _, peersAddr := range peersAddr {
+		closeFetcher(s.clients[peersAddr])
 		delete(s.clients, peersAddr)
 	}
+	s.mu.Unlock()
+	s.ringChanged()
 }
 
-// Pick 根据一致性哈希选举出 key 应该存放在的 cache
-// return false 代表从本地获取 cache
-func (s *Server[K, V]) Pick(key K) (peer.Fetcher[K, V], bool) {
+// OnRingChange 注册哈希环变化（节点加入或移除）后的回调
+func (s *Server[K, V]) OnRingChange(f func()) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.ringListeners = append(s.ringListeners, f)
+}
+
+func (s *Server[K, V]) ringChanged() {
+	s.mu.Lock()
+	listeners := s.ringListeners
+	s.mu.Unlock()
+	for _, f := range listeners {
+		f()
+	}
+}
 
-	peerAddr := s.consHash.Get(key)
-	// Pick itself
+// SetReplicas 以新的虚拟节点倍数重建哈希环，节点不变
+func (s *Server[K, V]) SetReplicas(replicas int) {
+	s.mu.Lock()
+	s.consHash.SetReplicas(replicas)
+	s.mu.Unlock()
+	s.ringChanged()
+}
 
-	if cmp.Equal(peerAddr, fmt.Sprintf("%v:%v", s.IP, s.Port)) {
-		// logger.Logger.Infof("oohhh! pick myself, i am %s\n", s.Addr)
-		fmt.Printf("oohhh! pick myself, i am %s\n", fmt.Sprintf("%v:%v", s.IP, s.Port))
+// Owner 返回哈希环上负责 key 的远端节点，不考虑其健康状态
+// key 属于自身或该节点不支持迁移时 ok 为 false
+func (s *Server[K, V]) Owner(key K) (addr K, t peer.Transferer[K, V], ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addr = s.consHash.Get(key)
+	if cmp.Equal(addr, fmt.Sprintf("%v:%v", s.IP, s.Port)) {
+		return addr, nil, false
+	}
+	t, ok = s.clients[addr].(peer.Transferer[K, V])
+	return addr, t, ok
+}
+
+// closeFetcher 关闭持有连接的 Fetcher
+func closeFetcher[K comparable, V any](f peer.Fetcher[K, V]) {
+	if c, ok := f.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// Pick 根据一致性哈希选举出 key 应该存放在的 cache
+// return false 代表从本地获取 cache
+func (s *Server[K, V]) Pick(key K) (peer.Fetcher[K, V], bool) {
+	fetchers := s.PickN(key, 1)
+	if len(fetchers) == 0 {
 		return nil, false
 	}
+	return fetchers[0], true
+}
 
-	// logger.Logger.Infof("[cache %s] pick remote peer: %s\n", s.Addr, peerAddr)
-	fmt.Printf("[cache %s] pick remote peer: %v,client:%v\n", fmt.Sprintf("%v:%v", s.IP, s.Port), peerAddr, s.clients[peerAddr])
-	return s.clients[peerAddr], true
+// PickN 按哈希环顺序选出最多 n 个远端节点
+// 熔断的节点会被跳过，顺延到哈希环上的下一个节点，遇到自身即停止
+func (s *Server[K, V]) PickN(key K, n int) []peer.Fetcher[K, V] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var fetchers []peer.Fetcher[K, V]
+	for _, peerAddr := range s.consHash.GetN(key, s.consHash.Len()) {
+		if len(fetchers) == n {
+			break
+		}
+		// Pick itself
+		if cmp.Equal(peerAddr, fmt.Sprintf("%v:%v", s.IP, s.Port)) {
+			slog.Debug("[Pick] pick myself", "addr", peerAddr)
+			break
+		}
+		if !s.health.Ready(peerAddr) {
+			slog.Info("[Pick] skip unhealthy peer", "addr", peerAddr, "state", s.health.State(peerAddr))
+			continue
+		}
+		c, ok := s.clients[peerAddr]
+		if !ok {
+			break
+		}
+		slog.Debug("[Pick] pick remote peer", "addr", peerAddr)
+		fetchers = append(fetchers, health.Wrap[K, V](s.health, peerAddr, c))
+	}
+	return fetchers
 }
 
 // Stop 停止 server 运行，如果 server 没有运行，这将是一个 no-op
 func (s *Server[K, V]) Stop() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.Status {
+		s.mu.Unlock()
 		return
 	}
-	// 发送停止 keepAlive 的信号，因为该节点要退出了，不需要再发送心跳探测了
+	// 注销服务并停止监听其他节点，因为该节点要退出了，不需要再发送心跳探测了
 	s.Status = false
-	s.clients = nil // 清空一致性哈希信息，帮助 GC 进行垃圾回收
-	s.consHash = nil
+	s.cancelSync()
+	if err := s.discovery.Deregister(context.Background(), s.Service()); err != nil {
+		slog.Error("[Server] deregister failed", "addr", s.Addr, "err", err)
+	}
+	s.healthServer.Shutdown()
+	s.health.Stop()
+	grpcServer := s.grpcServer
+	s.mu.Unlock()
+
+	// 等待正在处理的请求结束，处理请求时会调用 Pick，不能持有锁
+	grpcServer.GracefulStop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.clients {
+		closeFetcher(c)
+	}
+	s.clients = make(map[K]peer.Fetcher[K, V])
+	s.consHash = consistentHash.New[K](s.consHash.Replicas(), nil)
+	fmt.Printf("[%s] Revoke service and close tcp socket ok.\n", fmt.Sprintf("%v:%v", s.IP, s.Port))
+}
+
+// Shutdown stops the server like Stop, but once ctx expires it closes the
+// connections of the requests still in flight and returns ctx.Err()
+// without waiting for their handlers to return.
+func (s *Server[K, V]) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	grpcServer := s.grpcServer
+	s.mu.Unlock()
+	// 强制关闭连接。GracefulStop 持有 grpc 内部的锁等待处理函数返回，
+	// Stop 关闭连接后也要等它，所以不等 Stop 返回
+	if grpcServer != nil {
+		go grpcServer.Stop()
+	}
+	return ctx.Err()
 }
 
 // 测试 Server 是否实现了 Picker 接口
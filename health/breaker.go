@@ -0,0 +1,219 @@
+// Package health tracks the health of remote peers with a per-peer
+// circuit breaker, fed by fetch results and active probes.
+package health
+
+import (
+	"kunCache/conf"
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// Closed lets every request through and counts failures.
+	Closed State = iota
+	// Open rejects requests until OpenTimeout has elapsed.
+	Open
+	// HalfOpen lets a single trial request through to decide whether
+	// the breaker closes again or re-opens.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 10 * time.Second
+	defaultProbeInterval    = 5 * time.Second
+	defaultProbeTimeout     = time.Second
+)
+
+// Options configures a Breaker. Zero values select the defaults.
+type Options struct {
+	// FailureThreshold is the number of consecutive failures that trips
+	// the breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before it lets a
+	// trial request through.
+	OpenTimeout time.Duration
+	// SlowThreshold, if non-zero, counts successful calls slower than
+	// it as failures.
+	SlowThreshold time.Duration
+	// ProbeInterval is the period of active health probes.
+	ProbeInterval time.Duration
+	// ProbeTimeout bounds a single health probe.
+	ProbeTimeout time.Duration
+}
+
+// OptionsFromConfig builds Options from the health settings in c.
+func OptionsFromConfig(c *conf.Config) Options {
+	return Options{
+		FailureThreshold: c.FailureThreshold,
+		OpenTimeout:      time.Duration(c.OpenTimeout) * time.Second,
+		SlowThreshold:    time.Duration(c.SlowThreshold) * time.Millisecond,
+		ProbeInterval:    time.Duration(c.ProbeInterval) * time.Second,
+	}
+}
+
+func (o Options) withDefaults() Options {
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = defaultFailureThreshold
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = defaultOpenTimeout
+	}
+	if o.ProbeInterval <= 0 {
+		o.ProbeInterval = defaultProbeInterval
+	}
+	if o.ProbeTimeout <= 0 {
+		o.ProbeTimeout = defaultProbeTimeout
+	}
+	return o
+}
+
+// Breaker is a closed/open/half-open circuit breaker. It is safe for
+// concurrent use.
+type Breaker struct {
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	// trial 表示半开状态下已经放行了一个试探请求
+	trial bool
+}
+
+// NewBreaker creates a closed Breaker.
+func NewBreaker(opts Options) *Breaker {
+	return &Breaker{
+		opts: opts.withDefaults(),
+		now:  time.Now,
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	return b.state
+}
+
+// Ready reports whether Allow would let a request through, without taking
+// the half-open trial. Pickers use it for candidates that may never get a
+// request.
+func (b *Breaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	return b.state == Closed || (b.state == HalfOpen && !b.trial)
+}
+
+// Allow reports whether a request may be sent. In the half-open state
+// only one trial request is allowed until its outcome is recorded or it
+// is released.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	switch b.state {
+	case Closed:
+		return true
+	case HalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return false
+}
+
+// Record reports the outcome of a request. A call that returned an error
+// or took longer than SlowThreshold counts as a failure.
+func (b *Breaker) Record(latency time.Duration, err error) {
+	if err != nil || (b.opts.SlowThreshold > 0 && latency > b.opts.SlowThreshold) {
+		b.Failure()
+		return
+	}
+	b.Success()
+}
+
+// Release gives back the half-open trial taken by Allow when the request
+// ends without an outcome, e.g. because the caller cancelled it.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen {
+		b.trial = false
+	}
+}
+
+// Success records a successful request and closes the breaker.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = Closed
+	b.failures = 0
+	b.trial = false
+}
+
+// Failure records a failed request. It opens a closed breaker once
+// FailureThreshold consecutive failures are seen, and re-opens a
+// half-open one immediately.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	switch b.state {
+	case Closed:
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold {
+			b.open()
+		}
+	case HalfOpen:
+		b.open()
+	}
+}
+
+// probeSucceeded moves an open breaker to half-open without waiting for
+// OpenTimeout, so real traffic can confirm the recovery. A half-open
+// breaker gets its trial back in case the trial request was lost.
+func (b *Breaker) probeSucceeded() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open || b.state == HalfOpen {
+		b.state = HalfOpen
+		b.trial = false
+	}
+}
+
+func (b *Breaker) open() {
+	b.state = Open
+	b.openedAt = b.now()
+	b.failures = 0
+	b.trial = false
+}
+
+// advance moves an open breaker to half-open once OpenTimeout elapsed.
+// b.mu must be held.
+func (b *Breaker) advance() {
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.opts.OpenTimeout {
+		b.state = HalfOpen
+		b.trial = false
+	}
+}
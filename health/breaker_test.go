@@ -0,0 +1,158 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kunCache/peer"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(Options{FailureThreshold: 2, OpenTimeout: time.Second, SlowThreshold: 100 * time.Millisecond})
+	b.now = func() time.Time { return now }
+
+	b.Record(time.Millisecond, errors.New("boom"))
+	if b.State() != Closed || !b.Allow() {
+		t.Fatalf("one failure should not trip the breaker, state %v", b.State())
+	}
+	// 慢请求也算失败
+	b.Record(time.Second, nil)
+	if b.State() != Open || b.Allow() {
+		t.Fatalf("breaker should be open, state %v", b.State())
+	}
+
+	now = now.Add(time.Second)
+	if b.State() != HalfOpen {
+		t.Fatalf("breaker should be half-open after OpenTimeout, state %v", b.State())
+	}
+	if !b.Allow() {
+		t.Fatalf("half-open breaker should allow a trial request")
+	}
+	if b.Allow() {
+		t.Fatalf("half-open breaker should allow only one trial request")
+	}
+	b.Record(time.Millisecond, errors.New("boom"))
+	if b.State() != Open {
+		t.Fatalf("failed trial should re-open the breaker, state %v", b.State())
+	}
+
+	now = now.Add(time.Second)
+	if !b.Allow() {
+		t.Fatalf("half-open breaker should allow a trial request")
+	}
+	b.Record(time.Millisecond, nil)
+	if b.State() != Closed || !b.Allow() {
+		t.Fatalf("successful trial should close the breaker, state %v", b.State())
+	}
+}
+
+func TestTrackerProbe(t *testing.T) {
+	healthy := map[string]bool{"a": true, "b": false}
+	tr := NewTracker[string](Options{FailureThreshold: 1, OpenTimeout: time.Hour}, func(ctx context.Context, peer string) error {
+		if !healthy[peer] {
+			return errors.New("unhealthy")
+		}
+		return nil
+	})
+	tr.Add("a", "b")
+
+	tr.probeAll()
+	if tr.State("a") != Closed || tr.State("b") != Open {
+		t.Fatalf("got a=%v b=%v, want a=closed b=open", tr.State("a"), tr.State("b"))
+	}
+	if tr.Allow("b") {
+		t.Fatalf("open peer should not be allowed")
+	}
+
+	// 探测恢复后进入半开，由真实请求确认
+	healthy["b"] = true
+	tr.probeAll()
+	if tr.State("b") != HalfOpen || !tr.Allow("b") {
+		t.Fatalf("recovered peer should be half-open, got %v", tr.State("b"))
+	}
+
+	tr.Remove("b")
+	if !tr.Allow("b") || tr.State("b") != Closed {
+		t.Fatalf("untracked peer should be allowed")
+	}
+}
+
+// fetcherFunc 用函数实现 peer.Fetcher
+type fetcherFunc func(ctx context.Context, group, key string) (string, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, group, key string) (string, error) {
+	return f(ctx, group, key)
+}
+
+func TestTrialRecovers(t *testing.T) {
+	tr := NewTracker[string](Options{FailureThreshold: 1, OpenTimeout: 10 * time.Millisecond}, nil)
+	tr.Add("replica")
+	tr.Record("replica", 0, errors.New("boom"))
+	time.Sleep(20 * time.Millisecond)
+
+	ok := fetcherFunc(func(ctx context.Context, group, key string) (string, error) { return "v", nil })
+	slow := fetcherFunc(func(ctx context.Context, group, key string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	// 对冲选中但没有用到的副本不占用试探名额
+	for i := 0; i < 3; i++ {
+		if !tr.Ready("replica") {
+			t.Fatalf("pick %d: half-open replica should be ready", i)
+		}
+	}
+
+	// 被取消的请求交还试探名额
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Wrap[string, string](tr, "replica", slow).Fetch(ctx, "g", "k"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want Canceled", err)
+	}
+	if tr.State("replica") != HalfOpen || !tr.Ready("replica") {
+		t.Fatalf("cancelled trial should be released, state %v", tr.State("replica"))
+	}
+
+	// 试探请求进行中时不再放行其他请求
+	if !tr.Allow("replica") {
+		t.Fatal("trial should be allowed")
+	}
+	if _, err := Wrap[string, string](tr, "replica", ok).Fetch(context.Background(), "g", "k"); !errors.Is(err, peer.ErrUnavailable) {
+		t.Fatalf("second request during the trial: err = %v, want ErrUnavailable", err)
+	}
+	// 丢失的试探名额由探测成功收回
+	tr.breaker("replica").probeSucceeded()
+	if v, err := Wrap[string, string](tr, "replica", ok).Fetch(context.Background(), "g", "k"); err != nil || v != "v" {
+		t.Fatalf("trial fetch = %q, %v", v, err)
+	}
+	if tr.State("replica") != Closed {
+		t.Fatalf("successful trial should close the breaker, state %v", tr.State("replica"))
+	}
+}
+
+func TestApplicationErrors(t *testing.T) {
+	tr := NewTracker[string](Options{FailureThreshold: 1, OpenTimeout: time.Hour}, nil)
+	tr.Add("a")
+	var err error
+	f := Wrap[string, string](tr, "a", fetcherFunc(func(ctx context.Context, group, key string) (string, error) {
+		return "", err
+	}))
+
+	// 节点给出的应答不算故障
+	for _, code := range []peer.Code{peer.CodeNotFound, peer.CodeGroupNotFound, peer.CodeLoader, peer.CodeOverloaded, peer.CodeDecode, peer.CodeInternal} {
+		err = &peer.Error{Code: code, Message: string(code)}
+		f.Fetch(context.Background(), "g", "k")
+		if tr.State("a") != Closed {
+			t.Fatalf("%s opened the circuit", code)
+		}
+	}
+
+	err = fmt.Errorf("%w: connection refused", peer.ErrUnavailable)
+	f.Fetch(context.Background(), "g", "k")
+	if tr.State("a") != Open {
+		t.Fatalf("unavailable peer should open the circuit, got %v", tr.State("a"))
+	}
+}
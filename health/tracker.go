@@ -0,0 +1,196 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"kunCache/peer"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ProbeFunc actively checks whether a peer is able to serve requests.
+type ProbeFunc[K comparable] func(ctx context.Context, peer K) error
+
+// Tracker keeps a circuit breaker for every known peer.
+type Tracker[K comparable] struct {
+	opts  Options
+	probe ProbeFunc[K]
+
+	mu       sync.Mutex
+	breakers map[K]*Breaker
+	stop     chan struct{}
+}
+
+// NewTracker creates a Tracker. probe may be nil, in which case peers are
+// only judged by the results recorded for real requests.
+func NewTracker[K comparable](opts Options, probe ProbeFunc[K]) *Tracker[K] {
+	return &Tracker[K]{
+		opts:     opts.withDefaults(),
+		probe:    probe,
+		breakers: make(map[K]*Breaker),
+	}
+}
+
+// Add starts tracking peers. Peers already tracked keep their state.
+func (t *Tracker[K]) Add(peers ...K) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range peers {
+		if _, ok := t.breakers[p]; !ok {
+			t.breakers[p] = NewBreaker(t.opts)
+		}
+	}
+}
+
+// Remove stops tracking peers.
+func (t *Tracker[K]) Remove(peers ...K) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range peers {
+		delete(t.breakers, p)
+	}
+}
+
+func (t *Tracker[K]) breaker(p K) *Breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.breakers[p]
+}
+
+// Allow reports whether a request may be sent to the peer. Untracked
+// peers are always allowed.
+func (t *Tracker[K]) Allow(p K) bool {
+	if b := t.breaker(p); b != nil {
+		return b.Allow()
+	}
+	return true
+}
+
+// Ready reports whether a request could be sent to the peer, without
+// taking the half-open trial. Untracked peers are always ready.
+func (t *Tracker[K]) Ready(p K) bool {
+	if b := t.breaker(p); b != nil {
+		return b.Ready()
+	}
+	return true
+}
+
+// Release gives back the half-open trial of the peer, see Breaker.Release.
+func (t *Tracker[K]) Release(p K) {
+	if b := t.breaker(p); b != nil {
+		b.Release()
+	}
+}
+
+// State returns the breaker state of the peer. Untracked peers are
+// reported as Closed.
+func (t *Tracker[K]) State(p K) State {
+	if b := t.breaker(p); b != nil {
+		return b.State()
+	}
+	return Closed
+}
+
+// Record reports the outcome of a request sent to the peer.
+func (t *Tracker[K]) Record(p K, latency time.Duration, err error) {
+	if b := t.breaker(p); b != nil {
+		b.Record(latency, err)
+	}
+}
+
+// Start probes every tracked peer each ProbeInterval until Stop is called.
+// It is a no-op without a ProbeFunc or if the tracker is already started.
+func (t *Tracker[K]) Start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.probe == nil || t.stop != nil {
+		return
+	}
+	t.stop = make(chan struct{})
+	go t.run(t.stop)
+}
+
+// Stop stops active probing.
+func (t *Tracker[K]) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+func (t *Tracker[K]) run(stop chan struct{}) {
+	ticker := time.NewTicker(t.opts.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.probeAll()
+		}
+	}
+}
+
+// probeAll 并发探测所有节点，探测失败计入熔断器
+func (t *Tracker[K]) probeAll() {
+	t.mu.Lock()
+	peers := make(map[K]*Breaker, len(t.breakers))
+	for p, b := range t.breakers {
+		peers[p] = b
+	}
+	t.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for p, b := range peers {
+		wg.Add(1)
+		go func(p K, b *Breaker) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), t.opts.ProbeTimeout)
+			defer cancel()
+			if err := t.probe(ctx, p); err != nil {
+				slog.Info("[Health] probe failed", "peer", p, "err", err)
+				b.Failure()
+				return
+			}
+			b.probeSucceeded()
+		}(p, b)
+	}
+	wg.Wait()
+}
+
+// Wrap returns a Fetcher that asks the peer's breaker before every fetch
+// and records the outcome. Pickers check Ready only, so the half-open
+// trial is taken when a request is actually sent.
+func Wrap[K comparable, V any](t *Tracker[K], p K, f peer.Fetcher[K, V]) peer.Fetcher[K, V] {
+	return &trackedFetcher[K, V]{tracker: t, peer: p, fetcher: f}
+}
+
+type trackedFetcher[K comparable, V any] struct {
+	tracker *Tracker[K]
+	peer    K
+	fetcher peer.Fetcher[K, V]
+}
+
+func (f *trackedFetcher[K, V]) Fetch(ctx context.Context, group string, key K) (V, error) {
+	if !f.tracker.Allow(f.peer) {
+		var value V
+		return value, fmt.Errorf("%w: circuit of %v is open", peer.ErrUnavailable, f.peer)
+	}
+	start := time.Now()
+	value, err := f.fetcher.Fetch(ctx, group, key)
+	// 被调用方主动取消（例如对冲请求的另一路先返回）不算节点故障，交还试探名额
+	if ctx.Err() == context.Canceled {
+		f.tracker.Release(f.peer)
+		return value, err
+	}
+	// 只有连不上、超时和节点不可用算故障，节点给出的应用错误（key 不存在、加载失败、过载等）都是正常应答
+	var recorded error
+	if peer.Unreachable(err) || peer.CodeOf(err) == peer.CodeTimeout {
+		recorded = err
+	}
+	f.tracker.Record(f.peer, time.Since(start), recorded)
+	return value, err
+}
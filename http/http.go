@@ -1,11 +1,18 @@
 package httpserver
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/go-cmp/cmp"
 	"io"
+	"kunCache/admission"
+	"kunCache/auth"
 	"kunCache/gcache"
+	"kunCache/health"
 	"kunCache/peer"
 	"log/slog"
 	"net/http"
@@ -15,39 +22,117 @@ import (
 
 	"kunCache/conf"
 	"kunCache/consistentHash"
-	"kunCache/etcd"
+	"kunCache/discovery"
 )
 
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
 type HTTPPool[K comparable, V any] struct {
+	conf *conf.Config
 	// this peer's base URL, e.g. "localhostt:8000"
 	addr     string
 	ip       string
 	port     string
 	protocol string
 	basePath string
-	mu       sync.Mutex // guards peers and httpGetters
+	mu       sync.Mutex // guards peers and fetchers
 	peers    *consistentHash.Map[K]
-	//每一个远程节点对应一个 httpGetter
-	httpGetters map[K]*httpGetter[K, V] // keyed by e.g. "10.0.0.2:8008"
+	//每一个远程节点对应一个 Fetcher，按节点注册的协议由 factories 创建
+	fetchers  map[K]peer.Fetcher[K, V] // keyed by e.g. "10.0.0.2:8008"
+	factories map[string]peer.FetcherFactory[K, V]
+	//每一个远程节点的熔断状态
+	health *health.Tracker[K]
+	// serverTLS 不为 nil 时使用 HTTPS 监听
+	serverTLS *tls.Config
+	// guard 不为 nil 时校验请求的身份和分组权限，并为发出的请求附加凭证
+	guard *auth.Guard
+	// admission 限制同时处理的分组请求数，为 nil 不限制
+	admission *admission.Limiter
+	// discovery 注册本节点并同步其他节点
+	discovery discovery.Discovery
+	// ringListeners 哈希环变化后依次调用
+	ringListeners []func()
+	// listenAddr 监听地址，为空时监听 addr；addr 是注册到服务发现的对外地址
+	listenAddr string
+	server     *http.Server
 }
 
-// NewHTTPPool initializes an HTTP pool of peers.
-func NewHTTPPool[K comparable, V any](addr, ip, port, protocol string) *HTTPPool[K, V] {
-	return &HTTPPool[K, V]{
-		addr:        addr,
-		ip:          ip,
-		port:        port,
-		protocol:    protocol,
-		basePath:    conf.GConfig.HttpBasePath,
-		peers:       consistentHash.New[K](conf.GConfig.Replicas, nil),
-		httpGetters: make(map[K]*httpGetter[K, V]),
+const (
+	// healthPath is served by every HTTPPool and probed by its peers.
+	healthPath = "/_health"
+	// transferPath receives entries handed off by peers: POST /_transfer/<group>
+	transferPath = "/_transfer/"
+)
+
+// NewHTTPPool initializes an HTTP pool of peers configured by c.
+// 配置了 TLS 时节点间使用 HTTPS 通信
+func NewHTTPPool[K comparable, V any](c *conf.Config, addr, ip, port, protocol string) (*HTTPPool[K, V], error) {
+	p := &HTTPPool[K, V]{
+		conf:      c,
+		addr:      addr,
+		ip:        ip,
+		port:      port,
+		protocol:  protocol,
+		basePath:  c.HttpBasePath,
+		peers:     consistentHash.New[K](c.Replicas, nil),
+		fetchers:  make(map[K]peer.Fetcher[K, V]),
+		factories: make(map[string]peer.FetcherFactory[K, V]),
+	}
+	if t := c.TLS; t != nil {
+		serverTLS, err := t.ServerConfig()
+		if err != nil {
+			return nil, fmt.Errorf("server tls: %w", err)
+		}
+		p.serverTLS = serverTLS
+	}
+	guard, err := auth.FromConfig(c.Auth)
+	if err != nil {
+		return nil, err
+	}
+	p.guard = guard
+	p.admission = admission.FromConfig(c.Admission)
+	factory, err := NewFetcherFactory[K, V](c)
+	if err != nil {
+		return nil, err
+	}
+	p.factories[protocol] = factory
+	p.health = health.NewTracker[K](health.OptionsFromConfig(c), p.probe)
+	return p, nil
+}
+
+// RegisterFetcher sets the Fetcher used for peers registered with
+// protocol, e.g. "GRPC" so that an HTTP node can reach gRPC nodes.
+func (p *HTTPPool[K, V]) RegisterFetcher(protocol string, factory peer.FetcherFactory[K, V]) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.factories[protocol] = factory
+}
+
+// probe checks the health of a peer through its Fetcher.
+func (p *HTTPPool[K, V]) probe(ctx context.Context, addr K) error {
+	p.mu.Lock()
+	f, ok := p.fetchers[addr]
+	p.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("peer %v not found", addr)
 	}
+	c, ok := f.(peer.Checker)
+	if !ok {
+		return nil
+	}
+	return c.Check(ctx)
 }
 
 // ServeHTTP handle all http requests
 func (p *HTTPPool[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	slog.Info("[Server]", "addr", p.addr, "method", r.Method, "url", r.URL.Path, "basePath", p.basePath)
+	if r.URL.Path == healthPath {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, transferPath) {
+		p.serveTransfer(w, r, r.URL.Path[len(transferPath):])
+		return
+	}
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		// panic("HTTPPool serving unexpected path: " + r.URL.Path)
 		slog.Error("HTTPPool serving unexpected path", "url", r.URL.Path)
@@ -64,113 +149,567 @@ func (p *HTTPPool[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	groupName := parts[0]
 	key := parts[1]
 
-	group := gcache.GetGroup[K, V](groupName)
-	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+	// PUT/DELETE 只修改本节点的缓存，需要写权限
+	op := auth.Read
+	if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+		op = auth.Write
+	}
+	if !p.authorize(w, r, groupName, op) {
+		return
+	}
+
+	group, err := gcache.GetGroup[K, V](groupName)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	// 超过节点或分组的并发上限时排队，排不上则直接返回 503
+	done, err := p.admit(r.Context(), group)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	// outcome 只记录加载的结果，交给并发限制调整上限
+	var outcome error
+	defer func() { done(outcome) }()
+
+	switch r.Method {
+	case http.MethodPut:
+		var value V
+		if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+			WriteError(w, fmt.Errorf("%w: %w", peer.ErrDecode, err))
+			return
+		}
+		group.Set(any(key).(K), value)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodDelete:
+		group.Remove(any(key).(K))
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
 	view, err := group.Get(any(key).(K))
+	outcome = err
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 	//w.Header().Set("Content-Type", "application/octet-stream")
 	//w.Write(view)
 	data, err := json.Marshal(view)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
+		return
 	}
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Write(data)
 }
 
+// serveTransfer 接收其他节点迁移过来的缓存
+func (p *HTTPPool[K, V]) serveTransfer(w http.ResponseWriter, r *http.Request, groupName string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !p.authorize(w, r, groupName, auth.Write) {
+		return
+	}
+	group, err := gcache.GetGroup[K, V](groupName)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	done, err := p.admit(r.Context(), group)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	defer done(nil)
+	var entries []peer.Entry[K, V]
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		WriteError(w, fmt.Errorf("%w: %w", peer.ErrDecode, err))
+		return
+	}
+	group.Import(entries)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// admit 让请求依次占用节点和分组的名额。分组拒绝时归还节点的名额，不算节点的失败
+func (p *HTTPPool[K, V]) admit(ctx context.Context, group *gcache.Group[K, V]) (done func(err error), err error) {
+	nodeDone, err := p.admission.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groupDone, err := group.Admit(ctx)
+	if err != nil {
+		nodeDone(nil)
+		return nil, err
+	}
+	return func(err error) {
+		groupDone(err)
+		nodeDone(err)
+	}, nil
+}
+
+// statusCodes 每种错误对应的 HTTP 状态码，其余为 500
+var statusCodes = map[peer.Code]int{
+	peer.CodeNotFound:      http.StatusNotFound,
+	peer.CodeGroupNotFound: http.StatusNotFound,
+	peer.CodeUnavailable:   http.StatusServiceUnavailable,
+	peer.CodeTimeout:       http.StatusGatewayTimeout,
+	peer.CodeLoader:        http.StatusBadGateway,
+	peer.CodeDecode:        http.StatusBadRequest,
+	peer.CodeOverloaded:    http.StatusServiceUnavailable,
+}
+
+// statusClientClosedRequest 是 nginx 约定的客户端已断开的状态码，标准库没有定义
+const statusClientClosedRequest = 499
+
+// WriteError answers with err as a JSON peer.Error, e.g.
+// {"code":"not_found","message":"kuncache: not found: Tom"}, and the HTTP
+// status of its kind. context.DeadlineExceeded answers 504 and
+// context.Canceled, meaning the client went away, answers 499.
+func WriteError(w http.ResponseWriter, err error) {
+	e := peer.NewError(err)
+	status, ok := statusCodes[e.Code]
+	switch {
+	case errors.Is(err, context.Canceled):
+		status = statusClientClosedRequest
+	case !ok:
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// readError 还原响应中的错误。响应体不是 peer.Error 时（例如经过代理）按状态码判断
+func readError(res *http.Response) error {
+	var e peer.Error
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") &&
+		json.NewDecoder(res.Body).Decode(&e) == nil && e.Code != "" {
+		return &e
+	}
+	switch res.StatusCode {
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return fmt.Errorf("%w: server returned: %v", peer.ErrUnavailable, res.Status)
+	case http.StatusGatewayTimeout:
+		return fmt.Errorf("%w: server returned: %v", peer.ErrTimeout, res.Status)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w: server returned: %v", peer.ErrOverloaded, res.Status)
+	}
+	return fmt.Errorf("server returned: %v", res.Status)
+}
+
+// transportError 区分请求超时和连接不上节点，主动取消的请求原样返回
+func transportError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", peer.ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: %w", peer.ErrUnavailable, err)
+}
+
+// authorize 校验请求携带的凭证，失败时写入 401/403 并返回 false
+func (p *HTTPPool[K, V]) authorize(w http.ResponseWriter, r *http.Request, group string, op auth.Op) bool {
+	if p.guard == nil {
+		return true
+	}
+	if _, err := p.guard.Check(auth.BearerToken(r.Header.Get("Authorization")), group, op); err != nil {
+		slog.Info("[Server] rejected request", "url", r.URL.Path, "err", err)
+		if errors.Is(err, auth.ErrPermissionDenied) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+		return false
+	}
+	return true
+}
+
 // Set updates the pool's list of peers.
 // 加入节点
 func (p *HTTPPool[K, V]) AddPeers(peers ...K) {
+	p.AddProtocolPeers(p.protocol, peers...)
+}
+
+// AddProtocolPeers adds peers that speak protocol. Peers whose protocol
+// has no registered Fetcher are not added to the ring.
+func (p *HTTPPool[K, V]) AddProtocolPeers(protocol string, peers ...K) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	factory, ok := p.factories[protocol]
+	if !ok {
+		p.mu.Unlock()
+		slog.Error("[Server] no fetcher for protocol", "protocol", protocol, "peers", peers)
+		return
+	}
 	p.peers.Add(peers...)
+	p.health.Add(peers...)
 	for _, peer := range peers {
-		//"10.0.0.2:8008/_gcache/"
-		p.httpGetters[peer] = &httpGetter[K, V]{baseURL: fmt.Sprintf("%v%v", peer, p.basePath)}
+		closeFetcher(p.fetchers[peer])
+		p.fetchers[peer] = factory(peer)
 	}
+	p.mu.Unlock()
+	p.ringChanged()
 }
+
 func (p *HTTPPool[K, V]) DelPeers(peers ...K) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
 	p.peers.Remove(peers...)
+	p.health.Remove(peers...)
 	for _, peer := range peers {
-		delete(p.httpGetters, peer)
+		closeFetcher(p.fetchers[peer])
+		delete(p.fetchers, peer)
+	}
+	p.mu.Unlock()
+	p.ringChanged()
+}
+
+// OnRingChange registers f to be called after peers are added or removed.
+func (p *HTTPPool[K, V]) OnRingChange(f func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ringListeners = append(p.ringListeners, f)
+}
+
+func (p *HTTPPool[K, V]) ringChanged() {
+	p.mu.Lock()
+	listeners := p.ringListeners
+	p.mu.Unlock()
+	for _, f := range listeners {
+		f()
+	}
+}
+
+// SetReplicas rebuilds the ring with replicas virtual nodes per peer,
+// keeping the same peers.
+func (p *HTTPPool[K, V]) SetReplicas(replicas int) {
+	p.mu.Lock()
+	p.peers.SetReplicas(replicas)
+	p.mu.Unlock()
+	p.ringChanged()
+}
+
+// Owner returns the peer that owns key on the ring, ignoring its health.
+// ok is false when this node owns key or the owner cannot take transfers.
+func (p *HTTPPool[K, V]) Owner(key K) (addr K, t peer.Transferer[K, V], ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	addr = p.peers.Get(key)
+	if cmp.Equal(addr, p.addr) {
+		return addr, nil, false
+	}
+	t, ok = p.fetchers[addr].(peer.Transferer[K, V])
+	return addr, t, ok
+}
+
+// closeFetcher releases the connection held by a Fetcher, if any.
+func closeFetcher[K comparable, V any](f peer.Fetcher[K, V]) {
+	if c, ok := f.(io.Closer); ok {
+		c.Close()
 	}
 }
 
 // PickPeer picks a peer according to key
 func (p *HTTPPool[K, V]) Pick(key K) (peer.Fetcher[K, V], bool) {
+	fetchers := p.PickN(key, 1)
+	if len(fetchers) == 0 {
+		return nil, false
+	}
+	return fetchers[0], true
+}
+
+// PickN picks up to n peers in ring order for key.
+// 熔断的节点会被跳过，顺延到哈希环上的下一个节点
+func (p *HTTPPool[K, V]) PickN(key K, n int) []peer.Fetcher[K, V] {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	addr := p.peers.Get(key)
-	slog.Info("[Pick]", "addr", addr, "p.addr", p.addr, "p.httpGetters[peer]", p.httpGetters[addr])
-	//fmt.Println(cmp.Equal(addr, p.addr))
-	//选择的节点不能是空和自身 选自己会一直调用自己
-	if !cmp.Equal(addr, p.addr) {
-		getter, ok := p.httpGetters[addr]
-		//fmt.Println(getter, ok)
-		return getter, ok
-	}
-	return nil, false
-	//if peer != "" && peer != p.addr {
-	//	return p.httpGetters[peer], true
-	//}
-	//return nil, false
+	var fetchers []peer.Fetcher[K, V]
+	for _, addr := range p.peers.GetN(key, p.peers.Len()) {
+		//选择的节点不能是自身 选自己会一直调用自己
+		if cmp.Equal(addr, p.addr) || len(fetchers) == n {
+			break
+		}
+		if !p.health.Ready(addr) {
+			slog.Info("[Pick] skip unhealthy peer", "addr", addr, "state", p.health.State(addr))
+			continue
+		}
+		getter, ok := p.fetchers[addr]
+		slog.Info("[Pick]", "addr", addr, "p.addr", p.addr, "p.fetchers[peer]", getter)
+		if !ok {
+			break
+		}
+		fetchers = append(fetchers, health.Wrap[K, V](p.health, addr, getter))
+	}
+	return fetchers
+}
+
+// NewFetcherFactory returns a FetcherFactory for HTTP peers, using the
+// TLS and auth settings in c.
+func NewFetcherFactory[K comparable, V any](c *conf.Config) (peer.FetcherFactory[K, V], error) {
+	scheme, client := "http", http.DefaultClient
+	if t := c.TLS; t != nil {
+		clientTLS, err := t.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("client tls: %w", err)
+		}
+		scheme = "https"
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+	}
+	guard, err := auth.FromConfig(c.Auth)
+	if err != nil {
+		return nil, err
+	}
+	basePath := c.HttpBasePath
+	return func(addr K) peer.Fetcher[K, V] {
+		//"http://10.0.0.2:8008/_gcache/"
+		h := &httpGetter[K, V]{
+			baseURL:     fmt.Sprintf("%v://%v%v", scheme, addr, basePath),
+			healthURL:   fmt.Sprintf("%v://%v%v", scheme, addr, healthPath),
+			transferURL: fmt.Sprintf("%v://%v%v", scheme, addr, transferPath),
+			client:      client,
+		}
+		if guard != nil {
+			h.auth = guard.Authenticator
+		}
+		return h
+	}, nil
 }
 
 // HTTP 客户端类
 type httpGetter[K comparable, V any] struct {
-	baseURL string
+	baseURL     string
+	healthURL   string
+	transferURL string
+	client      *http.Client
+	auth        auth.Authenticator // 不为 nil 时为请求附加凭证
+}
+
+// authorize 为请求附加凭证
+func (h *httpGetter[K, V]) authorize(req *http.Request) error {
+	if h.auth == nil {
+		return nil
+	}
+	token, err := h.auth.Token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Check requests the health route of the peer.
+func (h *httpGetter[K, V]) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.healthURL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned: %v", res.Status)
+	}
+	return nil
 }
 
 // HTTP 客户端类 httpGetter，实现 Fetch 接口。
-func (h *httpGetter[K, V]) Fetch(group string, key K) (value V, err error) {
-	u := fmt.Sprintf(
-		"http://%v%v/%v",
-		h.baseURL,
-		url.QueryEscape(group),
-		url.QueryEscape(fmt.Sprint(key)),
-	)
+func (h *httpGetter[K, V]) Fetch(ctx context.Context, group string, key K) (value V, err error) {
+	u := h.keyURL(group, key)
 	//fmt.Println(u)
-	res, err := http.Get(u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return
 	}
+	if err = h.authorize(req); err != nil {
+		return
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return value, transportError(err)
+	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return value, fmt.Errorf("server returned: %v", res.Status)
+		return value, readError(res)
 	}
 
 	bytes, err := io.ReadAll(res.Body)
 	if err != nil {
-		return value, fmt.Errorf("reading response body: %v", err)
+		return value, transportError(fmt.Errorf("reading response body: %w", err))
+	}
+	if err := json.Unmarshal(bytes, &value); err != nil {
+		return value, fmt.Errorf("%w: %w", peer.ErrDecode, err)
+	}
+	return value, nil
+}
+
+// keyURL 返回 key 在远端节点上的地址
+func (h *httpGetter[K, V]) keyURL(group string, key K) string {
+	return fmt.Sprintf(
+		"%v%v/%v",
+		h.baseURL,
+		url.QueryEscape(group),
+		url.QueryEscape(fmt.Sprint(key)),
+	)
+}
+
+// do 发送请求，响应状态码不是 want 时返回错误
+func (h *httpGetter[K, V]) do(req *http.Request, want int) error {
+	if err := h.authorize(req); err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return transportError(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != want {
+		return readError(res)
+	}
+	return nil
+}
+
+// Set stores value for key in the cache of the peer.
+func (h *httpGetter[K, V]) Set(ctx context.Context, group string, key K, value V) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, h.keyURL(group, key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return h.do(req, http.StatusNoContent)
+}
+
+// Delete drops key from the cache of the peer.
+func (h *httpGetter[K, V]) Delete(ctx context.Context, group string, key K) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, h.keyURL(group, key), nil)
+	if err != nil {
+		return err
+	}
+	return h.do(req, http.StatusNoContent)
+}
+
+// Transfer posts entries to the peer's transfer route.
+func (h *httpGetter[K, V]) Transfer(ctx context.Context, group string, entries []peer.Entry[K, V]) error {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	u := h.transferURL + url.PathEscape(group)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return h.do(req, http.StatusNoContent)
+}
+
+// SetDiscovery sets how the pool registers itself and finds its peers. It
+// must be called before Start; by default the config selects one.
+func (p *HTTPPool[K, V]) SetDiscovery(d discovery.Discovery) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.discovery = d
+}
+
+// Service returns how this node registers itself with discovery.
+func (p *HTTPPool[K, V]) Service() *discovery.Service {
+	return &discovery.Service{
+		Addr:     p.addr,
+		IP:       p.ip,
+		Port:     p.port,
+		Protocol: p.protocol,
 	}
-	json.Unmarshal(bytes, &value)
-	return
+}
+
+// Discovery returns the discovery in use, or nil before Start unless
+// SetDiscovery was called.
+func (p *HTTPPool[K, V]) Discovery() discovery.Discovery {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.discovery
+}
+
+// RingMembers returns the peers on the ring with their virtual node counts.
+func (p *HTTPPool[K, V]) RingMembers() map[K]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peers.Members()
 }
 
 // Start 启动 Cache 服务
 func (p *HTTPPool[K, V]) Start() error {
-	// 注册服务至 etcd
-	go func() {
-		// Register never return unless stop signal received (blocked)
-		etcd.Register(&etcd.Service{
-			Addr:     p.addr,
-			IP:       p.ip,
-			Port:     p.port,
-			Protocol: p.protocol,
-		})
-	}()
-	go etcd.WatchPeers[K, V](p, conf.GConfig.Prefix)
-	//TODO
-
-	return http.ListenAndServe(p.addr, p)
+	p.mu.Lock()
+	if p.discovery == nil {
+		d, err := discovery.New(p.conf)
+		if err != nil {
+			p.mu.Unlock()
+			return fmt.Errorf("create discovery: %w", err)
+		}
+		p.discovery = d
+	}
+	d := p.discovery
+	p.mu.Unlock()
+
+	// 注册服务并监听其他节点的上下线
+	service := p.Service()
+	if err := d.Register(context.Background(), service); err != nil {
+		return fmt.Errorf("register %s: %w", p.addr, err)
+	}
+	defer d.Deregister(context.Background(), service)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go discovery.Sync[K, V](ctx, d, p)
+	p.health.Start()
+	defer p.health.Stop()
+
+	p.mu.Lock()
+	listenAddr := p.listenAddr
+	if listenAddr == "" {
+		listenAddr = p.addr
+	}
+	server := &http.Server{Addr: listenAddr, Handler: p, TLSConfig: p.serverTLS}
+	p.server = server
+	p.mu.Unlock()
+	var err error
+	if p.serverTLS != nil {
+		// 证书已经在 TLSConfig 中
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// SetListenAddr makes Start listen on addr, e.g. "0.0.0.0:8001", while the
+// pool keeps registering its own address with discovery. It must be called
+// before Start.
+func (p *HTTPPool[K, V]) SetListenAddr(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listenAddr = addr
+}
+
+// Stop gracefully shuts down a started pool: Start deregisters the node and
+// returns once in-flight requests are done or ctx expires.
+func (p *HTTPPool[K, V]) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	server := p.server
+	p.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
 }
@@ -1,12 +1,20 @@
 package httpserver
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"kunCache/admission"
+	"kunCache/auth"
 	"kunCache/conf"
-	"kunCache/etcd"
+	"kunCache/internal/testcert"
+	"kunCache/peer"
 	"log"
 	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -21,8 +29,8 @@ var db = map[string]string{
 	"CXK":  "2.5",
 }
 
-func createGroup(name string) *gcache.Group[string, []byte] {
-	return gcache.NewGroup[string, []byte]("scores", 2<<10, gcache.GetterFunc[string, []byte](
+func createGroup(t testing.TB, name string) *gcache.Group[string, []byte] {
+	g, err := gcache.NewGroup[string, []byte](name, 2<<10, gcache.GetterFunc[string, []byte](
 		func(key string) ([]byte, error) {
 			slog.Info("[SlowDB] search key", "key", key)
 			if v, ok := db[key]; ok {
@@ -31,19 +39,22 @@ func createGroup(name string) *gcache.Group[string, []byte] {
 			slog.Info("[not exist]", "key", key)
 			return nil, fmt.Errorf("%s not exist", key)
 		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup(name) })
+	return g
 }
 
 // 启动缓存服务器：创建 HTTPPool，添加节点信息，注册到 g 中，启动 HTTP 服务
 
-func startCacheHTTPServer(addr, ip, port, protocol string, g *gcache.Group[string, []byte]) {
-	server := NewHTTPPool[string, []byte](addr, ip, port, protocol)
-	addrs, err := etcd.DiscoverPeers(conf.GConfig.Prefix)
+func startCacheHTTPServer(c *conf.Config, addr, ip, port, protocol string, g *gcache.Group[string, []byte]) {
+	server, err := NewHTTPPool[string, []byte](c, addr, ip, port, protocol)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	// 将节点打到哈希环上
-	server.AddPeers(addrs...)
+	// 节点由 Start 通过服务发现加入哈希环
 	// 为 Group 注册服务 Picker
 	g.RegisterServer(server)
 	slog.Info("gcache is running at", "addr", addr)
@@ -76,21 +87,424 @@ func startAPIServer(apiAddr string, g *gcache.Group[string, []byte]) {
 }
 func TestHttp(t *testing.T) {
 
-	//conf.Init("../conf/conf.json")
+	//c, _ := conf.Load("../conf/conf.json")
 	//go func() {
-	//	g := createGroup("ikun666")
-	//	go startAPIServer(conf.GConfig.ApiAddr, g)
-	//	startCacheHTTPServer("localhost:8000", "localhost", "8000", "HTTP", g)
+	//	g := createGroup(t, "ikun666")
+	//	go startAPIServer(c.ApiAddr, g)
+	//	startCacheHTTPServer(c, "localhost:8000", "localhost", "8000", "HTTP", g)
 	//}()
 	//go func() {
-	//	g := createGroup("ikun666")
-	//	startCacheHTTPServer("localhost:8100", "localhost", "8100", "HTTP", g)
+	//	g := createGroup(t, "ikun666")
+	//	startCacheHTTPServer(c, "localhost:8100", "localhost", "8100", "HTTP", g)
 	//}()
 	//go func() {
-	//	g := createGroup("ikun666")
-	//	startCacheHTTPServer("localhost:8200", "localhost", "8200", "HTTP", g)
+	//	g := createGroup(t, "ikun666")
+	//	startCacheHTTPServer(c, "localhost:8200", "localhost", "8200", "HTTP", g)
 	//}()
 	//
 	//select {}
 
 }
+
+func TestPickSkipsUnhealthyPeer(t *testing.T) {
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50, FailureThreshold: 1}
+	p, err := NewHTTPPool[string, []byte](c, "localhost:8000", "localhost", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AddPeers("localhost:8000", "localhost:8100")
+
+	// 找一个归属远端节点的 key
+	var key string
+	for _, k := range []string{"Tom", "Jack", "Sam", "IKUN", "CXK"} {
+		if p.peers.Get(k) == "localhost:8100" {
+			key = k
+			break
+		}
+	}
+	if key == "" {
+		t.Skip("no key owned by the remote peer")
+	}
+	if _, ok := p.Pick(key); !ok {
+		t.Fatalf("healthy remote owner of %s should be picked", key)
+	}
+
+	p.health.Record("localhost:8100", 0, fmt.Errorf("boom"))
+	if _, ok := p.Pick(key); ok {
+		t.Fatalf("unhealthy peer should be skipped, falling back to self for %s", key)
+	}
+}
+
+func TestSetReplicas(t *testing.T) {
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50}
+	p, err := NewHTTPPool[string, []byte](c, "localhost:8000", "localhost", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AddPeers("localhost:8000", "localhost:8100")
+	changed := false
+	p.OnRingChange(func() { changed = true })
+
+	p.SetReplicas(10)
+	if got := p.RingMembers(); got["localhost:8000"] != 10 || got["localhost:8100"] != 10 {
+		t.Fatalf("ring members = %v, want 10 virtual nodes each", got)
+	}
+	if !changed {
+		t.Fatal("ring listeners should run after the ring is rebuilt")
+	}
+}
+
+func TestHealthRoute(t *testing.T) {
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50}
+	p, err := NewHTTPPool[string, []byte](c, "localhost:8000", "localhost", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	p.AddPeers(srv.Listener.Addr().String())
+	if err := p.probe(context.Background(), srv.Listener.Addr().String()); err != nil {
+		t.Fatalf("probe healthy peer: %v", err)
+	}
+}
+
+func TestFetchOverMutualTLS(t *testing.T) {
+	certs := testcert.Generate(t)
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50, TLS: certs.Config(true)}
+	createGroup(t, "scores")
+
+	p, err := NewHTTPPool[string, []byte](c, "127.0.0.1:8000", "127.0.0.1", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(p)
+	srv.TLS = p.serverTLS
+	srv.StartTLS()
+	defer srv.Close()
+
+	peerAddr := srv.Listener.Addr().String()
+	p.AddPeers(peerAddr)
+	v, err := p.fetchers[peerAddr].Fetch(context.Background(), "scores", "Tom")
+	if err != nil || string(v) != "630" {
+		t.Fatalf("fetch over mTLS got %q, %v", v, err)
+	}
+
+	// 不带客户端证书的请求会被拒绝
+	noCert, err := (&conf.TLSConfig{CAFile: certs.CA}).ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := &httpGetter[string, []byte]{
+		baseURL: "https://" + peerAddr + "/cache/",
+		client:  &http.Client{Transport: &http.Transport{TLSClientConfig: noCert}},
+	}
+	if _, err := plain.Fetch(context.Background(), "scores", "Tom"); err == nil {
+		t.Fatalf("fetch without client certificate should fail")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50, Auth: &conf.AuthConfig{
+		Secret:  "secret",
+		Subject: "node",
+		ACL:     map[string]conf.ACLRule{"scores": {Read: []string{"node"}}},
+	}}
+	createGroup(t, "scores")
+
+	p, err := NewHTTPPool[string, []byte](c, "127.0.0.1:8000", "127.0.0.1", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	peerAddr := srv.Listener.Addr().String()
+	p.AddPeers(peerAddr)
+	if v, err := p.fetchers[peerAddr].Fetch(context.Background(), "scores", "Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("authenticated fetch got %q, %v", v, err)
+	}
+
+	res, err := http.Get(srv.URL + "/cache/scores/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("request without token returned %v, want 401", res.Status)
+	}
+
+	token, _ := p.guard.Authenticator.(*auth.HMAC).Issue("stranger")
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/cache/scores/Tom", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("request from stranger returned %v, want 403", res.Status)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50}
+	g, err := gcache.NewGroup[string, []byte]("transfer", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewHTTPPool[string, []byte](c, "127.0.0.1:8000", "127.0.0.1", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	var changed int
+	p.OnRingChange(func() { changed++ })
+	peerAddr := srv.Listener.Addr().String()
+	p.AddPeers(peerAddr)
+	if changed != 1 {
+		t.Fatalf("ring change listener called %d times, want 1", changed)
+	}
+
+	addr, transferer, ok := p.Owner("Tom")
+	if !ok || addr != peerAddr {
+		t.Fatalf("owner of Tom = %v, %v; want %v", addr, ok, peerAddr)
+	}
+	err = transferer.Transfer(context.Background(), "transfer", []peer.Entry[string, []byte]{{Key: "Tom", Value: []byte("630")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("transferred key got %q, %v", v, err)
+	}
+}
+
+func TestSetDelete(t *testing.T) {
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50}
+	g, err := gcache.NewGroup[string, []byte]("mutate", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			return []byte("origin"), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewHTTPPool[string, []byte](c, "127.0.0.1:8000", "127.0.0.1", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	peerAddr := srv.Listener.Addr().String()
+	p.AddPeers(peerAddr)
+
+	m := p.fetchers[peerAddr].(peer.Mutator[string, []byte])
+	if err := m.Set(context.Background(), "mutate", "Tom", []byte("set")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("Tom"); string(v) != "set" {
+		t.Fatalf("after set got %q", v)
+	}
+	if err := m.Delete(context.Background(), "mutate", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("Tom"); string(v) != "origin" {
+		t.Fatalf("after delete got %q, want reloaded value", v)
+	}
+	res, err := http.Get(srv.URL + "/cache/unknown/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown group returned %d, want 404", res.StatusCode)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50}
+	_, err := gcache.NewGroup[string, []byte]("errors", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			switch key {
+			case "broken":
+				return nil, errors.New("db is down")
+			case "busy":
+				return nil, gcache.ErrOverloaded
+			}
+			return nil, fmt.Errorf("%w: %s", gcache.ErrNotFound, key)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("errors") })
+	p, err := NewHTTPPool[string, []byte](c, "127.0.0.1:8000", "127.0.0.1", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	peerAddr := srv.Listener.Addr().String()
+	p.AddPeers(peerAddr)
+	f := p.fetchers[peerAddr]
+
+	tests := []struct {
+		group, key string
+		want       error
+		notWant    error
+	}{
+		{"errors", "Tom", peer.ErrNotFound, peer.ErrGroupNotFound},
+		{"unknown", "Tom", peer.ErrGroupNotFound, peer.ErrNotFound},
+		{"errors", "broken", peer.ErrLoader, peer.ErrUnavailable},
+		{"errors", "busy", peer.ErrOverloaded, peer.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		if _, err := f.Fetch(context.Background(), tt.group, tt.key); !errors.Is(err, tt.want) || errors.Is(err, tt.notWant) {
+			t.Errorf("Fetch(%s, %s) err = %v, want %v", tt.group, tt.key, err, tt.want)
+		}
+	}
+
+	// 错误以 JSON 返回，状态码与错误种类对应
+	res, err := http.Get(srv.URL + "/cache/errors/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body peer.Error
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadGateway || body.Code != peer.CodeLoader || !strings.Contains(body.Message, "db is down") {
+		t.Fatalf("loader failure returned %d %+v", res.StatusCode, body)
+	}
+
+	srv.Close()
+	if _, err := f.Fetch(context.Background(), "errors", "Tom"); !errors.Is(err, peer.ErrUnavailable) {
+		t.Fatalf("closed peer: err = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestWriteContextError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   peer.Code
+	}{
+		{fmt.Errorf("wait for admission: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, peer.CodeTimeout},
+		{fmt.Errorf("wait for admission: %w", context.Canceled), statusClientClosedRequest, peer.CodeInternal},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		WriteError(rec, tt.err)
+		var body peer.Error
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != tt.status || body.Code != tt.code {
+			t.Errorf("WriteError(%v) = %d %s, want %d %s", tt.err, rec.Code, body.Code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50, Admission: &conf.AdmissionConfig{MaxInFlight: 1}}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	_, err := gcache.NewGroup[string, []byte]("admission", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			close(started)
+			<-release
+			return []byte("slow"), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("admission") })
+	p, err := NewHTTPPool[string, []byte](c, "127.0.0.1:8000", "127.0.0.1", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	peerAddr := srv.Listener.Addr().String()
+	p.AddPeers(peerAddr)
+	f := p.fetchers[peerAddr]
+
+	slow := make(chan error)
+	go func() {
+		_, err := f.Fetch(context.Background(), "admission", "Tom")
+		slow <- err
+	}()
+	<-started
+	// 唯一的名额被慢请求占用，其余请求被拒绝
+	if _, err := f.Fetch(context.Background(), "admission", "Jack"); !errors.Is(err, peer.ErrOverloaded) {
+		t.Fatalf("err = %v, want ErrOverloaded", err)
+	}
+	res, err := http.Get(srv.URL + healthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("health check returned %d while saturated", res.StatusCode)
+	}
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGroupAdmission(t *testing.T) {
+	c := &conf.Config{HttpBasePath: "/cache/", Replicas: 50, Admission: &conf.AdmissionConfig{MaxInFlight: 4, TargetLatency: 3600000}}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	g, err := gcache.NewGroup[string, []byte]("group-admission", 2<<10, gcache.GetterFunc[string, []byte](
+		func(key string) ([]byte, error) {
+			close(started)
+			<-release
+			return []byte("slow"), nil
+		}), gcache.WithAdmission(admission.New(admission.Options{MaxInFlight: 1})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("group-admission") })
+	p, err := NewHTTPPool[string, []byte](c, "127.0.0.1:8000", "127.0.0.1", "8000", "HTTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	peerAddr := srv.Listener.Addr().String()
+	p.AddPeers(peerAddr)
+	f := p.fetchers[peerAddr]
+
+	slow := make(chan error)
+	go func() {
+		_, err := f.Fetch(context.Background(), "group-admission", "Tom")
+		slow <- err
+	}()
+	<-started
+	// 读写都受分组的并发限制
+	if _, err := f.Fetch(context.Background(), "group-admission", "Jack"); !errors.Is(err, peer.ErrOverloaded) {
+		t.Fatalf("Fetch: err = %v, want ErrOverloaded", err)
+	}
+	if err := f.(peer.Mutator[string, []byte]).Set(context.Background(), "group-admission", "Jack", []byte("589")); !errors.Is(err, peer.ErrOverloaded) {
+		t.Fatalf("Set: err = %v, want ErrOverloaded", err)
+	}
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+	if n := g.Stats().Shed; n != 2 {
+		t.Fatalf("shed = %d, want 2", n)
+	}
+	// 分组拒绝的请求不让节点的上限收缩
+	if l := p.admission.Stats().Limit; l != 4 {
+		t.Fatalf("node limit = %d, want 4", l)
+	}
+}
@@ -0,0 +1,92 @@
+// Package hub fans events out to any number of watchers.
+package hub
+
+import (
+	"context"
+	"sync"
+)
+
+// Hub fans events out to any number of watchers. Publish never
+// blocks: every watcher has its own unbounded queue, so a slow watcher
+// cannot stall the publisher. The zero value is ready to use.
+type Hub[E any] struct {
+	mu       sync.Mutex
+	watchers map[*hubWatcher[E]]struct{}
+}
+
+// Publish queues event for every current watcher.
+func (h *Hub[E]) Publish(event E) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		w.push(event)
+	}
+}
+
+// Watch returns a channel delivering the events published from now on,
+// closed once ctx is done.
+func (h *Hub[E]) Watch(ctx context.Context) <-chan E {
+	w := &hubWatcher[E]{wake: make(chan struct{}, 1)}
+	h.mu.Lock()
+	if h.watchers == nil {
+		h.watchers = make(map[*hubWatcher[E]]struct{})
+	}
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+
+	events := make(chan E)
+	go func() {
+		defer close(events)
+		defer func() {
+			h.mu.Lock()
+			delete(h.watchers, w)
+			h.mu.Unlock()
+		}()
+		for {
+			event, ok := w.pop()
+			if !ok {
+				select {
+				case <-w.wake:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// hubWatcher 无界队列，注册方不会被慢的监听方阻塞
+type hubWatcher[E any] struct {
+	mu    sync.Mutex
+	queue []E
+	wake  chan struct{}
+}
+
+func (w *hubWatcher[E]) push(event E) {
+	w.mu.Lock()
+	w.queue = append(w.queue, event)
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *hubWatcher[E]) pop() (E, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.queue) == 0 {
+		var zero E
+		return zero, false
+	}
+	event := w.queue[0]
+	w.queue = w.queue[1:]
+	return event, true
+}
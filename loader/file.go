@@ -0,0 +1,30 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"kunCache/gcache"
+	"os"
+)
+
+// Dir returns a Getter reading the file named by the key, a slash
+// separated path, from dir. Keys leaving dir, like "../etc/passwd", are
+// not found.
+func Dir(dir string) gcache.Getter[string, []byte] {
+	return FS(os.DirFS(dir))
+}
+
+// FS is like Dir for any file system, e.g. an embed.FS.
+func FS(fsys fs.FS) gcache.Getter[string, []byte] {
+	return gcache.GetterFunc[string, []byte](func(key string) ([]byte, error) {
+		if !fs.ValidPath(key) {
+			return nil, fmt.Errorf("%w: invalid path %q", gcache.ErrNotFound, key)
+		}
+		data, err := fs.ReadFile(fsys, key)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", gcache.ErrNotFound, key)
+		}
+		return data, err
+	})
+}
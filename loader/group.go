@@ -0,0 +1,36 @@
+package loader
+
+import (
+	"kunCache/gcache"
+	"time"
+)
+
+// Group returns a Getter looking the key up in the kunCache group name, so
+// a group can sit behind another one, e.g. a small hot tier in front of a
+// larger one. The group is resolved on every call, so it may be created
+// after the Getter; until then every load fails with
+// gcache.ErrGroupNotFound. Values keep the time they have left in that
+// group as their ttl, so the front group never serves them longer.
+func Group[K comparable, V any](name string) gcache.TTLGetter[K, V] {
+	return &group[K, V]{name: name}
+}
+
+// group 在每次加载时按名字查找分组
+type group[K comparable, V any] struct {
+	name string
+}
+
+func (g *group[K, V]) Get(key K) (V, error) {
+	v, _, err := g.GetWithTTL(key)
+	return v, err
+}
+
+// GetWithTTL 返回值及其在被查询分组中剩余的有效期
+func (g *group[K, V]) GetWithTTL(key K) (V, time.Duration, error) {
+	gr, err := gcache.GetGroup[K, V](g.name)
+	if err != nil {
+		var v V
+		return v, 0, err
+	}
+	return gr.GetWithTTL(key)
+}
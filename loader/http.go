@@ -0,0 +1,128 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"kunCache/gcache"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyMarker is replaced in the URL of an HTTPOrigin by the escaped key.
+const KeyMarker = "{key}"
+
+// HTTPOrigin is a Getter fetching keys from an upstream HTTP server. The
+// Cache-Control header of a response sets how long the value is cached:
+// s-maxage or max-age, minus the Age header, while no-store, no-cache and
+// private keep it out of the cache. Responses without those directives
+// are cached for the expiration of the group.
+type HTTPOrigin struct {
+	// URL is the address of a key: KeyMarker is replaced by the escaped
+	// key, which is appended if there is no marker.
+	URL string
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// Header is added to every request, e.g. for authorization.
+	Header http.Header
+	// Timeout bounds every request, 0 leaves it to Client.
+	Timeout time.Duration
+}
+
+// HTTP returns an HTTPOrigin fetching keys from url with the default
+// client.
+func HTTP(url string) *HTTPOrigin {
+	return &HTTPOrigin{URL: url}
+}
+
+func (o *HTTPOrigin) Get(key string) ([]byte, error) {
+	v, _, err := o.GetWithTTL(key)
+	return v, err
+}
+
+// GetWithTTL fetches key. 404 and 410 responses fail with an error
+// wrapping gcache.ErrNotFound, other non-2xx responses with their status.
+func (o *HTTPOrigin) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	ctx := context.Background()
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.keyURL(key), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for name, values := range o.Header {
+		req.Header[name] = values
+	}
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return nil, 0, fmt.Errorf("%w: %s", gcache.ErrNotFound, key)
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		return nil, 0, fmt.Errorf("origin returned %s for %s", res.Status, key)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read %s: %w", key, err)
+	}
+	return data, cacheTTL(res.Header), nil
+}
+
+// keyURL 把 key 转义后填入 URL
+func (o *HTTPOrigin) keyURL(key string) string {
+	escaped := url.PathEscape(key)
+	if strings.Contains(o.URL, KeyMarker) {
+		return strings.Replace(o.URL, KeyMarker, escaped, 1)
+	}
+	return o.URL + escaped
+}
+
+// cacheTTL 根据 Cache-Control 和 Age 计算有效期：-1 不缓存，0 使用分组的过期时间
+func cacheTTL(h http.Header) time.Duration {
+	maxAge, sharedMaxAge := -1, -1
+	for _, directive := range strings.Split(strings.Join(h.Values("Cache-Control"), ","), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return -1
+		case "max-age":
+			maxAge = parseSeconds(value)
+		case "s-maxage":
+			sharedMaxAge = parseSeconds(value)
+		}
+	}
+	// 作为共享缓存，s-maxage 优先
+	if sharedMaxAge >= 0 {
+		maxAge = sharedMaxAge
+	}
+	if maxAge < 0 {
+		return 0
+	}
+	age := max(parseSeconds(h.Get("Age")), 0)
+	if maxAge <= age {
+		return -1
+	}
+	return time.Duration(maxAge-age) * time.Second
+}
+
+// parseSeconds 解析秒数，格式错误时返回 -1
+func parseSeconds(s string) int {
+	n, err := strconv.Atoi(strings.Trim(s, `"`))
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
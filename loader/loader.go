@@ -0,0 +1,75 @@
+// Package loader provides ready-made Getters for gcache groups: files of a
+// directory, an upstream HTTP origin and other cache groups, plus Chain and
+// Fallback to combine them into tiers.
+//
+//	origin := loader.HTTP("https://origin.example.com/objects/")
+//	g, err := gcache.NewGroup[string, []byte]("objects", 2<<10,
+//		loader.Chain[string, []byte](loader.Group[string, []byte]("objects-l2"), origin))
+//
+// The database loader lives in the subpackage loader/sql.
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"kunCache/gcache"
+	"time"
+)
+
+// Chain returns a Getter that asks getters in order and returns the first
+// value found: a getter failing with gcache.ErrNotFound passes the key on
+// to the next one, while other errors are returned at once. It suits cache
+// tiers in front of the source of truth.
+func Chain[K comparable, V any](getters ...gcache.Getter[K, V]) gcache.TTLGetter[K, V] {
+	return &chain[K, V]{getters: getters, next: func(err error) bool {
+		return errors.Is(err, gcache.ErrNotFound)
+	}}
+}
+
+// Fallback is like Chain but passes the key on after any error, so a
+// replica or a backup source answers while the first getter is down. The
+// key is reported missing only if every getter said so.
+func Fallback[K comparable, V any](getters ...gcache.Getter[K, V]) gcache.TTLGetter[K, V] {
+	return &chain[K, V]{getters: getters, next: func(error) bool { return true }}
+}
+
+// chain 依次询问 getters，next 判断出错后是否继续询问下一个
+type chain[K comparable, V any] struct {
+	getters []gcache.Getter[K, V]
+	next    func(err error) bool
+}
+
+func (c *chain[K, V]) Get(key K) (V, error) {
+	v, _, err := c.GetWithTTL(key)
+	return v, err
+}
+
+// GetWithTTL 返回第一个找到的值及其有效期，全部失败时优先返回不是 ErrNotFound 的错误
+func (c *chain[K, V]) GetWithTTL(key K) (value V, ttl time.Duration, err error) {
+	var errs []error
+	for _, g := range c.getters {
+		value, ttl, err = getWithTTL(g, key)
+		if err == nil {
+			return value, ttl, nil
+		}
+		if !c.next(err) {
+			return value, 0, err
+		}
+		if !errors.Is(err, gcache.ErrNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return value, 0, errors.Join(errs...)
+	}
+	return value, 0, fmt.Errorf("%w: %v", gcache.ErrNotFound, key)
+}
+
+// getWithTTL 调用 g，g 不是 TTLGetter 时有效期为 0
+func getWithTTL[K comparable, V any](g gcache.Getter[K, V], key K) (V, time.Duration, error) {
+	if tg, ok := g.(gcache.TTLGetter[K, V]); ok {
+		return tg.GetWithTTL(key)
+	}
+	v, err := g.Get(key)
+	return v, 0, err
+}
@@ -0,0 +1,205 @@
+package loader
+
+import (
+	"errors"
+	"kunCache/gcache"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "users"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "users", "Tom"), []byte("630"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	g := Dir(dir)
+	if v, err := g.Get("users/Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("Get(users/Tom) = %q, %v", v, err)
+	}
+	for _, key := range []string{"users/Jack", "../secret", "/etc/passwd"} {
+		if _, err := g.Get(key); !errors.Is(err, gcache.ErrNotFound) {
+			t.Errorf("Get(%s) err = %v, want ErrNotFound", key, err)
+		}
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/objects/fresh":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		case "/objects/uncached":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/objects/a b":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("data of " + r.URL.Path))
+	}))
+	defer srv.Close()
+	origin := &HTTPOrigin{URL: srv.URL + "/objects/{key}", Header: http.Header{"X-Token": {"secret"}}}
+
+	if v, err := origin.Get("a b"); err != nil || string(v) != "data of /objects/a b" {
+		t.Fatalf("Get(a b) = %q, %v", v, err)
+	}
+	if _, err := origin.Get("missing"); !errors.Is(err, gcache.ErrNotFound) {
+		t.Fatalf("Get(missing) err = %v, want ErrNotFound", err)
+	}
+	if _, err := HTTP(srv.URL + "/objects/").Get("fresh"); err == nil || errors.Is(err, gcache.ErrNotFound) {
+		t.Fatalf("unauthorized err = %v, want a status error", err)
+	}
+
+	// 分组按 Cache-Control 缓存
+	g, err := gcache.NewGroup[string, []byte]("origin", 2<<10, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("origin") })
+	for _, tt := range []struct {
+		key  string
+		hits int32
+	}{
+		{"fresh", 1},
+		{"uncached", 2},
+	} {
+		before := hits.Load()
+		g.Get(tt.key)
+		g.Get(tt.key)
+		if n := hits.Load() - before; n != tt.hits {
+			t.Errorf("%s: origin hit %d times, want %d", tt.key, n, tt.hits)
+		}
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{}, 0},
+		{http.Header{"Cache-Control": {"max-age=60"}}, time.Minute},
+		{http.Header{"Cache-Control": {"max-age=60, s-maxage=10"}}, 10 * time.Second},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"50"}}, 10 * time.Second},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"90"}}, -1},
+		{http.Header{"Cache-Control": {"max-age=0"}}, -1},
+		{http.Header{"Cache-Control": {"public", "no-cache"}}, -1},
+		{http.Header{"Cache-Control": {"private, max-age=60"}}, -1},
+		{http.Header{"Cache-Control": {"max-age=soon"}}, 0},
+	}
+	for _, tt := range tests {
+		if got := cacheTTL(tt.header); got != tt.want {
+			t.Errorf("cacheTTL(%v) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	errDown := errors.New("down")
+	notFound := gcache.GetterFunc[string, string](func(key string) (string, error) {
+		return "", gcache.ErrNotFound
+	})
+	down := gcache.GetterFunc[string, string](func(key string) (string, error) {
+		return "", errDown
+	})
+	source := gcache.GetterFunc[string, string](func(key string) (string, error) {
+		return "source " + key, nil
+	})
+
+	if v, err := Chain(notFound, source).Get("Tom"); err != nil || v != "source Tom" {
+		t.Fatalf("Chain = %q, %v", v, err)
+	}
+	if _, err := Chain(down, source).Get("Tom"); !errors.Is(err, errDown) {
+		t.Fatalf("Chain err = %v, want down", err)
+	}
+	if _, err := Chain(notFound, notFound).Get("Tom"); !errors.Is(err, gcache.ErrNotFound) {
+		t.Fatalf("Chain err = %v, want ErrNotFound", err)
+	}
+	if v, err := Fallback(down, notFound, source).Get("Tom"); err != nil || v != "source Tom" {
+		t.Fatalf("Fallback = %q, %v", v, err)
+	}
+	// 有一个数据源出错时不能断定 key 不存在
+	if _, err := Fallback(down, notFound).Get("Tom"); !errors.Is(err, errDown) || errors.Is(err, gcache.ErrNotFound) {
+		t.Fatalf("Fallback err = %v, want down", err)
+	}
+}
+
+func TestGroupTier(t *testing.T) {
+	var loads atomic.Int32
+	_, err := gcache.NewGroup[string, string]("tier-l2", 2<<10, gcache.GetterFunc[string, string](
+		func(key string) (string, error) {
+			loads.Add(1)
+			if key == "Tom" {
+				return "630", nil
+			}
+			return "", gcache.ErrNotFound
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("tier-l2") })
+	backup := gcache.GetterFunc[string, string](func(key string) (string, error) {
+		return "backup " + key, nil
+	})
+	l1, err := gcache.NewGroup[string, string]("tier-l1", 2<<10, Chain(Group[string, string]("tier-l2"), backup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("tier-l1") })
+
+	if v, err := l1.Get("Tom"); err != nil || v != "630" {
+		t.Fatalf("Get(Tom) = %q, %v", v, err)
+	}
+	if v, err := l1.Get("Jack"); err != nil || v != "backup Jack" {
+		t.Fatalf("Get(Jack) = %q, %v", v, err)
+	}
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("tier-l2 loaded %d times, want 2", n)
+	}
+	if _, err := Group[string, string]("tier-none").Get("Tom"); !errors.Is(err, gcache.ErrGroupNotFound) {
+		t.Fatalf("err = %v, want ErrGroupNotFound", err)
+	}
+}
+
+func TestGroupTierTTL(t *testing.T) {
+	var loads atomic.Int32
+	_, err := gcache.NewGroup[string, string]("ttl-l2", 2<<10, gcache.GetterFunc[string, string](
+		func(key string) (string, error) {
+			loads.Add(1)
+			return "630", nil
+		}), gcache.WithExpiration(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("ttl-l2") })
+	l1, err := gcache.NewGroup[string, string]("ttl-l1", 2<<10, Group[string, string]("ttl-l2"), gcache.WithExpiration(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("ttl-l1") })
+
+	if _, ttl, err := Group[string, string]("ttl-l2").GetWithTTL("Tom"); err != nil || ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Fatalf("GetWithTTL = %v, %v; want the time left in ttl-l2", ttl, err)
+	}
+	// 前一层的过期时间不超过后一层剩余的有效期
+	l1.Get("Tom")
+	time.Sleep(60 * time.Millisecond)
+	l1.Get("Tom")
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("ttl-l2 loaded %d times, want 2", n)
+	}
+}
@@ -0,0 +1,69 @@
+package sqlloader
+
+import (
+	"fmt"
+	"kunCache/backend"
+	"kunCache/gcache"
+	"strconv"
+	"time"
+)
+
+// Backend returns a backend.Factory creating Loaders of string keys and
+// []byte values, for groups configured with the options:
+//
+//	driver       database/sql driver name, "mysql" by default
+//	dsn          data source name, dsn by default (conf.Config.DNS)
+//	query        see Options.Query
+//	batch_query  see Options.BatchQuery
+//	batch_size   see Options.BatchSize
+//	placeholder  "?" (default) or "$" for $1, $2...
+//	timeout      query timeout in milliseconds
+//
+// The driver must be registered by importing its package.
+func Backend(dsn string) backend.Factory {
+	return func(options map[string]string) (gcache.Getter[string, []byte], error) {
+		driver := options["driver"]
+		if driver == "" {
+			driver = "mysql"
+		}
+		// 不能修改 dsn，它由同一个工厂创建的所有分组共享
+		d := dsn
+		if options["dsn"] != "" {
+			d = options["dsn"]
+		}
+		opts := Options[string, []byte]{
+			Query:      options["query"],
+			BatchQuery: options["batch_query"],
+		}
+		switch options["placeholder"] {
+		case "", "?":
+		case "$":
+			opts.Placeholder = Dollar
+		default:
+			return nil, fmt.Errorf("sqlloader: placeholder %q must be ? or $", options["placeholder"])
+		}
+		var err error
+		if opts.BatchSize, err = intOption(options, "batch_size"); err != nil {
+			return nil, err
+		}
+		timeout, err := intOption(options, "timeout")
+		if err != nil {
+			return nil, err
+		}
+		opts.Timeout = time.Duration(timeout) * time.Millisecond
+		return Open(driver, d, opts)
+	}
+}
+
+// intOption 解析整数选项，未设置时为 0
+func intOption(options map[string]string, name string) (int, error) {
+	v := options[name]
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("sqlloader: %s: %w", name, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,201 @@
+// Package sqlloader loads cache groups from a database through
+// database/sql, so any registered driver works: a query selects the value
+// of one key, and an optional batch query selects many keys at once with
+// an IN (...) list.
+//
+//	l, err := sqlloader.Open[string, []byte]("mysql", c.DNS, sqlloader.Options[string, []byte]{
+//		Query:      "SELECT v FROM kv WHERE k = ?",
+//		BatchQuery: "SELECT k, v FROM kv WHERE k IN ({keys})",
+//	})
+//	g, err := gcache.NewGroup[string, []byte]("kv", 2<<10, l)
+package sqlloader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"kunCache/gcache"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeysMarker is replaced in Options.BatchQuery by one placeholder per key.
+const KeysMarker = "{keys}"
+
+// Scanner is implemented by *sql.Row and *sql.Rows.
+type Scanner interface {
+	Scan(dest ...any) error
+}
+
+// Options configures a Loader.
+type Options[K comparable, V any] struct {
+	// Query selects the value of the key bound to its only parameter, e.g.
+	// "SELECT v FROM kv WHERE k = ?". When empty, single keys are loaded
+	// with BatchQuery.
+	Query string
+	// BatchQuery selects the key and the value of the keys replacing
+	// KeysMarker, e.g. "SELECT k, v FROM kv WHERE k IN ({keys})".
+	BatchQuery string
+	// BatchSize is the most keys bound to one BatchQuery, 100 by default;
+	// GetMany splits longer lists.
+	BatchSize int
+	// Placeholder returns the placeholder of the i-th parameter, counted
+	// from 1. It defaults to "?" (MySQL, SQLite); use Dollar for PostgreSQL.
+	Placeholder func(i int) string
+	// Scan maps a row of Query to V. By default the only column is scanned
+	// into V, which suits []byte, string and numbers.
+	Scan func(row Scanner) (V, error)
+	// ScanBatch maps a row of BatchQuery to its key and value. By default
+	// the two columns are scanned into K and V.
+	ScanBatch func(row Scanner) (K, V, error)
+	// Timeout bounds every query, 0 leaves it unbounded.
+	Timeout time.Duration
+}
+
+// Dollar numbers placeholders like PostgreSQL: $1, $2...
+func Dollar(i int) string {
+	return "$" + strconv.Itoa(i)
+}
+
+// Loader is a gcache.Getter that runs queries against a database.
+type Loader[K comparable, V any] struct {
+	db   *sql.DB
+	opts Options[K, V]
+	// closeDB 为 true 时 Close 关闭 db，即 db 由 Open 创建
+	closeDB bool
+}
+
+// New creates a Loader querying db. It fails if opts has neither query.
+func New[K comparable, V any](db *sql.DB, opts Options[K, V]) (*Loader[K, V], error) {
+	if opts.Query == "" && opts.BatchQuery == "" {
+		return nil, errors.New("sqlloader: Query or BatchQuery is required")
+	}
+	if opts.BatchQuery != "" && !strings.Contains(opts.BatchQuery, KeysMarker) {
+		return nil, fmt.Errorf("sqlloader: BatchQuery must contain %s", KeysMarker)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Placeholder == nil {
+		opts.Placeholder = func(int) string { return "?" }
+	}
+	if opts.Scan == nil {
+		opts.Scan = func(row Scanner) (v V, err error) {
+			err = row.Scan(&v)
+			return v, err
+		}
+	}
+	if opts.ScanBatch == nil {
+		opts.ScanBatch = func(row Scanner) (k K, v V, err error) {
+			err = row.Scan(&k, &v)
+			return k, v, err
+		}
+	}
+	return &Loader[K, V]{db: db, opts: opts}, nil
+}
+
+// Open opens the database with driver and dsn, e.g. the MySQL DSN of
+// conf.Config.DNS, and creates a Loader querying it. Close closes the
+// database.
+func Open[K comparable, V any](driver, dsn string, opts Options[K, V]) (*Loader[K, V], error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sqlloader: open %s: %w", driver, err)
+	}
+	l, err := New(db, opts)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	l.closeDB = true
+	return l, nil
+}
+
+// Get loads the value of key. A key without row fails with an error
+// wrapping gcache.ErrNotFound.
+func (l *Loader[K, V]) Get(key K) (V, error) {
+	ctx, cancel := l.context(context.Background())
+	defer cancel()
+	if l.opts.Query == "" {
+		values, err := l.batch(ctx, []K{key})
+		if err != nil {
+			return *new(V), err
+		}
+		v, ok := values[key]
+		if !ok {
+			return v, fmt.Errorf("%w: %v", gcache.ErrNotFound, key)
+		}
+		return v, nil
+	}
+	v, err := l.opts.Scan(l.db.QueryRowContext(ctx, l.opts.Query, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, fmt.Errorf("%w: %v", gcache.ErrNotFound, key)
+	}
+	return v, err
+}
+
+// GetMany loads the values of keys with BatchQuery, BatchSize keys per
+// query. Keys without row are missing from the result.
+func (l *Loader[K, V]) GetMany(ctx context.Context, keys []K) (map[K]V, error) {
+	if l.opts.BatchQuery == "" {
+		return nil, errors.New("sqlloader: BatchQuery is not configured")
+	}
+	values := make(map[K]V, len(keys))
+	for len(keys) > 0 {
+		n := min(len(keys), l.opts.BatchSize)
+		qctx, cancel := l.context(ctx)
+		part, err := l.batch(qctx, keys[:n])
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range part {
+			values[k] = v
+		}
+		keys = keys[n:]
+	}
+	return values, nil
+}
+
+// batch 用一次 BatchQuery 查询 keys
+func (l *Loader[K, V]) batch(ctx context.Context, keys []K) (map[K]V, error) {
+	placeholders := make([]string, len(keys))
+	args := make([]any, len(keys))
+	for i, k := range keys {
+		placeholders[i] = l.opts.Placeholder(i + 1)
+		args[i] = k
+	}
+	query := strings.Replace(l.opts.BatchQuery, KeysMarker, strings.Join(placeholders, ", "), 1)
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := make(map[K]V, len(keys))
+	for rows.Next() {
+		k, v, err := l.opts.ScanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		values[k] = v
+	}
+	return values, rows.Err()
+}
+
+// context 为查询加上超时
+func (l *Loader[K, V]) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.opts.Timeout > 0 {
+		return context.WithTimeout(ctx, l.opts.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Close closes the database if the Loader opened it.
+func (l *Loader[K, V]) Close() error {
+	if !l.closeDB {
+		return nil
+	}
+	return l.db.Close()
+}
@@ -0,0 +1,234 @@
+package sqlloader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"kunCache/backend"
+	"kunCache/conf"
+	"kunCache/gcache"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDriver 内存中的 kv 表，只认识 "... WHERE k = ?" 和 "... WHERE k IN (...)" 两种查询
+type fakeDriver struct {
+	mu      sync.Mutex
+	data    map[string]string
+	queries []string
+	dsns    []string // 打开过的连接使用的 DSN
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dsns = append(d.dsns, name)
+	return &fakeConn{d}, nil
+}
+
+func (d *fakeDriver) log() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.queries...)
+}
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.d, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.queries = append(s.d.queries, s.query)
+	if strings.Contains(s.query, "broken") {
+		return nil, errors.New("table broken")
+	}
+	rows := &fakeRows{}
+	batch := strings.Contains(s.query, " IN (")
+	if batch {
+		rows.columns = []string{"k", "v"}
+	} else {
+		rows.columns = []string{"v"}
+	}
+	for _, arg := range args {
+		k := fmt.Sprint(arg)
+		v, ok := s.d.data[k]
+		if !ok {
+			continue
+		}
+		if batch {
+			rows.values = append(rows.values, []driver.Value{k, []byte(v)})
+		} else {
+			rows.values = append(rows.values, []driver.Value{[]byte(v)})
+		}
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var fake = &fakeDriver{data: map[string]string{"Tom": "630", "Jack": "589", "Sam": "567"}}
+
+func init() {
+	sql.Register("fakekv", fake)
+}
+
+func TestGet(t *testing.T) {
+	l, err := Open("fakekv", "", Options[string, []byte]{Query: "SELECT v FROM kv WHERE k = ?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if v, err := l.Get("Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("Get(Tom) = %q, %v", v, err)
+	}
+	if _, err := l.Get("Nobody"); !errors.Is(err, gcache.ErrNotFound) {
+		t.Fatalf("Get(Nobody) err = %v, want ErrNotFound", err)
+	}
+
+	// 作为分组的 Getter 使用
+	g, err := gcache.NewGroup[string, []byte]("sql", 2<<10, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gcache.DeleteGroup("sql") })
+	if v, err := g.Get("Jack"); err != nil || string(v) != "589" {
+		t.Fatalf("group Get(Jack) = %q, %v", v, err)
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	l, err := Open("fakekv", "", Options[string, string]{
+		BatchQuery:  "SELECT k, v FROM kv WHERE k IN ({keys})",
+		BatchSize:   2,
+		Placeholder: Dollar,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	before := len(fake.log())
+	values, err := l.GetMany(context.Background(), []string{"Tom", "Jack", "Nobody", "Sam", "IKUN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"Tom": "630", "Jack": "589", "Sam": "567"}
+	if fmt.Sprint(values) != fmt.Sprint(want) {
+		t.Fatalf("GetMany = %v, want %v", values, want)
+	}
+	// 5 个 key 每批 2 个，分 3 次查询
+	queries := fake.log()[before:]
+	wantQueries := []string{
+		"SELECT k, v FROM kv WHERE k IN ($1, $2)",
+		"SELECT k, v FROM kv WHERE k IN ($1, $2)",
+		"SELECT k, v FROM kv WHERE k IN ($1)",
+	}
+	if strings.Join(queries, "\n") != strings.Join(wantQueries, "\n") {
+		t.Fatalf("queries = %q, want %q", queries, wantQueries)
+	}
+
+	// 没有 Query 时单个 key 也用批量查询
+	if v, err := l.Get("Sam"); err != nil || v != "567" {
+		t.Fatalf("Get(Sam) = %q, %v", v, err)
+	}
+	if _, err := l.Get("Nobody"); !errors.Is(err, gcache.ErrNotFound) {
+		t.Fatalf("Get(Nobody) err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := Open("fakekv", "", Options[string, []byte]{}); err == nil {
+		t.Fatal("Open without queries should fail")
+	}
+	if _, err := Open("fakekv", "", Options[string, []byte]{BatchQuery: "SELECT k, v FROM kv WHERE k IN (?)"}); err == nil {
+		t.Fatal("BatchQuery without {keys} should fail")
+	}
+	l, err := Open("fakekv", "", Options[string, []byte]{Query: "SELECT v FROM broken WHERE k = ?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.Get("Tom"); err == nil || errors.Is(err, gcache.ErrNotFound) {
+		t.Fatalf("err = %v, want the query error", err)
+	}
+	if _, err := l.GetMany(context.Background(), []string{"Tom"}); err == nil {
+		t.Fatal("GetMany without BatchQuery should fail")
+	}
+}
+
+func TestBackend(t *testing.T) {
+	backend.Register("sql", Backend("default-dsn"))
+	g, err := backend.New(conf.BackendConfig{Type: "sql", Options: map[string]string{
+		"driver":      "fakekv",
+		"query":       "SELECT v FROM kv WHERE k = ?",
+		"batch_query": "SELECT k, v FROM kv WHERE k IN ({keys})",
+		"timeout":     "1000",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("Get(Tom) = %q, %v", v, err)
+	}
+	if _, err := backend.New(conf.BackendConfig{Type: "sql", Options: map[string]string{"driver": "fakekv", "query": "q", "batch_size": "x"}}); err == nil {
+		t.Fatal("bad batch_size should fail")
+	}
+	if _, err := backend.New(conf.BackendConfig{Type: "sql", Options: map[string]string{"driver": "nope", "query": "q"}}); err == nil {
+		t.Fatal("unknown driver should fail")
+	}
+
+	// 一个分组设置的 dsn 不影响之后创建的分组
+	for _, dsn := range []string{"group-dsn", ""} {
+		g, err := backend.New(conf.BackendConfig{Type: "sql", Options: map[string]string{
+			"driver": "fakekv",
+			"dsn":    dsn,
+			"query":  "SELECT v FROM kv WHERE k = ?",
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.Get("Tom")
+		fake.mu.Lock()
+		got := fake.dsns[len(fake.dsns)-1]
+		fake.mu.Unlock()
+		want := dsn
+		if want == "" {
+			want = "default-dsn"
+		}
+		if got != want {
+			t.Fatalf("dsn option %q: connected to %q, want %q", dsn, got, want)
+		}
+		g.(io.Closer).Close()
+	}
+}
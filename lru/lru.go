@@ -3,6 +3,7 @@ package lru
 
 import (
 	"kunCache/list"
+	"time"
 )
 
 // Cache is an LRU cache. It is not safe for concurrent access.
@@ -51,14 +52,24 @@ func (c *Cache[K, V]) Add(key K, value V, expires int64) {
 
 // Get looks up a key's value from the cache.
 func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	value, _, ok = c.GetStale(key, 0)
+	return
+}
+
+// GetStale is like Get, but keeps returning an expired entry until grace
+// after it expired, and also returns its expiry in UnixNano, 0 meaning no
+// expiry. Callers compare expires with the current time to tell a stale
+// value from a fresh one.
+func (c *Cache[K, V]) GetStale(key K, grace time.Duration) (value V, expires int64, ok bool) {
 	if node, hit := c.cache[key]; hit {
-		// If the value has expired, remove it from the cache
-		if node.Expires().UnixNano() != 0 && node.Expired() {
+		expires = node.Expires().UnixNano()
+		// If the value has expired beyond grace, remove it from the cache
+		if expires != 0 && expires+int64(grace) < time.Now().UnixNano() {
 			c.removeElement(node)
-			return
+			return value, 0, false
 		}
 		c.ll.MoveToFront(node)
-		return node.Value(), true
+		return node.Value(), expires, true
 	}
 	return
 }
@@ -86,6 +97,30 @@ func (c *Cache[K, V]) removeElement(node *list.Node[K, V]) {
 	}
 }
 
+// Range calls f for each unexpired entry from most to least recently used,
+// stopping early if f returns false. expires is in UnixNano, 0 meaning no
+// expiry. f must not modify the cache.
+func (c *Cache[K, V]) Range(f func(key K, value V, expires int64) bool) {
+	for node := c.ll.Head.Next; node != c.ll.Tail; node = node.Next {
+		expires := node.Expires().UnixNano()
+		if expires != 0 && node.Expired() {
+			continue
+		}
+		if !f(node.Key(), node.Value(), expires) {
+			return
+		}
+	}
+}
+
+// Resize changes the maximum number of entries, evicting the oldest
+// entries if the cache holds more than the new limit. Zero means no limit.
+func (c *Cache[K, V]) Resize(maxEntries int64) {
+	c.maxEntries = maxEntries
+	for c.maxEntries != 0 && c.Len() > c.maxEntries {
+		c.RemoveOldest()
+	}
+}
+
 // Len returns the number of items in the cache.
 func (c *Cache[K, V]) Len() int64 {
 	return c.ll.Len()
@@ -98,6 +133,6 @@ func (c *Cache[K, V]) Clear() {
 			c.onEvicted(node.Key(), node.Value())
 		}
 	}
-	c.ll = nil
-	c.cache = nil
+	c.ll = list.NewList[K, V]()
+	c.cache = make(map[K]*list.Node[K, V])
 }
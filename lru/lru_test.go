@@ -86,3 +86,72 @@ func TestOnRemove(t *testing.T) {
 		t.Fatalf("Call onEvicted failed, expect keys equals to %s", expect)
 	}
 }
+
+func TestRange(t *testing.T) {
+	lru := New[string, string](0, nil)
+	ttl := time.Now().Add(time.Minute).UnixNano()
+	lru.Add("key1", "1", ttl)
+	lru.Add("key2", "2", 0)
+	lru.Add("expired", "3", time.Now().Add(-time.Minute).UnixNano())
+
+	var keys []string
+	lru.Range(func(key string, value string, expires int64) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if !reflect.DeepEqual(keys, []string{"key2", "key1"}) {
+		t.Fatalf("range keys = %v", keys)
+	}
+}
+
+func TestClear(t *testing.T) {
+	lru := New[string, string](0, nil)
+	lru.Add("key1", "1", 0)
+	lru.Clear()
+	if lru.Len() != 0 {
+		t.Fatalf("len after clear = %d", lru.Len())
+	}
+	// 清空后仍可继续使用
+	lru.Add("key2", "2", 0)
+	if v, ok := lru.Get("key2"); !ok || v != "2" {
+		t.Fatalf("cache unusable after clear")
+	}
+}
+
+func TestResize(t *testing.T) {
+	lru := New[string, string](0, nil)
+	for _, k := range []string{"key1", "key2", "key3"} {
+		lru.Add(k, k, 0)
+	}
+	lru.Get("key1")
+	lru.Resize(2)
+	if lru.Len() != 2 {
+		t.Fatalf("len after shrink = %d", lru.Len())
+	}
+	// 缩容淘汰最久未使用的 key2
+	if _, ok := lru.Get("key2"); ok {
+		t.Fatalf("key2 should be evicted")
+	}
+	lru.Resize(3)
+	lru.Add("key4", "4", 0)
+	if lru.Len() != 3 {
+		t.Fatalf("len after grow = %d", lru.Len())
+	}
+}
+
+func TestGetStale(t *testing.T) {
+	lru := New[string, string](10, nil)
+	expires := time.Now().Add(-10 * time.Millisecond).UnixNano()
+	lru.Add("key1", "1234", expires)
+
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatalf("Get returned an expired entry")
+	}
+	lru.Add("key1", "1234", expires)
+	if v, e, ok := lru.GetStale("key1", time.Second); !ok || v != "1234" || e != expires {
+		t.Fatalf("GetStale within grace = %q, %d, %v", v, e, ok)
+	}
+	if _, _, ok := lru.GetStale("key1", 5*time.Millisecond); ok || lru.Len() != 0 {
+		t.Fatalf("entry beyond grace was not removed")
+	}
+}
@@ -0,0 +1,111 @@
+package peer
+
+import (
+	"context"
+	"errors"
+)
+
+// 节点之间传递的错误。Fetcher 返回的错误可以用 errors.Is 判断是哪一种，
+// 无论远端节点使用 HTTP 还是 gRPC
+var (
+	// ErrNotFound 表示数据源中没有该 key。远端节点返回它时说明 key 确实不存在，
+	// 不需要再从本地加载，也不算节点故障
+	ErrNotFound = errors.New("kuncache: not found")
+	// ErrGroupNotFound 表示节点上没有该分组
+	ErrGroupNotFound = errors.New("kuncache: group not found")
+	// ErrUnavailable 表示无法连接远端节点
+	ErrUnavailable = errors.New("kuncache: peer unavailable")
+	// ErrTimeout 表示请求在截止时间前没有完成
+	ErrTimeout = errors.New("kuncache: timeout")
+	// ErrLoader 表示 Getter 从数据源加载失败
+	ErrLoader = errors.New("kuncache: loader failed")
+	// ErrDecode 表示无法解码请求或响应中的值
+	ErrDecode = errors.New("kuncache: decode error")
+	// ErrOverloaded 表示节点为保护数据源拒绝了加载，稍后重试
+	ErrOverloaded = errors.New("kuncache: overloaded")
+)
+
+// Code names an error kind on the wire, in the JSON error bodies of the
+// HTTP transport and the error details of the gRPC one.
+type Code string
+
+const (
+	CodeNotFound      Code = "not_found"
+	CodeGroupNotFound Code = "group_not_found"
+	CodeUnavailable   Code = "peer_unavailable"
+	CodeTimeout       Code = "timeout"
+	CodeLoader        Code = "loader_failure"
+	CodeDecode        Code = "decode_error"
+	CodeOverloaded    Code = "overloaded"
+	CodeInternal      Code = "internal"
+)
+
+var sentinels = map[Code]error{
+	CodeNotFound:      ErrNotFound,
+	CodeGroupNotFound: ErrGroupNotFound,
+	CodeUnavailable:   ErrUnavailable,
+	CodeTimeout:       ErrTimeout,
+	CodeLoader:        ErrLoader,
+	CodeDecode:        ErrDecode,
+	CodeOverloaded:    ErrOverloaded,
+}
+
+// CodeOf classifies err. context.DeadlineExceeded counts as a timeout;
+// errors of no known kind are CodeInternal.
+func CodeOf(err error) Code {
+	// 先判断更具体的种类，例如加载超时既是 ErrLoader 也是超时
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return CodeNotFound
+	case errors.Is(err, ErrGroupNotFound):
+		return CodeGroupNotFound
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, ErrOverloaded):
+		return CodeOverloaded
+	case errors.Is(err, ErrUnavailable):
+		return CodeUnavailable
+	case errors.Is(err, ErrDecode):
+		return CodeDecode
+	case errors.Is(err, ErrLoader):
+		return CodeLoader
+	}
+	return CodeInternal
+}
+
+// Unreachable reports whether err means no answer came from the peer: a
+// transport failure, a timeout on the way or the peer declaring itself
+// unavailable. Errors the peer answered with, such as a failed load, are
+// not.
+func Unreachable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code == CodeUnavailable
+	}
+	switch CodeOf(err) {
+	case CodeUnavailable, CodeTimeout, CodeInternal:
+		return true
+	}
+	return false
+}
+
+// Error is an error as sent between nodes. Receivers rebuild it from the
+// wire so that errors.Is matches the sentinel of its Code.
+type Error struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewError describes err for sending to another node.
+func NewError(err error) *Error {
+	return &Error{Code: CodeOf(err), Message: err.Error()}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the sentinel of e.Code, nil for CodeInternal.
+func (e *Error) Unwrap() error {
+	return sentinels[e.Code]
+}
@@ -1,5 +1,10 @@
 package peer
 
+import (
+	"context"
+	"errors"
+)
+
 // Picker 定义了获取分布式节点的能力
 type Picker[K comparable, V any] interface {
 	Pick(key K) (Fetcher[K, V], bool)
@@ -7,7 +12,71 @@ type Picker[K comparable, V any] interface {
 	DelPeers(peersAddr ...K)
 }
 
+// ReplicaPicker 可以按哈希环顺序挑选多个远端节点，用于对冲请求
+// PickN 最多返回 n 个健康的远端节点，遇到自身即停止
+type ReplicaPicker[K comparable, V any] interface {
+	Picker[K, V]
+	PickN(key K, n int) []Fetcher[K, V]
+}
+
 // Fetcher 定义了从远端获取缓存的能力，所以每个 Peer 都应实现这个接口
+// ctx 取消或超时后 Fetch 应尽快返回
 type Fetcher[K comparable, V any] interface {
-	Fetch(group string, key K) (V, error)
+	Fetch(ctx context.Context, group string, key K) (V, error)
+}
+
+// Checker 是可选接口，实现它的 Fetcher 可以被主动探测健康状态
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// FetcherFactory 为指定地址的远端节点创建 Fetcher
+type FetcherFactory[K comparable, V any] func(addr K) Fetcher[K, V]
+
+// ProtocolPicker 能根据节点注册的协议（"HTTP"/"GRPC"）创建对应的 Fetcher，
+// 使不同协议的节点共用一个哈希环
+type ProtocolPicker[K comparable, V any] interface {
+	Picker[K, V]
+	AddProtocolPeers(protocol string, peersAddr ...K)
+}
+
+// Entry 是迁移时传输的一条缓存，Expires 为 UnixNano，0 表示不过期
+type Entry[K comparable, V any] struct {
+	Key     K     `json:"key"`
+	Value   V     `json:"value"`
+	Expires int64 `json:"expires"`
+}
+
+// Transferer 可以把缓存条目批量推送给远端节点
+type Transferer[K comparable, V any] interface {
+	Transfer(ctx context.Context, group string, entries []Entry[K, V]) error
+}
+
+// Rebalancer 在哈希环变化时通知订阅者，并能找出 key 的所属节点，
+// 使节点把不再属于自己的缓存推送给新的所属节点
+type Rebalancer[K comparable, V any] interface {
+	Picker[K, V]
+	// Owner 返回哈希环上负责 key 的远端节点，key 属于自身或节点不支持迁移时 ok 为 false
+	Owner(key K) (addr K, t Transferer[K, V], ok bool)
+	// OnRingChange 注册哈希环变化后的回调，回调不应阻塞
+	OnRingChange(f func())
+}
+
+// Mutator 可以写入或删除远端节点上的缓存，只影响该节点，供运维工具使用
+type Mutator[K comparable, V any] interface {
+	Set(ctx context.Context, group string, key K, value V) error
+	Delete(ctx context.Context, group string, key K) error
+}
+
+// ErrLockUnavailable 表示无法使用填充锁，例如连接不上 etcd。调用者应当不加锁直接加载
+var ErrLockUnavailable = errors.New("kuncache: fill lock unavailable")
+
+// FillLock 让集群中同一时间只有一个节点为 key 调用 Getter，其他节点等待并使用它的结果
+type FillLock interface {
+	// Fill 在没有其他节点填充 group/key 时执行 fill 并返回其结果；否则等待该节点
+	// 完成并返回它共享的结果，包括 ErrNotFound。该节点因其他错误失败时可以不共享，
+	// 等待者重新竞争锁。锁本身不可用时返回 ErrLockUnavailable
+	Fill(ctx context.Context, group, key string, fill func() ([]byte, error)) ([]byte, error)
+	// Forget 丢弃 group/key 共享的结果，key 被写入或删除后调用，之后的 Fill 重新加载
+	Forget(ctx context.Context, group, key string) error
 }
@@ -1,43 +1,176 @@
+// Package singleflight suppresses duplicate calls: concurrent calls for the
+// same key share the result of a single execution.
 package singleflight
 
-import "sync"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// errGoexit 表示 fn 调用了 runtime.Goexit
+var errGoexit = errors.New("singleflight: runtime.Goexit was called")
+
+// PanicError is the error of a call whose fn panicked. Do and DoContext
+// panic with it in every waiter; DoChan delivers it as Result.Err.
+type PanicError struct {
+	Value any    // the value fn panicked with
+	Stack []byte // the stack of fn when it panicked
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: panic: %v\n\n%s", p.Value, p.Stack)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// Result is the outcome of a call delivered by DoChan. Shared reports
+// whether the result was given to more than one caller.
+type Result[V any] struct {
+	Val    V
+	Err    error
+	Shared bool
+}
 
 type call[V any] struct {
-	wg  sync.WaitGroup
-	val V
-	err error
+	// done 在 fn 返回后关闭，之后 val、err、dups 不再改变
+	done chan struct{}
+	val  V
+	err  error
+	// dups 加入这次调用的其他调用者数量，chans 是 DoChan 调用者的结果通道
+	dups  int
+	chans []chan<- Result[V]
 }
 
+// Group runs calls for the same key once. The zero Group is ready to use.
 type Group[K comparable, V any] struct {
 	mu sync.Mutex // protects m
 	m  map[K]*call[V]
 }
 
-// 包装函数，多次请求执行一次
-func (g *Group[K, V]) Do(key K, fn func() (V, error)) (V, error) {
+// join 返回 key 正在执行的调用，没有时创建一个，leader 表示需要由调用者执行 fn
+func (g *Group[K, V]) join(key K, ch chan<- Result[V]) (c *call[V], leader bool) {
 	g.mu.Lock()
+	defer g.mu.Unlock()
 	//延迟初始化
 	if g.m == nil {
 		g.m = make(map[K]*call[V])
 	}
-	//如果请求存在，等待请求结果
 	if c, ok := g.m[key]; ok {
-		g.mu.Unlock()
-		c.wg.Wait()
-		return c.val, c.err
+		c.dups++
+		if ch != nil {
+			c.chans = append(c.chans, ch)
+		}
+		return c, false
+	}
+	c = &call[V]{done: make(chan struct{})}
+	if ch != nil {
+		c.chans = append(c.chans, ch)
 	}
-	//没有加入map，后续请求等待结果即可
-	c := &call[V]{}
-	c.wg.Add(1)
 	g.m[key] = c
-	g.mu.Unlock()
-	//执行请求，执行完毕其余等待请求直接返回结果
-	c.val, c.err = fn()
-	c.wg.Done()
-	//请求结束，删除请求
+	return c, true
+}
+
+// Do executes fn and returns its results, making sure only one execution
+// is in flight for key at a time. Callers arriving while it runs wait for
+// it and receive the same results; shared reports whether that happened.
+// If fn panics, every waiter panics with a *PanicError.
+func (g *Group[K, V]) Do(key K, fn func() (V, error)) (v V, err error, shared bool) {
+	c, leader := g.join(key, nil)
+	if leader {
+		g.doCall(c, key, fn)
+	} else {
+		<-c.done
+	}
+	return c.result()
+}
+
+// DoChan is like Do but returns at once with a channel that receives the
+// results when they are ready. A panic of fn is delivered as a
+// *PanicError instead of being raised. The channel is buffered, so it does
+// not need to be read.
+func (g *Group[K, V]) DoChan(key K, fn func() (V, error)) <-chan Result[V] {
+	ch := make(chan Result[V], 1)
+	c, leader := g.join(key, ch)
+	if leader {
+		go g.doCall(c, key, fn)
+	}
+	return ch
+}
+
+// DoContext is like Do but stops waiting when ctx is done, returning
+// ctx.Err(). The execution of fn is shared and keeps running for the other
+// callers, so fn must not depend on ctx.
+func (g *Group[K, V]) DoContext(ctx context.Context, key K, fn func() (V, error)) (v V, err error, shared bool) {
+	select {
+	case r := <-g.DoChan(key, fn):
+		if p, ok := r.Err.(*PanicError); ok {
+			panic(p)
+		}
+		return r.Val, r.Err, r.Shared
+	case <-ctx.Done():
+		return v, ctx.Err(), false
+	}
+}
+
+// Forget makes the next call for key execute fn again instead of waiting
+// for the one in flight. Callers already waiting still get its results.
+func (g *Group[K, V]) Forget(key K) {
 	g.mu.Lock()
+	defer g.mu.Unlock()
 	delete(g.m, key)
-	g.mu.Unlock()
+}
+
+// doCall 执行 fn 并通知所有等待者，fn panic 或调用 runtime.Goexit 时也会通知
+func (g *Group[K, V]) doCall(c *call[V], key K, fn func() (V, error)) {
+	normalReturn := false
+	defer func() {
+		if !normalReturn {
+			if r := recover(); r != nil {
+				c.err = &PanicError{Value: r, Stack: stack()}
+			} else {
+				c.err = errGoexit
+			}
+		}
+		g.mu.Lock()
+		//请求结束，删除请求；Forget 之后 key 可能已经属于新的调用
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+		close(c.done)
+		for _, ch := range c.chans {
+			ch <- Result[V]{Val: c.val, Err: c.err, Shared: c.dups > 0}
+		}
+		g.mu.Unlock()
+	}()
+	c.val, c.err = fn()
+	normalReturn = true
+}
+
+// result 返回调用的结果，fn panic 或调用 runtime.Goexit 时在调用者中重现
+func (c *call[V]) result() (V, error, bool) {
+	if p, ok := c.err.(*PanicError); ok {
+		panic(p)
+	}
+	if c.err == errGoexit {
+		runtime.Goexit()
+	}
+	return c.val, c.err, c.dups > 0
+}
 
-	return c.val, c.err
+// stack 返回去掉 goroutine 头部的调用栈
+func stack() []byte {
+	s := debug.Stack()
+	if line := bytes.IndexByte(s, '\n'); line >= 0 {
+		s = s[line+1:]
+	}
+	return s
 }
@@ -1,14 +1,26 @@
 package singleflight
 
 import (
+	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestSingleFlight(t *testing.T) {
+	// 需要在 localhost:9999 运行的 API 服务
+	if conn, err := net.DialTimeout("tcp", "localhost:9999", time.Second); err != nil {
+		t.Skip("no API server on localhost:9999")
+	} else {
+		conn.Close()
+	}
 	var wg sync.WaitGroup
 
 	for i := 0; i < 30; i++ {
@@ -34,3 +46,186 @@ func TestSingleFlight(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+// TestDoHTTP 与 TestSingleFlight 相同，但使用测试内启动的服务
+func TestDoHTTP(t *testing.T) {
+	var g Group[string, string]
+	var loads atomic.Int32
+	release := make(chan struct{})
+	// 慢数据源，所有请求到达后才返回
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, err, _ := g.Do(r.URL.Query().Get("key"), func() (string, error) {
+			loads.Add(1)
+			<-release
+			return "630", nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, v)
+	}))
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := http.Get(srv.URL + "/api?key=Tom")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer res.Body.Close()
+			bytes, err := io.ReadAll(res.Body)
+			if err != nil || res.StatusCode != http.StatusOK || string(bytes) != "630" {
+				t.Errorf("got %s %q, %v", res.Status, bytes, err)
+			}
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loads = %d, want 1", n)
+	}
+}
+
+func TestDoShared(t *testing.T) {
+	var g Group[string, int]
+	v, err, shared := g.Do("key", func() (int, error) { return 1, nil })
+	if v != 1 || err != nil || shared {
+		t.Fatalf("Do = %v, %v, %v; want 1, nil, false", v, err, shared)
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	results := make([]bool, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, results[i] = g.Do("key", func() (int, error) {
+				close(started)
+				<-release
+				return 2, nil
+			})
+		}(i)
+		if i == 0 {
+			<-started
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for i, shared := range results {
+		if !shared {
+			t.Fatalf("caller %d: shared = false", i)
+		}
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	var g Group[string, int]
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	panics := make(chan any, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { panics <- recover() }()
+			g.Do("key", func() (int, error) {
+				close(started)
+				<-release
+				panic("boom")
+			})
+		}(i)
+		if i == 0 {
+			<-started
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(panics)
+	for p := range panics {
+		if e, ok := p.(*PanicError); !ok || e.Value != "boom" {
+			t.Fatalf("recovered %v, want *PanicError for boom", p)
+		}
+	}
+
+	// panic 之后同一个 key 可以再次执行
+	if v, err, _ := g.Do("key", func() (int, error) { return 1, nil }); v != 1 || err != nil {
+		t.Fatalf("after panic Do = %v, %v", v, err)
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group[string, int]
+	errBoom := errors.New("boom")
+	r := <-g.DoChan("key", func() (int, error) { return 0, errBoom })
+	if r.Err != errBoom || r.Shared {
+		t.Fatalf("DoChan = %+v", r)
+	}
+
+	r = <-g.DoChan("key", func() (int, error) { panic(errBoom) })
+	var p *PanicError
+	if !errors.As(r.Err, &p) || !errors.Is(r.Err, errBoom) {
+		t.Fatalf("DoChan after panic err = %v, want *PanicError wrapping boom", r.Err)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group[string, int]
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (int, error) {
+		<-release
+		return 1, nil
+	})
+	// 等待第一次调用开始
+	time.Sleep(10 * time.Millisecond)
+	g.Forget("key")
+	if v, _, shared := g.Do("key", func() (int, error) { return 2, nil }); v != 2 || shared {
+		t.Fatalf("after Forget Do = %v, shared %v; want a new call", v, shared)
+	}
+	close(release)
+	if r := <-first; r.Val != 1 {
+		t.Fatalf("forgotten call returned %v, want 1", r.Val)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group[string, int]
+	release := make(chan struct{})
+	var loads atomic.Int32
+	fn := func() (int, error) {
+		loads.Add(1)
+		<-release
+		return 1, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err, _ := g.DoContext(ctx, "key", fn); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+
+	// 放弃等待的调用者不影响共享的调用
+	done := make(chan Result[int])
+	go func() {
+		v, err, shared := g.DoContext(context.Background(), "key", fn)
+		done <- Result[int]{v, err, shared}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if r := <-done; r.Val != 1 || r.Err != nil || !r.Shared {
+		t.Fatalf("DoContext = %+v, want the shared result", r)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loads = %d, want 1", n)
+	}
+}